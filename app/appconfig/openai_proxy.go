@@ -1,12 +1,22 @@
 package appconfig
 
-import "gin_base/app/service/upstream"
+import (
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/tracing"
+	"gin_base/app/service/upstream"
+)
 
 // OpenAIProxyConfig OpenAI 代理配置
 type OpenAIProxyConfig struct {
 	// 对外提供的 API Keys（客户端使用这些 key 访问本服务）
 	APIKeys []string `mapstructure:"api_keys" yaml:"api_keys"`
 
+	// 虚拟 Key：带名称、所属、模型/接口白名单、有效期和启用状态的客户端密钥
+	VirtualKeys []apikey.VirtualKey `mapstructure:"virtual_keys" yaml:"virtual_keys"`
+
+	// 客户端密钥限流：每分钟请求数和 token 数的默认上限（虚拟 Key 可单独配置 rpm/tpm 覆盖）
+	RateLimit RateLimitConfig `mapstructure:"rate_limit" yaml:"rate_limit"`
+
 	// 管理后台登录密钥（独立于 api_keys，用于管理页面登录）
 	AdminKey string `mapstructure:"admin_key" yaml:"admin_key"`
 
@@ -16,8 +26,70 @@ type OpenAIProxyConfig struct {
 	// 请求重试配置
 	MaxRetries int `mapstructure:"max_retries" yaml:"max_retries"` // 单次请求最大尝试次数（默认1，不重试；设置>1启用故障转移）
 
+	// 重试策略：哪些错误触发故障转移、哪些计入健康失败次数（不填使用默认策略，供应商可单独配置覆盖）
+	RetryPolicy *upstream.RetryPolicy `mapstructure:"retry_policy" yaml:"retry_policy"`
+
+	// 流式中途故障转移：流已开始输出后上游中断时，以已输出内容作为 assistant 前缀在下一个供应商续写（仅 chat 接口）
+	MidStreamFailover bool `mapstructure:"mid_stream_failover" yaml:"mid_stream_failover"`
+
+	// 路由策略（同优先级内的选择方式）：weighted_rr（默认）/ random / least_inflight / lowest_p50_latency / lowest_ttft / lowest_cost
+	DefaultStrategy string            `mapstructure:"default_strategy" yaml:"default_strategy"`
+	Strategies      map[string]string `mapstructure:"strategies" yaml:"strategies"` // 按模型别名指定路由策略，覆盖默认策略
+
 	// 供应商管理器配置
 	MaxFailures       int `mapstructure:"max_failures" yaml:"max_failures"`               // 最大连续失败次数（超过后标记供应商不健康）
 	RecoveryInterval  int `mapstructure:"recovery_interval" yaml:"recovery_interval"`     // 恢复间隔（秒）
 	HealthCheckPeriod int `mapstructure:"health_check_period" yaml:"health_check_period"` // 健康检查周期（秒）
+
+	// 恢复模式：breaker（默认，熔断器：冷却 recovery_interval 后放行部分真实流量，连续成功后恢复）/ probe（健康检查时发起探测请求恢复）
+	RecoveryMode      string  `mapstructure:"recovery_mode" yaml:"recovery_mode"`
+	HalfOpenRatio     float64 `mapstructure:"half_open_ratio" yaml:"half_open_ratio"`         // 半开状态放行的流量比例（默认0.1）
+	HalfOpenSuccesses int     `mapstructure:"half_open_successes" yaml:"half_open_successes"` // 半开状态连续成功多少次后恢复（默认3）
+
+	// 窗口错误率熔断：error_rate_threshold 大于 0 时，以最近窗口内的错误率代替连续失败次数判定是否熔断
+	ErrorRateThreshold   float64 `mapstructure:"error_rate_threshold" yaml:"error_rate_threshold"`       // 错误率阈值(%)
+	ErrorRateWindow      int     `mapstructure:"error_rate_window" yaml:"error_rate_window"`             // 统计窗口（秒，默认300）
+	ErrorRateMinRequests int     `mapstructure:"error_rate_min_requests" yaml:"error_rate_min_requests"` // 窗口内最少请求数，不足时不熔断（默认10）
+
+	// 请求记录保留天数：每个代理请求记录到数据库，定时清理超过保留天数的记录（默认7，小于0不清理）
+	RequestLogRetentionDays int `mapstructure:"request_log_retention_days" yaml:"request_log_retention_days"`
+
+	// 请求体/响应体采集：按客户端密钥或模型别名、按比例采集客户端请求体、各次尝试的上游请求体与响应体及返回客户端的响应（默认关闭）
+	BodyCapture BodyCaptureConfig `mapstructure:"body_capture" yaml:"body_capture"`
+
+	// 响应缓存：完全相同的 chat 请求在有效期内直接返回缓存的响应（流式请求以 SSE 数据块重放，默认关闭）
+	ResponseCache ResponseCacheConfig `mapstructure:"response_cache" yaml:"response_cache"`
+
+	// 链路追踪：以 OTLP/HTTP 导出每个请求及各次上游尝试的跨度（修改后需重启生效）
+	Tracing tracing.Config `mapstructure:"tracing" yaml:"tracing"`
+}
+
+// RateLimitConfig 客户端密钥限流配置
+type RateLimitConfig struct {
+	Backend         string `json:"backend,omitempty" yaml:"backend,omitempty" mapstructure:"backend"`                            // 计数后端：memory（默认）/ redis
+	RedisConnection string `json:"redis_connection,omitempty" yaml:"redis_connection,omitempty" mapstructure:"redis_connection"` // redis 后端使用的连接名（redis.yaml 中的连接，默认 default）
+	RPM             int    `json:"rpm,omitempty" yaml:"rpm,omitempty" mapstructure:"rpm"`                                        // 每个客户端密钥默认每分钟请求数上限（0 不限制）
+	TPM             int    `json:"tpm,omitempty" yaml:"tpm,omitempty" mapstructure:"tpm"`                                        // 每个客户端密钥默认每分钟 token 数上限（0 不限制）
+}
+
+// BodyCaptureConfig 请求体/响应体采集配置（默认关闭）
+// keys 与 aliases 均为空时采集所有请求，否则采集客户端密钥在 keys 中或模型别名在 aliases 中的请求
+type BodyCaptureConfig struct {
+	Enabled      bool     `json:"enabled" yaml:"enabled" mapstructure:"enabled"`                                          // 是否启用
+	Keys         []string `json:"keys,omitempty" yaml:"keys,omitempty" mapstructure:"keys"`                               // 采集的客户端密钥名称
+	Aliases      []string `json:"aliases,omitempty" yaml:"aliases,omitempty" mapstructure:"aliases"`                      // 采集的模型别名
+	SampleRate   *float64 `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty" mapstructure:"sample_rate"`          // 采样比例 0~1（默认 1，全部采集）
+	MaxBodyBytes int      `json:"max_body_bytes,omitempty" yaml:"max_body_bytes,omitempty" mapstructure:"max_body_bytes"` // 单个请求体/响应体最多保存的字节数（默认 65536）
+	Redact       []string `json:"redact,omitempty" yaml:"redact,omitempty" mapstructure:"redact"`                         // 脱敏的 JSON 路径（如 messages.*.content），值替换为 [REDACTED]
+}
+
+// ResponseCacheConfig 响应缓存配置（默认关闭）
+// aliases 为空时缓存所有模型别名，否则只缓存列出的别名
+type ResponseCacheConfig struct {
+	Enabled         bool     `json:"enabled" yaml:"enabled" mapstructure:"enabled"`                                                // 是否启用
+	Backend         string   `json:"backend,omitempty" yaml:"backend,omitempty" mapstructure:"backend"`                            // 存储后端：memory（默认）/ redis
+	RedisConnection string   `json:"redis_connection,omitempty" yaml:"redis_connection,omitempty" mapstructure:"redis_connection"` // redis 后端使用的连接名（redis.yaml 中的连接，默认 default）
+	TTL             int      `json:"ttl,omitempty" yaml:"ttl,omitempty" mapstructure:"ttl"`                                        // 缓存有效期（秒，默认 3600）
+	Aliases         []string `json:"aliases,omitempty" yaml:"aliases,omitempty" mapstructure:"aliases"`                            // 缓存的模型别名
+	MaxEntryBytes   int      `json:"max_entry_bytes,omitempty" yaml:"max_entry_bytes,omitempty" mapstructure:"max_entry_bytes"`    // 单个响应最多缓存的字节数，超过不缓存（默认 1048576）
 }
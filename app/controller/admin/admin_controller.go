@@ -6,7 +6,12 @@ import (
 	"gin_base/app/appconfig"
 	"gin_base/app/helper/log_helper"
 	"gin_base/app/helper/response_helper"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/ratelimit"
+	"gin_base/app/service/requestlog"
+	"gin_base/app/service/respcache"
 	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
 	"os"
 	"path/filepath"
 	"sync"
@@ -19,21 +24,33 @@ import (
 // AdminController 管理后台控制器
 type AdminController struct {
 	manager    *upstream.Manager
-	apiKeys    []string
+	keyStore   *apikey.Store        // 客户端密钥（api_keys 与 virtual_keys）
+	limiter    *ratelimit.Limiter   // 客户端密钥限流
+	usage      *usagestat.Recorder  // token 用量统计
+	requests   *requestlog.Recorder // 请求记录
+	cache      *respcache.Cache     // 响应缓存
+	configMu   sync.Mutex           // 串行化配置文件的读改写与重载
 	adminKey   string
 	configPath string
 	maxRetries int
 	mu         sync.RWMutex
+
+	midStreamFailover bool                         // 流式中途故障转移续写
+	bodyCapture       *appconfig.BodyCaptureConfig // 请求体/响应体采集
 }
 
 // NewAdminController 创建管理控制器
-func NewAdminController(manager *upstream.Manager, apiKeys []string, adminKey string, maxRetries int) *AdminController {
+func NewAdminController(manager *upstream.Manager, keyStore *apikey.Store, limiter *ratelimit.Limiter, usage *usagestat.Recorder, requests *requestlog.Recorder, cache *respcache.Cache, adminKey string, maxRetries int) *AdminController {
 	if maxRetries <= 0 {
 		maxRetries = 1
 	}
 	return &AdminController{
 		manager:    manager,
-		apiKeys:    apiKeys,
+		keyStore:   keyStore,
+		limiter:    limiter,
+		usage:      usage,
+		requests:   requests,
+		cache:      cache,
 		adminKey:   adminKey,
 		configPath: filepath.Join("app", "appconfig", "openai_proxy.yaml"),
 		maxRetries: maxRetries,
@@ -71,18 +88,42 @@ func (c *AdminController) GetMaxRetries() int {
 	return c.maxRetries
 }
 
-// SetAPIKeys 设置 API Keys（用于热重载）
-func (c *AdminController) SetAPIKeys(apiKeys []string) {
+// SetMidStreamFailover 设置是否启用流式中途故障转移续写（用于热重载）
+func (c *AdminController) SetMidStreamFailover(enabled bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.apiKeys = apiKeys
+	c.midStreamFailover = enabled
 }
 
-// GetAPIKeys 获取当前 API Keys
-func (c *AdminController) GetAPIKeys() []string {
+// SetBodyCapture 设置请求体/响应体采集配置（用于热重载）
+func (c *AdminController) SetBodyCapture(cfg appconfig.BodyCaptureConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodyCapture = &cfg
+}
+
+// GetBodyCapture 获取请求体/响应体采集配置
+func (c *AdminController) GetBodyCapture() *appconfig.BodyCaptureConfig {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.apiKeys
+	return c.bodyCapture
+}
+
+// GetMidStreamFailover 获取是否启用流式中途故障转移续写
+func (c *AdminController) GetMidStreamFailover() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.midStreamFailover
+}
+
+// SetAPIKeys 设置 API Keys（用于热重载）
+func (c *AdminController) SetAPIKeys(apiKeys []string) {
+	c.keyStore.SetAPIKeys(apiKeys)
+}
+
+// GetAPIKeys 获取当前 API Keys
+func (c *AdminController) GetAPIKeys() []string {
+	return c.keyStore.APIKeys()
 }
 
 // SetAdminKey 设置管理密钥（用于热重载）
@@ -152,6 +193,12 @@ type ConfigResponse struct {
 	MaxFailures       int                       `json:"max_failures"`
 	RecoveryInterval  int                       `json:"recovery_interval"`
 	HealthCheckPeriod int                       `json:"health_check_period"`
+	MidStreamFailover bool                      `json:"mid_stream_failover"`
+	RecoveryMode      string                    `json:"recovery_mode"`
+	HalfOpenRatio     float64                   `json:"half_open_ratio"`
+	HalfOpenSuccesses int                       `json:"half_open_successes"`
+	DefaultStrategy   string                    `json:"default_strategy"`
+	Strategies        map[string]string         `json:"strategies"`
 }
 
 // GetConfig 获取配置
@@ -175,6 +222,12 @@ func (c *AdminController) GetConfig(ctx *gin.Context) {
 		MaxFailures:       config.MaxFailures,
 		RecoveryInterval:  config.RecoveryInterval,
 		HealthCheckPeriod: config.HealthCheckPeriod,
+		MidStreamFailover: config.MidStreamFailover,
+		RecoveryMode:      config.RecoveryMode,
+		HalfOpenRatio:     config.HalfOpenRatio,
+		HalfOpenSuccesses: config.HalfOpenSuccesses,
+		DefaultStrategy:   config.DefaultStrategy,
+		Strategies:        config.Strategies,
 	})
 }
 
@@ -185,6 +238,12 @@ type SaveConfigRequest struct {
 	MaxFailures       *int                      `json:"max_failures,omitempty"`
 	RecoveryInterval  *int                      `json:"recovery_interval,omitempty"`
 	HealthCheckPeriod *int                      `json:"health_check_period,omitempty"`
+	MidStreamFailover *bool                     `json:"mid_stream_failover,omitempty"`
+	RecoveryMode      *string                   `json:"recovery_mode,omitempty"`
+	HalfOpenRatio     *float64                  `json:"half_open_ratio,omitempty"`
+	HalfOpenSuccesses *int                      `json:"half_open_successes,omitempty"`
+	DefaultStrategy   *string                   `json:"default_strategy,omitempty"`
+	Strategies        map[string]string         `json:"strategies,omitempty"` // 传入（含空对象）时整体替换
 }
 
 // SaveConfig 保存配置
@@ -201,6 +260,9 @@ func (c *AdminController) SaveConfig(ctx *gin.Context) {
 		return
 	}
 
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
 	// 保存配置到文件（更新 providers 和全局配置）
 	if err := c.saveConfig(&req); err != nil {
 		response_helper.Fail(ctx, "保存配置失败: "+err.Error())
@@ -241,6 +303,51 @@ func (c *AdminController) loadConfig() (*appconfig.OpenAIProxyConfig, error) {
 
 // saveConfig 保存配置到文件（更新 providers 和全局配置，保留其他字段和注释）
 func (c *AdminController) saveConfig(req *SaveConfigRequest) error {
+	return c.editConfig(func(mapNode *yaml.Node) error {
+		// 替换 providers
+		if err := setConfigNode(mapNode, "providers", req.Providers); err != nil {
+			return err
+		}
+
+		// 更新全局配置参数（如果提供了）
+		if req.MaxRetries != nil {
+			setConfigField(mapNode, "max_retries", *req.MaxRetries)
+		}
+		if req.MaxFailures != nil {
+			setConfigField(mapNode, "max_failures", *req.MaxFailures)
+		}
+		if req.RecoveryInterval != nil {
+			setConfigField(mapNode, "recovery_interval", *req.RecoveryInterval)
+		}
+		if req.HealthCheckPeriod != nil {
+			setConfigField(mapNode, "health_check_period", *req.HealthCheckPeriod)
+		}
+		if req.MidStreamFailover != nil {
+			setConfigField(mapNode, "mid_stream_failover", *req.MidStreamFailover)
+		}
+		if req.RecoveryMode != nil {
+			setConfigField(mapNode, "recovery_mode", *req.RecoveryMode)
+		}
+		if req.HalfOpenRatio != nil {
+			setConfigField(mapNode, "half_open_ratio", *req.HalfOpenRatio)
+		}
+		if req.HalfOpenSuccesses != nil {
+			setConfigField(mapNode, "half_open_successes", *req.HalfOpenSuccesses)
+		}
+		if req.DefaultStrategy != nil {
+			setConfigField(mapNode, "default_strategy", *req.DefaultStrategy)
+		}
+		if req.Strategies != nil {
+			if err := setConfigNode(mapNode, "strategies", req.Strategies); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// editConfig 以 yaml.Node 形式修改配置文件的顶层字段后写回（保留其他字段和注释）
+func (c *AdminController) editConfig(edit func(mapNode *yaml.Node) error) error {
 	// 读取原文件内容
 	data, err := os.ReadFile(c.configPath)
 	if err != nil {
@@ -263,62 +370,10 @@ func (c *AdminController) saveConfig(req *SaveConfigRequest) error {
 		return fmt.Errorf("expected mapping node")
 	}
 
-	// 序列化新的 providers
-	var providersNode yaml.Node
-	if err := providersNode.Encode(req.Providers); err != nil {
+	if err := edit(mapNode); err != nil {
 		return err
 	}
 
-	// 更新或添加配置项的辅助函数
-	updateOrAddField := func(key string, value int) {
-		for i := 0; i < len(mapNode.Content)-1; i += 2 {
-			if mapNode.Content[i].Value == key {
-				mapNode.Content[i+1].Value = fmt.Sprintf("%d", value)
-				return
-			}
-		}
-		// 未找到则添加
-		mapNode.Content = append(mapNode.Content,
-			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
-			&yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprintf("%d", value)},
-		)
-	}
-
-	// 在 map 中找到 providers 键并替换值
-	found := false
-	for i := 0; i < len(mapNode.Content)-1; i += 2 {
-		keyNode := mapNode.Content[i]
-		if keyNode.Value == "providers" {
-			// 替换 providers 的值节点
-			mapNode.Content[i+1] = &providersNode
-			found = true
-			break
-		}
-	}
-
-	// 如果没找到 providers 键，添加到末尾
-	if !found {
-		keyNode := &yaml.Node{
-			Kind:  yaml.ScalarNode,
-			Value: "providers",
-		}
-		mapNode.Content = append(mapNode.Content, keyNode, &providersNode)
-	}
-
-	// 更新全局配置参数（如果提供了）
-	if req.MaxRetries != nil {
-		updateOrAddField("max_retries", *req.MaxRetries)
-	}
-	if req.MaxFailures != nil {
-		updateOrAddField("max_failures", *req.MaxFailures)
-	}
-	if req.RecoveryInterval != nil {
-		updateOrAddField("recovery_interval", *req.RecoveryInterval)
-	}
-	if req.HealthCheckPeriod != nil {
-		updateOrAddField("health_check_period", *req.HealthCheckPeriod)
-	}
-
 	// 序列化回 yaml
 	var buf bytes.Buffer
 	encoder := yaml.NewEncoder(&buf)
@@ -331,6 +386,38 @@ func (c *AdminController) saveConfig(req *SaveConfigRequest) error {
 	return os.WriteFile(c.configPath, buf.Bytes(), 0644)
 }
 
+// setConfigField 更新或添加标量配置项
+func setConfigField(mapNode *yaml.Node, key string, value interface{}) {
+	for i := 0; i < len(mapNode.Content)-1; i += 2 {
+		if mapNode.Content[i].Value == key {
+			mapNode.Content[i+1].Value = fmt.Sprintf("%v", value)
+			return
+		}
+	}
+	// 未找到则添加
+	mapNode.Content = append(mapNode.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprintf("%v", value)},
+	)
+}
+
+// setConfigNode 更新或添加复合配置项（map/list），整体替换原值
+func setConfigNode(mapNode *yaml.Node, key string, value interface{}) error {
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	for i := 0; i < len(mapNode.Content)-1; i += 2 {
+		if mapNode.Content[i].Value == key {
+			mapNode.Content[i+1] = &valueNode
+			return nil
+		}
+	}
+	// 未找到则添加到末尾
+	mapNode.Content = append(mapNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &valueNode)
+	return nil
+}
+
 // GetLogs 获取最新日志
 func (c *AdminController) GetLogs(ctx *gin.Context) {
 	apiKey := ctx.GetHeader("X-API-Key")
@@ -381,10 +468,10 @@ func (c *AdminController) ClearLogs(ctx *gin.Context) {
 func (c *AdminController) reloadManager(config *appconfig.OpenAIProxyConfig) error {
 	oldManager := c.GetManager()
 
-	// 保存旧的轮询计数器值
-	var oldCounter uint64
+	// 保存旧的轮询计数器值（按别名）
+	var oldCounters map[string]uint64
 	if oldManager != nil {
-		oldCounter = oldManager.GetRoundRobinCounter()
+		oldCounters = oldManager.GetRoundRobinCounters()
 	}
 
 	// 创建新的管理器配置
@@ -406,14 +493,26 @@ func (c *AdminController) reloadManager(config *appconfig.OpenAIProxyConfig) err
 		MaxFailures:       maxFailures,
 		RecoveryInterval:  time.Duration(recoveryInterval) * time.Second,
 		HealthCheckPeriod: time.Duration(healthCheckPeriod) * time.Second,
+		RecoveryMode:      config.RecoveryMode,
+		HalfOpenRatio:     config.HalfOpenRatio,
+		HalfOpenSuccesses: config.HalfOpenSuccesses,
+		RetryPolicy:       config.RetryPolicy,
+		DefaultStrategy:   config.DefaultStrategy,
+		Strategies:        config.Strategies,
+
+		ErrorRateThreshold:   config.ErrorRateThreshold,
+		ErrorRateWindow:      time.Duration(config.ErrorRateWindow) * time.Second,
+		ErrorRateMinRequests: config.ErrorRateMinRequests,
 	}
 
 	// 创建新的 Manager
 	newManager := upstream.NewManager(config.Providers, mgrConfig)
 
-	// 恢复轮询计数器值（保持负载均衡状态）
+	// 恢复轮询计数器值（保持负载均衡状态），并沿用未变化的供应商/模型的统计与健康状态
 	if oldManager != nil {
-		newManager.SetRoundRobinCounter(oldCounter)
+		newManager.SetRoundRobinCounters(oldCounters)
+		newManager.Restore(oldManager.Snapshot())
+		newManager.InheritMetrics(oldManager)
 	}
 
 	// 更新 Manager
@@ -424,6 +523,18 @@ func (c *AdminController) reloadManager(config *appconfig.OpenAIProxyConfig) err
 		c.SetMaxRetries(config.MaxRetries)
 	}
 
+	// 更新流式中途故障转移开关
+	c.SetMidStreamFailover(config.MidStreamFailover)
+
+	// 更新请求体/响应体采集配置
+	c.SetBodyCapture(config.BodyCapture)
+
+	// 更新响应缓存配置（存储后端需重启生效）
+	c.cache.SetConfig(config.ResponseCache)
+
+	// 更新客户端密钥及限额
+	c.applyClientConfig(config)
+
 	// 更新 AdminKey
 	if config.AdminKey != "" {
 		c.SetAdminKey(config.AdminKey)
@@ -436,3 +547,10 @@ func (c *AdminController) reloadManager(config *appconfig.OpenAIProxyConfig) err
 
 	return nil
 }
+
+// applyClientConfig 应用客户端相关配置：密钥、默认限额和请求记录保留天数（限流计数后端需重启生效）
+func (c *AdminController) applyClientConfig(config *appconfig.OpenAIProxyConfig) {
+	c.keyStore.Update(config.APIKeys, config.VirtualKeys)
+	c.limiter.SetDefaults(config.RateLimit)
+	requestlog.SetRetentionDays(config.RequestLogRetentionDays)
+}
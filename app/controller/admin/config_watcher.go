@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay 配置文件变更后的防抖时间（编辑器保存时可能连续触发多次事件）
+const configReloadDelay = 500 * time.Millisecond
+
+// WatchConfig 监听配置文件变更，变更后重新加载客户端密钥
+func (c *AdminController) WatchConfig() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录而非文件本身：编辑器常以重命名方式替换文件，直接监听文件会丢失后续事件
+	if err := watcher.Add(filepath.Dir(c.configPath)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	configPath := filepath.Clean(c.configPath)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != configPath || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(configReloadDelay, c.reloadAPIKeys)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log_helper.Warning("配置文件监听错误: " + err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadAPIKeys 从配置文件重新加载客户端密钥（api_keys 与 virtual_keys）及默认限额
+func (c *AdminController) reloadAPIKeys() {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	config, err := c.loadConfig()
+	if err != nil {
+		log_helper.Warning("配置文件变更后读取失败，保留当前客户端密钥: " + err.Error())
+		return
+	}
+	c.applyClientConfig(config)
+	log_helper.Info(fmt.Sprintf("配置文件已变更，客户端密钥已重新加载（api_keys: %d, virtual_keys: %d）", len(config.APIKeys), len(c.keyStore.VirtualKeys())))
+}
@@ -0,0 +1,292 @@
+package admin
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/helper/response_helper"
+	"gin_base/app/service/apikey"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyInfo 虚拟 Key 信息
+type KeyInfo struct {
+	Key       string   `json:"key"` // 脱敏后的密钥（仅创建时返回完整密钥）
+	Name      string   `json:"name"`
+	Owner     string   `json:"owner"`
+	Models    []string `json:"models"`
+	Endpoints []string `json:"endpoints"`
+	ExpiresAt string   `json:"expires_at"`
+	Enabled   bool     `json:"enabled"`
+	Expired   bool     `json:"expired"`
+	RPM       int      `json:"rpm"`
+	TPM       int      `json:"tpm"`
+
+	DailyBudget   float64 `json:"daily_budget"`
+	MonthlyBudget float64 `json:"monthly_budget"`
+	DailySpend    float64 `json:"daily_spend"`   // 当天已用费用（美元）
+	MonthlySpend  float64 `json:"monthly_spend"` // 当月已用费用（美元）
+}
+
+// newKeyInfo 转换为虚拟 Key 信息（密钥脱敏）
+func newKeyInfo(vk apikey.VirtualKey) KeyInfo {
+	info := KeyInfo{
+		Key:       apikey.MaskKey(vk.Key),
+		Name:      vk.Name,
+		Owner:     vk.Owner,
+		Models:    vk.Models,
+		Endpoints: vk.Endpoints,
+		ExpiresAt: vk.ExpiresAt,
+		Enabled:   vk.IsEnabled(),
+		RPM:       vk.RPM,
+		TPM:       vk.TPM,
+
+		DailyBudget:   vk.DailyBudget,
+		MonthlyBudget: vk.MonthlyBudget,
+	}
+	if vk.Validate() == nil {
+		info.Expired = vk.Expired(time.Now())
+	}
+	if info.Models == nil {
+		info.Models = []string{}
+	}
+	if info.Endpoints == nil {
+		info.Endpoints = []string{}
+	}
+	return info
+}
+
+// ListKeys 获取虚拟 Key 列表
+func (c *AdminController) ListKeys(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	config, err := c.loadConfig()
+	if err != nil {
+		response_helper.Fail(ctx, "读取配置失败: "+err.Error())
+		return
+	}
+
+	keys := make([]KeyInfo, 0, len(config.VirtualKeys))
+	for _, vk := range config.VirtualKeys {
+		info := newKeyInfo(vk)
+		info.DailySpend, info.MonthlySpend = c.usage.Spend(vk.Name)
+		keys = append(keys, info)
+	}
+	response_helper.Success(ctx, "获取成功", gin.H{
+		"keys":      keys,
+		"endpoints": apikey.Endpoints,
+	})
+}
+
+// CreateKey 创建虚拟 Key（未指定 key 时自动生成）
+func (c *AdminController) CreateKey(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	var vk apikey.VirtualKey
+	if err := ctx.ShouldBindJSON(&vk); err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+	if vk.Key == "" {
+		vk.Key = apikey.GenerateKey()
+	}
+
+	err := c.updateVirtualKeys(func(apiKeys []string, keys []apikey.VirtualKey) ([]apikey.VirtualKey, error) {
+		if err := checkVirtualKey(&vk, apiKeys, keys); err != nil {
+			return nil, err
+		}
+		return append(keys, vk), nil
+	})
+	if err != nil {
+		response_helper.Fail(ctx, "创建失败: "+err.Error())
+		return
+	}
+
+	log_helper.Info(fmt.Sprintf("虚拟 Key %s 已创建", vk.Name))
+	info := newKeyInfo(vk)
+	info.Key = vk.Key // 完整密钥仅在创建时返回一次
+	response_helper.Success(ctx, "创建成功", info)
+}
+
+// UpdateKeyRequest 更新虚拟 Key 请求（仅更新传入的字段）
+type UpdateKeyRequest struct {
+	Key       *string   `json:"key,omitempty"`
+	Name      *string   `json:"name,omitempty"`
+	Owner     *string   `json:"owner,omitempty"`
+	Models    *[]string `json:"models,omitempty"`
+	Endpoints *[]string `json:"endpoints,omitempty"`
+	ExpiresAt *string   `json:"expires_at,omitempty"`
+	Enabled   *bool     `json:"enabled,omitempty"`
+	RPM       *int      `json:"rpm,omitempty"`
+	TPM       *int      `json:"tpm,omitempty"`
+
+	DailyBudget   *float64 `json:"daily_budget,omitempty"`
+	MonthlyBudget *float64 `json:"monthly_budget,omitempty"`
+}
+
+// UpdateKey 更新虚拟 Key
+func (c *AdminController) UpdateKey(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	var req UpdateKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+
+	name := ctx.Param("name")
+	var updated apikey.VirtualKey
+	err := c.updateVirtualKeys(func(apiKeys []string, keys []apikey.VirtualKey) ([]apikey.VirtualKey, error) {
+		idx := findVirtualKey(keys, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("key %s not found", name)
+		}
+		vk := keys[idx]
+		if req.Key != nil {
+			vk.Key = *req.Key
+		}
+		if req.Name != nil {
+			vk.Name = *req.Name
+		}
+		if req.Owner != nil {
+			vk.Owner = *req.Owner
+		}
+		if req.Models != nil {
+			vk.Models = *req.Models
+		}
+		if req.Endpoints != nil {
+			vk.Endpoints = *req.Endpoints
+		}
+		if req.ExpiresAt != nil {
+			vk.ExpiresAt = *req.ExpiresAt
+		}
+		if req.RPM != nil {
+			vk.RPM = *req.RPM
+		}
+		if req.TPM != nil {
+			vk.TPM = *req.TPM
+		}
+		if req.DailyBudget != nil {
+			vk.DailyBudget = *req.DailyBudget
+		}
+		if req.MonthlyBudget != nil {
+			vk.MonthlyBudget = *req.MonthlyBudget
+		}
+		if req.Enabled != nil {
+			vk.Enabled = req.Enabled
+			// 默认即为启用，不写入配置
+			if *req.Enabled {
+				vk.Enabled = nil
+			}
+		}
+
+		others := append(append([]apikey.VirtualKey(nil), keys[:idx]...), keys[idx+1:]...)
+		if err := checkVirtualKey(&vk, apiKeys, others); err != nil {
+			return nil, err
+		}
+		keys[idx] = vk
+		updated = vk
+		return keys, nil
+	})
+	if err != nil {
+		response_helper.Fail(ctx, "更新失败: "+err.Error())
+		return
+	}
+
+	log_helper.Info(fmt.Sprintf("虚拟 Key %s 已更新", name))
+	response_helper.Success(ctx, "更新成功", newKeyInfo(updated))
+}
+
+// DeleteKey 删除虚拟 Key
+func (c *AdminController) DeleteKey(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	name := ctx.Param("name")
+	err := c.updateVirtualKeys(func(apiKeys []string, keys []apikey.VirtualKey) ([]apikey.VirtualKey, error) {
+		idx := findVirtualKey(keys, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("key %s not found", name)
+		}
+		return append(keys[:idx], keys[idx+1:]...), nil
+	})
+	if err != nil {
+		response_helper.Fail(ctx, "删除失败: "+err.Error())
+		return
+	}
+
+	log_helper.Info(fmt.Sprintf("虚拟 Key %s 已删除", name))
+	response_helper.Success(ctx, "删除成功")
+}
+
+// updateVirtualKeys 修改配置文件中的虚拟 Key 列表，写回后立即生效
+func (c *AdminController) updateVirtualKeys(update func(apiKeys []string, keys []apikey.VirtualKey) ([]apikey.VirtualKey, error)) error {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	config, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	keys, err := update(config.APIKeys, config.VirtualKeys)
+	if err != nil {
+		return err
+	}
+
+	if err := c.editConfig(func(mapNode *yaml.Node) error {
+		return setConfigNode(mapNode, "virtual_keys", keys)
+	}); err != nil {
+		return err
+	}
+
+	c.keyStore.Update(config.APIKeys, keys)
+	return nil
+}
+
+// findVirtualKey 按名称查找虚拟 Key，未找到返回 -1
+func findVirtualKey(keys []apikey.VirtualKey, name string) int {
+	for i, vk := range keys {
+		if vk.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkVirtualKey 校验虚拟 Key 配置，且名称和密钥不与其他 Key 重复
+func checkVirtualKey(vk *apikey.VirtualKey, apiKeys []string, others []apikey.VirtualKey) error {
+	if err := vk.Validate(); err != nil {
+		return err
+	}
+	for _, key := range apiKeys {
+		if key == vk.Key {
+			return fmt.Errorf("key already exists in api_keys")
+		}
+	}
+	for _, other := range others {
+		if other.Name == vk.Name {
+			return fmt.Errorf("name %s already exists", vk.Name)
+		}
+		if other.Key == vk.Key {
+			return fmt.Errorf("key already used by %s", other.Name)
+		}
+	}
+	return nil
+}
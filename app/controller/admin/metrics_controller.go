@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"gin_base/app/helper/response_helper"
+	"gin_base/app/service/upstream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics 查询各供应商上游模型的时序指标
+// 参数：window（5m / 1h / 24h，默认 1h）；5m 和 1h 每分钟一个点，24h 每 20 分钟一个点
+func (c *AdminController) GetMetrics(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	manager := c.GetManager()
+	if manager == nil {
+		response_helper.Fail(ctx, "服务未初始化")
+		return
+	}
+
+	window, step, err := upstream.ParseMetricsWindow(ctx.Query("window"))
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+
+	response_helper.Success(ctx, "获取成功", gin.H{
+		"window":       ctx.DefaultQuery("window", "1h"),
+		"step_seconds": int(step.Seconds()),
+		"items":        manager.GetMetrics(window, step),
+	})
+}
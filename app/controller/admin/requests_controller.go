@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_base/app/helper/db_helper"
+	"gin_base/app/helper/response_helper"
+	"gin_base/app/service/requestlog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetRequests 分页查询代理请求记录（按时间倒序）
+// 参数：start / end（同用量查询的时间格式），request_id / key / alias / provider（过滤），
+// status（状态码或 2xx、4xx、5xx），page / page_size（默认第 1 页、每页 10 条）
+func (c *AdminController) GetRequests(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	start, err := parseUsageTime(ctx.Query("start"), false)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+	end, err := parseUsageTime(ctx.Query("end"), true)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+
+	db, err := c.requests.Query(requestlog.Filter{
+		Start:     start,
+		End:       end,
+		RequestID: ctx.Query("request_id"),
+		KeyName:   ctx.Query("key"),
+		Alias:     ctx.Query("alias"),
+		Provider:  ctx.Query("provider"),
+		Status:    ctx.Query("status"),
+	})
+	if err != nil {
+		response_helper.Fail(ctx, "查询请求记录失败: "+err.Error())
+		return
+	}
+
+	response_helper.Success(ctx, "获取成功", db_helper.AutoPage(ctx, db))
+}
+
+// GetRequestCapture 获取请求记录采集的请求体/响应体（各次尝试按顺序排列）
+func (c *AdminController) GetRequestCapture(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: invalid id")
+		return
+	}
+	capture, err := c.requests.GetCapture(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response_helper.Fail(ctx, "该请求未采集请求体")
+		return
+	}
+	if err != nil {
+		response_helper.Fail(ctx, "查询请求体失败: "+err.Error())
+		return
+	}
+
+	var attempts []requestlog.CaptureAttempt
+	json.Unmarshal([]byte(capture.Attempts), &attempts)
+	response_helper.Success(ctx, "获取成功", gin.H{
+		"request_body":  capture.RequestBody,
+		"attempts":      attempts,
+		"response_body": capture.ResponseBody,
+	})
+}
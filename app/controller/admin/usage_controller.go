@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"fmt"
+	"gin_base/app/helper/response_helper"
+	"gin_base/app/service/usagestat"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUsage 查询 token 用量
+// 参数：start / end（RFC3339、2006-01-02 15:04:05 或 2006-01-02，默认今天 0 点到现在），
+// key / alias / provider / model（过滤），group_by（逗号分隔：key、alias、provider、model、day、hour，默认 key）
+func (c *AdminController) GetUsage(ctx *gin.Context) {
+	apiKey := ctx.GetHeader("X-API-Key")
+	if !c.ValidateAPIKey(apiKey) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	now := time.Now()
+	start, err := parseUsageTime(ctx.Query("start"), false)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+	if start.IsZero() {
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	end, err := parseUsageTime(ctx.Query("end"), true)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+	if end.IsZero() {
+		end = now
+	}
+
+	groupBy := []string{usagestat.GroupByKey}
+	if v := ctx.Query("group_by"); v != "" {
+		groupBy = nil
+		for _, g := range strings.Split(v, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groupBy = append(groupBy, g)
+			}
+		}
+	}
+	if err := usagestat.ValidateGroupBy(groupBy); err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+
+	items, total, err := c.usage.Query(usagestat.Query{
+		Start: start,
+		End:   end,
+		Filter: usagestat.Dimension{
+			KeyName:       ctx.Query("key"),
+			Alias:         ctx.Query("alias"),
+			Provider:      ctx.Query("provider"),
+			UpstreamModel: ctx.Query("model"),
+		},
+		GroupBy: groupBy,
+	})
+	if err != nil {
+		response_helper.Fail(ctx, "查询用量失败: "+err.Error())
+		return
+	}
+
+	response_helper.Success(ctx, "获取成功", gin.H{
+		"start":    start.Format(time.RFC3339),
+		"end":      end.Format(time.RFC3339),
+		"group_by": groupBy,
+		"items":    items,
+		"total":    total,
+	})
+}
+
+// parseUsageTime 解析查询时间，为空返回零值；isEnd 时日期格式表示包含当天（取次日 0 点）
+func parseUsageTime(value string, isEnd bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if isEnd {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339, 2006-01-02 15:04:05 or 2006-01-02", value)
+}
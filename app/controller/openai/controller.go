@@ -8,12 +8,22 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"gin_base/app/appconfig"
 	"gin_base/app/helper/log_helper"
 	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/metrics"
+	"gin_base/app/service/requestlog"
+	"gin_base/app/service/respcache"
+	"gin_base/app/service/tracing"
 	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,17 +40,26 @@ func generateRequestID() string {
 type ConfigGetter interface {
 	GetManager() *upstream.Manager
 	GetMaxRetries() int
+	GetMidStreamFailover() bool
+	GetBodyCapture() *appconfig.BodyCaptureConfig
+	ValidateAPIKey(apiKey string) bool
 }
 
 // Controller OpenAI 兼容接口控制器
 type Controller struct {
-	configGetter ConfigGetter // 动态获取配置
+	configGetter ConfigGetter         // 动态获取配置
+	usage        *usagestat.Recorder  // token 用量统计
+	requests     *requestlog.Recorder // 请求记录
+	cache        *respcache.Cache     // 响应缓存
 }
 
 // NewController 创建控制器
-func NewController(configGetter ConfigGetter) *Controller {
+func NewController(configGetter ConfigGetter, usage *usagestat.Recorder, requests *requestlog.Recorder, cache *respcache.Cache) *Controller {
 	return &Controller{
 		configGetter: configGetter,
+		usage:        usage,
+		requests:     requests,
+		cache:        cache,
 	}
 }
 
@@ -54,6 +73,16 @@ func (c *Controller) getMaxRetries() int {
 	return c.configGetter.GetMaxRetries()
 }
 
+// getMidStreamFailover 获取是否启用流式中途故障转移续写
+func (c *Controller) getMidStreamFailover() bool {
+	return c.configGetter.GetMidStreamFailover()
+}
+
+// getBodyCapture 获取请求体/响应体采集配置
+func (c *Controller) getBodyCapture() *appconfig.BodyCaptureConfig {
+	return c.configGetter.GetBodyCapture()
+}
+
 // ChatCompletions 处理 /v1/chat/completions 请求
 func (c *Controller) ChatCompletions(ctx *gin.Context) {
 	// 读取原始请求体
@@ -79,21 +108,24 @@ func (c *Controller) ChatCompletions(ctx *gin.Context) {
 		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "messages is required")
 		return
 	}
+	if !c.checkModelAccess(ctx, req.Model) {
+		return
+	}
+
+	// 命中响应缓存时直接返回
+	if c.serveFromCache(ctx, &req, bodyBytes) {
+		return
+	}
 
 	// 使用负载均衡选择首选 ProviderModel，然后获取完整列表用于故障转移
-	providerModels := c.getLoadBalancedProviderModels(req.Model)
+	providerModels := c.getLoadBalancedProviderModels(req.Model, upstream.ChatCompletionsPath)
 	if len(providerModels) == 0 {
-		c.sendError(ctx, http.StatusServiceUnavailable, "service_unavailable", "no provider available for model: "+req.Model)
+		c.sendNoProviderError(ctx, req.Model, http.StatusServiceUnavailable, "service_unavailable")
 		return
 	}
 
 	// 复制请求头（除了敏感头）
-	headers := make(map[string]string)
-	for k, v := range ctx.Request.Header {
-		if len(v) > 0 && k != "Authorization" && k != "Host" && k != "Content-Length" {
-			headers[k] = v[0]
-		}
-	}
+	headers := copyRequestHeaders(ctx)
 
 	// 保存原始模型名（别名）
 	aliasModel := req.Model
@@ -102,24 +134,126 @@ func (c *Controller) ChatCompletions(ctx *gin.Context) {
 	reqID := generateRequestID()
 
 	if req.Stream {
-		c.handleStreamRequest(ctx, providerModels, bodyBytes, headers, aliasModel, reqID)
+		c.handleStreamRequest(ctx, providerModels, upstream.ChatCompletionsPath, bodyBytes, headers, aliasModel, reqID)
 	} else {
-		c.handleNonStreamRequest(ctx, providerModels, bodyBytes, headers, aliasModel, reqID)
+		c.handleNonStreamRequest(ctx, providerModels, upstream.ChatCompletionsPath, bodyBytes, headers, aliasModel, reqID)
 	}
 }
 
-// getLoadBalancedProviderModels 获取负载均衡后的 ProviderModel 列表
+// Responses 处理 /v1/responses 请求
+// 原生支持 Responses 的上游直接透传，仅支持 chat 的上游由 Provider 负责双向转换
+func (c *Controller) Responses(ctx *gin.Context) {
+	// 读取原始请求体
+	bodyBytes, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+		return
+	}
+
+	// 解析基本字段用于路由和验证
+	var req model.ResponsesRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// 验证必要字段
+	if req.Model == "" {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "model is required")
+		return
+	}
+	if len(req.Input) == 0 {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "input is required")
+		return
+	}
+	if !c.checkModelAccess(ctx, req.Model) {
+		return
+	}
+
+	// 使用负载均衡选择首选 ProviderModel，然后获取完整列表用于故障转移
+	providerModels := c.getLoadBalancedProviderModels(req.Model, upstream.ResponsesPath)
+	if len(providerModels) == 0 {
+		c.sendNoProviderError(ctx, req.Model, http.StatusServiceUnavailable, "service_unavailable")
+		return
+	}
+
+	headers := copyRequestHeaders(ctx)
+	reqID := generateRequestID()
+
+	if req.Stream {
+		c.handleStreamRequest(ctx, providerModels, upstream.ResponsesPath, bodyBytes, headers, req.Model, reqID)
+	} else {
+		c.handleNonStreamRequest(ctx, providerModels, upstream.ResponsesPath, bodyBytes, headers, req.Model, reqID)
+	}
+}
+
+// Embeddings 处理 /v1/embeddings 请求
+func (c *Controller) Embeddings(ctx *gin.Context) {
+	// 读取原始请求体
+	bodyBytes, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+		return
+	}
+
+	// 解析基本字段用于路由和验证
+	var req model.EmbeddingRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// 验证必要字段
+	if req.Model == "" {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "model is required")
+		return
+	}
+	if req.Input == nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "input is required")
+		return
+	}
+	if !c.checkModelAccess(ctx, req.Model) {
+		return
+	}
+
+	// 使用负载均衡选择首选 ProviderModel，然后获取完整列表用于故障转移
+	providerModels := c.getLoadBalancedProviderModels(req.Model, upstream.EmbeddingsPath)
+	if len(providerModels) == 0 {
+		c.sendNoProviderError(ctx, req.Model, http.StatusServiceUnavailable, "service_unavailable")
+		return
+	}
+
+	c.handleNonStreamRequest(ctx, providerModels, upstream.EmbeddingsPath, bodyBytes, copyRequestHeaders(ctx), req.Model, generateRequestID())
+}
+
+// copyRequestHeaders 复制请求头（除了敏感头）
+func copyRequestHeaders(ctx *gin.Context) map[string]string {
+	headers := make(map[string]string)
+	for k, v := range ctx.Request.Header {
+		if len(v) > 0 && k != "Authorization" && k != "X-Api-Key" && k != "Host" && k != "Content-Length" {
+			headers[k] = v[0]
+		}
+	}
+	return headers
+}
+
+// endpointName 获取上游路径对应的接口简称（用于日志）
+func endpointName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// getLoadBalancedProviderModels 获取负载均衡后的 ProviderModel 列表（只包含能处理该接口的映射）
 // 首选的 provider 会被放在第一位，其余按优先级/权重顺序排列用于故障转移
-func (c *Controller) getLoadBalancedProviderModels(alias string) []upstream.ProviderModel {
+func (c *Controller) getLoadBalancedProviderModels(alias, path string) []upstream.ProviderModel {
 	manager := c.getManager()
 	// 获取按优先级/权重排序的完整列表
-	allModels := manager.GetProviderModels(alias)
+	allModels := manager.GetProviderModels(alias, path)
 	if len(allModels) <= 1 {
 		return allModels
 	}
 
-	// 使用负载均衡选择首选 ProviderModel
-	selected := manager.SelectProviderModel(alias)
+	// 使用负载均衡从同一份候选中选择首选 ProviderModel（半开放行只判定一次）
+	selected := manager.SelectProviderModel(alias, allModels)
 	if selected == nil {
 		return allModels
 	}
@@ -184,10 +318,14 @@ func processRequestBody(body []byte, pm upstream.ProviderModel, aliasModel strin
 	return newBody
 }
 
-// handleNonStreamRequest 处理非流式请求
-func (c *Controller) handleNonStreamRequest(ctx *gin.Context, providerModels []upstream.ProviderModel, body []byte, headers map[string]string, aliasModel string, reqID string) {
+// handleNonStreamRequest 处理非流式请求（path 为上游接口路径，如 /v1/chat/completions、/v1/embeddings）
+func (c *Controller) handleNonStreamRequest(ctx *gin.Context, providerModels []upstream.ProviderModel, path string, body []byte, headers map[string]string, aliasModel string, reqID string) {
 	var lastErr error
 	var triedProviders []string
+	endpoint := endpointName(path)
+	tracing.SpanFromContext(ctx.Request.Context()).SetAttributes("request.id", reqID, "model.alias", aliasModel, "stream", false)
+	reqLog := c.startRequestLog(ctx, reqID, aliasModel, false, body)
+	defer func() { c.finishRequestLog(ctx, reqLog, lastErr) }()
 
 	// 限制最大尝试次数
 	maxAttempts := c.getMaxRetries()
@@ -198,6 +336,12 @@ func (c *Controller) handleNonStreamRequest(ctx *gin.Context, providerModels []u
 	for i := 0; i < maxAttempts; i++ {
 		pm := providerModels[i]
 		providerName := fmt.Sprintf("%s(%s)", pm.Provider.Config.Name, pm.Mapping.Upstream)
+
+		// 跳过限流冷却中的候选（可能由并发请求刚触发）
+		if c.getManager().IsCoolingDown(pm.Provider, pm.Mapping.Upstream) {
+			log_helper.Info(fmt.Sprintf("[%s] %s #%d %s %s skipped: rate limit cool-down", reqID, aliasModel, i+1, endpoint, providerName))
+			continue
+		}
 		triedProviders = append(triedProviders, providerName)
 
 		// 处理请求体：替换模型名 + 过滤参数
@@ -205,56 +349,105 @@ func (c *Controller) handleNonStreamRequest(ctx *gin.Context, providerModels []u
 
 		// 创建带超时的上下文
 		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), time.Duration(pm.Provider.Config.Timeout)*time.Second)
-		resp, err := pm.Provider.ProxyRequest(reqCtx, "POST", "/v1/chat/completions", reqBody, headers)
+		attempt := c.getManager().StartAttempt(reqCtx, pm.Provider, aliasModel, pm.Mapping.Upstream)
+		reqLog.addAttempt(attempt, pm, reqBody)
+		resp, err := pm.Provider.ProxyRequest(attempt.Context(), "POST", path, reqBody, headers)
 
 		if err != nil {
 			cancel()
+			attempt.SetError(err)
+			attempt.Finish(false)
 			lastErr = err
-			log_helper.Warning(fmt.Sprintf("[%s] %s #%d completions %s failed: %v", reqID, aliasModel, i+1, providerName, err))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			log_helper.Warning(fmt.Sprintf("[%s] %s #%d %s %s failed: %v", reqID, aliasModel, i+1, endpoint, providerName, err))
+			if !c.recordAttemptError(pm, aliasModel, classifyError(err)) {
+				break
+			}
 			continue
 		}
 
+		attempt.FirstToken()
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		cancel()
+		reqLog.attemptResponse(respBody)
+		attempt.SetResponse(resp.StatusCode, int64(len(respBody)))
+		attempt.SetError(err)
+		attempt.Finish(err == nil && resp.StatusCode == http.StatusOK)
 
 		if err != nil {
 			lastErr = err
-			log_helper.Warning(fmt.Sprintf("[%s] %s #%d completions %s failed: %v", reqID, aliasModel, i+1, providerName, err))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			log_helper.Warning(fmt.Sprintf("[%s] %s #%d %s %s failed: %v", reqID, aliasModel, i+1, endpoint, providerName, err))
+			if !c.recordAttemptError(pm, aliasModel, classifyError(err)) {
+				break
+			}
 			continue
 		}
 
-		// 检查HTTP状态码 - 非200都视为失败
+		// 限流：按重试策略记录，并让该模型进入冷却
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retry := c.recordAttemptError(pm, aliasModel, upstream.StatusError(resp.StatusCode))
+			cooldown := c.getManager().RecordRateLimited(pm.Provider, pm.Mapping.Upstream, resp.Header)
+			lastErr = fmt.Errorf("upstream rate limited, cooling down for %s", cooldown.Round(time.Second))
+			log_helper.Warning(fmt.Sprintf("[%s] %s #%d %s %s failed: status 429", reqID, aliasModel, i+1, endpoint, providerName))
+			if !retry {
+				c.passThroughError(ctx, resp.StatusCode, respBody)
+				return
+			}
+			continue
+		}
+
+		// 检查HTTP状态码 - 非200按重试策略决定故障转移或将上游错误返回给客户端
 		if resp.StatusCode != http.StatusOK {
 			lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
-			log_helper.Warning(fmt.Sprintf("[%s] %s #%d completions %s failed: status %d", reqID, aliasModel, i+1, providerName, resp.StatusCode))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			log_helper.Warning(fmt.Sprintf("[%s] %s #%d %s %s failed: status %d", reqID, aliasModel, i+1, endpoint, providerName, resp.StatusCode))
+			if !c.recordAttemptError(pm, aliasModel, upstream.StatusError(resp.StatusCode)) {
+				log_helper.Info(fmt.Sprintf("[%s] %s status %d not retryable, returned to client", reqID, aliasModel, resp.StatusCode))
+				c.passThroughError(ctx, resp.StatusCode, respBody)
+				return
+			}
 			continue
 		}
 
 		// 成功响应 - 替换响应中的模型名为别名
 		respBody = replaceModelInResponse(respBody, pm.Mapping.Upstream, aliasModel)
 		c.getManager().RecordSuccess(pm.Provider, aliasModel, pm.Mapping.Upstream)
+		c.recordUsage(ctx, pm, aliasModel, parseUsage(respBody))
+		c.storeResponse(ctx, respBody)
+		reqLog.firstOutput(attempt)
+		reqLog.success = true
 		attemptInfo := fmt.Sprintf("#%d", i+1)
 		if i > 0 {
 			attemptInfo += "(retry)"
 		}
-		log_helper.Info(fmt.Sprintf("[%s] %s %s completions -> %s/%s", reqID, aliasModel, attemptInfo, pm.Provider.Config.Name, pm.Mapping.Upstream))
+		log_helper.Info(fmt.Sprintf("[%s] %s %s %s -> %s/%s", reqID, aliasModel, attemptInfo, endpoint, pm.Provider.Config.Name, pm.Mapping.Upstream))
 		ctx.Data(resp.StatusCode, "application/json", respBody)
 		return
 	}
 
 	// 所有供应商都失败
 	log_helper.Error(fmt.Sprintf("[%s] %s all providers failed: %v, tried: %v", reqID, aliasModel, lastErr, triedProviders))
-	c.sendError(ctx, http.StatusBadGateway, "upstream_error", fmt.Sprintf("all providers failed: %v", lastErr))
+	c.sendAllFailedError(ctx, aliasModel, lastErr)
 }
 
-// handleStreamRequest 处理流式请求
-func (c *Controller) handleStreamRequest(ctx *gin.Context, providerModels []upstream.ProviderModel, body []byte, headers map[string]string, aliasModel string, reqID string) {
+// handleStreamRequest 处理流式请求（path 为上游接口路径，如 /v1/chat/completions、/v1/responses）
+func (c *Controller) handleStreamRequest(ctx *gin.Context, providerModels []upstream.ProviderModel, path string, body []byte, headers map[string]string, aliasModel string, reqID string) {
 	var lastErr error
 	var triedProviders []string
+	tracing.SpanFromContext(ctx.Request.Context()).SetAttributes("request.id", reqID, "model.alias", aliasModel, "stream", true)
+	reqLog := c.startRequestLog(ctx, reqID, aliasModel, true, body)
+	defer func() { c.finishRequestLog(ctx, reqLog, lastErr) }()
+
+	// 流式中途故障转移：已开始输出后上游中断时，以已输出内容作为 assistant 前缀在下一个供应商续写（仅 chat 接口）
+	midStreamFailover := c.getMidStreamFailover() && path == upstream.ChatCompletionsPath
+
+	// chat 流默认不返回 usage：要求上游返回以便统计，客户端未要求时从响应中去掉
+	stripUsage := false
+	if path == upstream.ChatCompletionsPath {
+		body, stripUsage = forceIncludeUsage(body)
+	}
+	originalBody := body
+	streamed := false // 是否已向客户端输出过数据（之后的失败只能通过流内错误事件告知客户端）
+	var emitted strings.Builder
 
 	// 限制最大尝试次数
 	maxAttempts := c.getMaxRetries()
@@ -265,25 +458,70 @@ func (c *Controller) handleStreamRequest(ctx *gin.Context, providerModels []upst
 	for i := 0; i < maxAttempts; i++ {
 		pm := providerModels[i]
 		providerName := fmt.Sprintf("%s(%s)", pm.Provider.Config.Name, pm.Mapping.Upstream)
+
+		// 跳过限流冷却中的候选（可能由并发请求刚触发）
+		if c.getManager().IsCoolingDown(pm.Provider, pm.Mapping.Upstream) {
+			log_helper.Info(fmt.Sprintf("[%s] %s #%d stream %s skipped: rate limit cool-down", reqID, aliasModel, i+1, providerName))
+			continue
+		}
 		triedProviders = append(triedProviders, providerName)
 
 		// 处理请求体：替换模型名 + 过滤参数
 		reqBody := processRequestBody(body, pm, aliasModel)
 
-		resp, err := pm.Provider.ProxyStreamRequest(ctx.Request.Context(), "/v1/chat/completions", reqBody, headers)
+		attempt := c.getManager().StartAttempt(ctx.Request.Context(), pm.Provider, aliasModel, pm.Mapping.Upstream)
+		reqLog.addAttempt(attempt, pm, reqBody)
+		resp, err := pm.Provider.ProxyStreamRequest(attempt.Context(), path, reqBody, headers)
 		if err != nil {
+			attempt.SetError(err)
+			attempt.Finish(false)
 			lastErr = err
 			log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s failed: %v", reqID, aliasModel, i+1, providerName, err))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			if !c.recordAttemptError(pm, aliasModel, classifyError(err)) {
+				break
+			}
 			continue
 		}
 
-		// 检查HTTP状态码 - 非200都视为失败
+		// 限流：按重试策略记录，并让该模型进入冷却
+		if resp.StatusCode == http.StatusTooManyRequests {
+			errBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			reqLog.attemptResponse(errBody)
+			attempt.SetResponse(resp.StatusCode, int64(len(errBody)))
+			attempt.Finish(false)
+			retry := c.recordAttemptError(pm, aliasModel, upstream.StatusError(resp.StatusCode))
+			cooldown := c.getManager().RecordRateLimited(pm.Provider, pm.Mapping.Upstream, resp.Header)
+			lastErr = fmt.Errorf("upstream rate limited, cooling down for %s", cooldown.Round(time.Second))
+			log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s failed: status 429", reqID, aliasModel, i+1, providerName))
+			if !retry {
+				// 已开始输出时不能再写入错误响应体，只能以流内错误事件结束
+				if streamed {
+					break
+				}
+				c.passThroughError(ctx, resp.StatusCode, errBody)
+				return
+			}
+			continue
+		}
+
+		// 检查HTTP状态码 - 非200按重试策略决定故障转移或将上游错误返回给客户端
 		if resp.StatusCode != http.StatusOK {
+			errBody, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			reqLog.attemptResponse(errBody)
+			attempt.SetResponse(resp.StatusCode, int64(len(errBody)))
+			attempt.Finish(false)
 			lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
 			log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s failed: status %d", reqID, aliasModel, i+1, providerName, resp.StatusCode))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			if !c.recordAttemptError(pm, aliasModel, upstream.StatusError(resp.StatusCode)) {
+				log_helper.Info(fmt.Sprintf("[%s] %s status %d not retryable, returned to client", reqID, aliasModel, resp.StatusCode))
+				if streamed {
+					break
+				}
+				c.passThroughError(ctx, resp.StatusCode, errBody)
+				return
+			}
 			continue
 		}
 
@@ -330,35 +568,91 @@ func (c *Controller) handleStreamRequest(ctx *gin.Context, providerModels []upst
 
 		if streamErr != nil {
 			resp.Body.Close()
+			reqLog.attemptResponse(bytes.Join(bufferedLines, nil))
+			attempt.SetError(streamErr)
+			attempt.Finish(false)
 			lastErr = streamErr
 			log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s failed: %v", reqID, aliasModel, i+1, providerName, lastErr))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			if !c.recordAttemptError(pm, aliasModel, classifyError(streamErr)) {
+				log_helper.Info(fmt.Sprintf("[%s] %s stream error not retryable, returned to client", reqID, aliasModel))
+				if streamed {
+					break
+				}
+				passThroughStream(ctx, bufferedLines)
+				return
+			}
 			continue
 		}
 
 		// 检测空流（HTTP 200但没有任何实际内容）
 		if hasDone && !hasValidContent {
 			resp.Body.Close()
+			reqLog.attemptResponse(bytes.Join(bufferedLines, nil))
 			lastErr = fmt.Errorf("empty stream: no content generated")
+			attempt.SetError(lastErr)
+			attempt.Finish(false)
 			log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s failed: %v", reqID, aliasModel, i+1, providerName, lastErr))
-			c.getManager().RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			if !c.recordAttemptError(pm, aliasModel, upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: "empty_stream"}) {
+				if streamed {
+					break
+				}
+				passThroughStream(ctx, bufferedLines)
+				return
+			}
 			continue
 		}
 
-		// 成功，开始流式传输
-		c.getManager().RecordSuccess(pm.Provider, aliasModel, pm.Mapping.Upstream)
+		// 预检通过，开始流式传输（首个有效数据块已到达）
+		attempt.FirstToken()
+		reqLog.firstOutput(attempt)
 		attemptInfo := fmt.Sprintf("#%d", i+1)
 		if i > 0 {
 			attemptInfo += "(retry)"
 		}
+		if streamed {
+			attemptInfo += "(resume)"
+		}
 		log_helper.Info(fmt.Sprintf("[%s] %s %s stream -> %s/%s", reqID, aliasModel, attemptInfo, pm.Provider.Config.Name, pm.Mapping.Upstream))
-		c.streamResponseWithBufferedLines(ctx, resp, reader, bufferedLines, pm.Mapping.Upstream, aliasModel)
+		result := c.streamResponseWithBufferedLines(ctx, resp, reader, bufferedLines, pm.Mapping.Upstream, aliasModel, stripUsage, streamed)
+		attempt.SetResponse(resp.StatusCode, result.bytes)
+		attempt.SetError(result.err)
+		attempt.Finish(result.err == nil)
+		c.recordUsage(ctx, pm, aliasModel, result.usage)
+		streamed = true
+
+		// 流正常结束（或客户端主动断开）才计为成功
+		if result.err == nil || result.clientGone {
+			c.getManager().RecordSuccess(pm.Provider, aliasModel, pm.Mapping.Upstream)
+			reqLog.success = true
+			if emitted.Len() == 0 {
+				c.storeStreamResponse(ctx, reqID, aliasModel, result)
+			}
+			return
+		}
+
+		// 流中途中断：按重试策略计为失败（截断归为网络错误）
+		lastErr = result.err
+		log_helper.Warning(fmt.Sprintf("[%s] %s #%d stream %s broken after output: %v", reqID, aliasModel, i+1, providerName, lastErr))
+		retry := c.recordAttemptError(pm, aliasModel, classifyError(result.err))
+
+		// 已输出工具调用时无法续写
+		if !midStreamFailover || result.hasToolCalls || !retry {
+			break
+		}
+		emitted.WriteString(result.content)
+		body = appendAssistantPrefix(originalBody, emitted.String())
+	}
+
+	// 已开始输出：只能以流内错误事件结束
+	if streamed {
+		log_helper.Error(fmt.Sprintf("[%s] %s stream broken: %v, tried: %v", reqID, aliasModel, lastErr, triedProviders))
+		writeStreamError(ctx, path, lastErr.Error())
 		return
 	}
 
 	// 所有供应商都失败
 	log_helper.Error(fmt.Sprintf("[%s] %s stream all providers failed: %v, tried: %v", reqID, aliasModel, lastErr, triedProviders))
-	c.sendError(ctx, http.StatusBadGateway, "upstream_error", fmt.Sprintf("all providers failed: %v", lastErr))
+	c.sendAllFailedError(ctx, aliasModel, lastErr)
 }
 
 // replaceModelInResponse 替换响应中的模型名为别名
@@ -377,44 +671,6 @@ func replaceModelInStreamLine(line []byte, upstreamModel, aliasModel string) []b
 	return []byte(strings.ReplaceAll(string(line), `"model":"`+upstreamModel+`"`, `"model":"`+aliasModel+`"`))
 }
 
-// streamResponse 流式传输响应
-func (c *Controller) streamResponse(ctx *gin.Context, resp *http.Response, upstreamModel, aliasModel string) {
-	defer resp.Body.Close()
-
-	flusher, ok := ctx.Writer.(http.Flusher)
-	if !ok {
-		c.sendError(ctx, http.StatusInternalServerError, "server_error", "streaming not supported")
-		return
-	}
-
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Transfer-Encoding", "chunked")
-
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadBytes('\n')
-		if err != nil {
-			break
-		}
-
-		// 替换模型名
-		line = replaceModelInStreamLine(line, upstreamModel, aliasModel)
-
-		// 写入响应
-		if _, writeErr := ctx.Writer.Write(line); writeErr != nil {
-			break
-		}
-		flusher.Flush()
-
-		// 检查是否是结束标记
-		if strings.TrimSpace(string(line)) == "data: [DONE]" {
-			break
-		}
-	}
-}
-
 // Models 处理 /v1/models 请求
 func (c *Controller) Models(ctx *gin.Context) {
 	models := c.getManager().GetAllModels()
@@ -426,6 +682,10 @@ func (c *Controller) Models(ctx *gin.Context) {
 
 	created := model.GetCreatedTimestamp()
 	for _, m := range models {
+		// 只返回当前密钥允许使用的模型
+		if !apikey.AllowModel(ctx, m) {
+			continue
+		}
 		response.Data = append(response.Data, model.ModelInfo{
 			ID:      m,
 			Object:  "model",
@@ -443,7 +703,7 @@ func (c *Controller) GetModel(ctx *gin.Context) {
 	models := c.getManager().GetAllModels()
 
 	for _, m := range models {
-		if m == modelID {
+		if m == modelID && apikey.AllowModel(ctx, m) {
 			ctx.JSON(http.StatusOK, model.ModelInfo{
 				ID:      m,
 				Object:  "model",
@@ -457,6 +717,15 @@ func (c *Controller) GetModel(ctx *gin.Context) {
 	c.sendError(ctx, http.StatusNotFound, "not_found_error", fmt.Sprintf("model %s not found", modelID))
 }
 
+// checkModelAccess 检查当前密钥是否允许使用该模型别名，不允许时按模型不存在返回 404
+func (c *Controller) checkModelAccess(ctx *gin.Context, alias string) bool {
+	if apikey.AllowModel(ctx, alias) {
+		return true
+	}
+	c.sendError(ctx, http.StatusNotFound, "not_found_error", fmt.Sprintf("model %s not found", alias))
+	return false
+}
+
 // Stats 返回供应商状态统计
 func (c *Controller) Stats(ctx *gin.Context) {
 	stats := c.getManager().GetStats()
@@ -465,11 +734,26 @@ func (c *Controller) Stats(ctx *gin.Context) {
 	})
 }
 
-// detectStreamError 检测流内容中的错误（OpenAI标准错误格式）
+// metricsMu 串行化指标导出（导出前会重置并重新设置仪表盘）
+var metricsMu sync.Mutex
+
+// Metrics 以 Prometheus 文本格式导出指标
+func (c *Controller) Metrics(ctx *gin.Context) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if manager := c.getManager(); manager != nil {
+		manager.CollectMetrics()
+	}
+	ctx.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	metrics.WriteText(ctx.Writer)
+}
+
+// detectStreamError 检测流内容中的错误（OpenAI标准错误格式，以及 Responses 的 error / response.failed 事件）
 // 某些上游（如Gemini）返回HTTP 200但在流内容中包含错误
 func detectStreamError(line []byte) error {
 	// 快速检测：如果不包含 "error" 关键字，直接返回
-	if !bytes.Contains(line, []byte(`"error"`)) {
+	if !bytes.Contains(line, []byte(`"error"`)) && !bytes.Contains(line, []byte(`"response.failed"`)) {
 		return nil
 	}
 
@@ -495,37 +779,59 @@ func detectStreamError(line []byte) error {
 	if errField, exists := resp["error"]; exists && errField != nil {
 		switch e := errField.(type) {
 		case string:
-			return fmt.Errorf("stream error: %s", e)
+			return &streamError{message: e}
 		case map[string]interface{}:
 			msg := "upstream error"
 			if m, ok := e["message"].(string); ok && m != "" {
 				msg = m
 			}
-			code := e["code"]
-			return fmt.Errorf("stream error: %s (code: %v)", msg, code)
+			return &streamError{message: msg, code: e["code"], errType: e["type"]}
 		default:
-			return fmt.Errorf("stream error: %v", errField)
+			return &streamError{message: fmt.Sprintf("%v", errField)}
 		}
 	}
 
+	// Responses 流式事件：{"type":"error","code":...,"message":...} 或 response.failed
+	switch resp["type"] {
+	case "error":
+		msg := "upstream error"
+		if m, ok := resp["message"].(string); ok && m != "" {
+			msg = m
+		}
+		return &streamError{message: msg, code: resp["code"]}
+	case "response.failed":
+		msg := "response failed"
+		if r, ok := resp["response"].(map[string]interface{}); ok {
+			if e, ok := r["error"].(map[string]interface{}); ok {
+				if m, ok := e["message"].(string); ok && m != "" {
+					msg = m
+				}
+			}
+		}
+		return &streamError{message: msg}
+	}
+
 	return nil
 }
 
 // isValidStreamChunk 检测是否是有效的流数据chunk（包含实际内容）
 func isValidStreamChunk(line []byte) bool {
 	// 快速检测：检查是否包含实际内容的特征
-	// 有效chunk通常包含 "content":" 或 "role":"
-	return bytes.Contains(line, []byte(`"content":"`)) || bytes.Contains(line, []byte(`"role":"`))
+	// 有效chunk通常包含 "content":" 或 "role":"，Responses 文本增量事件包含 "delta":"
+	return bytes.Contains(line, []byte(`"content":"`)) || bytes.Contains(line, []byte(`"role":"`)) || bytes.Contains(line, []byte(`"delta":"`))
 }
 
 // streamResponseWithBufferedLines 流式传输响应（包含已缓冲的行）
-func (c *Controller) streamResponseWithBufferedLines(ctx *gin.Context, resp *http.Response, reader *bufio.Reader, bufferedLines [][]byte, upstreamModel, aliasModel string) {
+// 返回流是否正常结束：上游中途断开、出现流内错误或未收到结束标记均视为中断
+// 流内错误行不会转发给客户端，由调用方决定续写或写入错误事件；stripUsage 时不转发仅含 usage 的数据块
+// resume 表示续写前一个供应商中断的流，此时不转发新供应商只声明角色的首个数据块
+func (c *Controller) streamResponseWithBufferedLines(ctx *gin.Context, resp *http.Response, reader *bufio.Reader, bufferedLines [][]byte, upstreamModel, aliasModel string, stripUsage, resume bool) *streamResult {
 	defer resp.Body.Close()
 
 	flusher, ok := ctx.Writer.(http.Flusher)
 	if !ok {
 		c.sendError(ctx, http.StatusInternalServerError, "server_error", "streaming not supported")
-		return
+		return &streamResult{clientGone: true}
 	}
 
 	ctx.Header("Content-Type", "text/event-stream")
@@ -533,44 +839,93 @@ func (c *Controller) streamResponseWithBufferedLines(ctx *gin.Context, resp *htt
 	ctx.Header("Connection", "keep-alive")
 	ctx.Header("Transfer-Encoding", "chunked")
 
-	// 先写入已缓冲的行
-	for _, line := range bufferedLines {
+	tracker := &streamTracker{}
+	reqLog := requestLogFromContext(ctx)
+
+	// writeLine 检查并写入一行，返回是否继续
+	var result *streamResult
+	writeLine := func(line []byte) bool {
+		reqLog.attemptResponse(line)
+		if err := tracker.observe(line); err != nil {
+			result = tracker.result(nil)
+			result.err = err
+			return false
+		}
+		if stripUsage && isUsageOnlyChunk(line) {
+			return true
+		}
+		if resume && isRoleOnlyChunk(line) {
+			return true
+		}
 		line = replaceModelInStreamLine(line, upstreamModel, aliasModel)
 		if _, writeErr := ctx.Writer.Write(line); writeErr != nil {
-			return
+			result = tracker.result(nil)
+			result.clientGone = true
+			return false
 		}
 		flusher.Flush()
 
 		// 检查是否是结束标记
 		if strings.TrimSpace(string(line)) == "data: [DONE]" {
-			return
+			result = tracker.result(nil)
+			return false
+		}
+		return true
+	}
+
+	// 先写入已缓冲的行
+	for _, line := range bufferedLines {
+		if !writeLine(line) {
+			return result
 		}
 	}
 
 	// 继续读取剩余内容
 	for {
 		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && !writeLine(line) {
+			return result
+		}
 		if err != nil {
-			break
+			if ctx.Request.Context().Err() != nil {
+				// 客户端断开导致上游请求被取消
+				res := tracker.result(nil)
+				res.clientGone = true
+				return res
+			}
+			if err == io.EOF {
+				return tracker.result(nil)
+			}
+			return tracker.result(err)
 		}
+	}
+}
 
-		// 替换模型名
-		line = replaceModelInStreamLine(line, upstreamModel, aliasModel)
-
-		// 写入响应
-		if _, writeErr := ctx.Writer.Write(line); writeErr != nil {
-			break
-		}
-		flusher.Flush()
+// sendNoProviderError 没有可用候选时返回错误；所有候选均处于限流冷却中时返回 429 并带 Retry-After
+func (c *Controller) sendNoProviderError(ctx *gin.Context, alias string, statusCode int, errType string) {
+	if remaining := c.getManager().CooldownRemaining(alias); remaining > 0 {
+		retryAfter := int(math.Ceil(remaining.Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.sendError(ctx, http.StatusTooManyRequests, "rate_limit_exceeded", fmt.Sprintf("all providers for model %s are rate limited, retry after %ds", alias, retryAfter))
+		return
+	}
+	c.sendError(ctx, statusCode, errType, "no provider available for model: "+alias)
+}
 
-		// 检查是否是结束标记
-		if strings.TrimSpace(string(line)) == "data: [DONE]" {
-			break
-		}
+// sendAllFailedError 所有尝试均失败时返回错误；此时所有候选均处于限流冷却中则返回 429
+func (c *Controller) sendAllFailedError(ctx *gin.Context, alias string, lastErr error) {
+	if c.getManager().CooldownRemaining(alias) > 0 {
+		c.sendNoProviderError(ctx, alias, http.StatusBadGateway, "upstream_error")
+		return
 	}
+	c.sendError(ctx, http.StatusBadGateway, "upstream_error", fmt.Sprintf("all providers failed: %v", lastErr))
 }
 
-// sendError 发送 OpenAI 格式的错误响应
+// sendError 发送 OpenAI 格式的错误响应（/v1/messages 请求使用 Anthropic 格式）
 func (c *Controller) sendError(ctx *gin.Context, statusCode int, errType, message string) {
+	if ctx.GetBool(anthropicFormatKey) {
+		ctx.JSON(statusCode, upstream.NewAnthropicError(statusCode, message))
+		return
+	}
 	ctx.JSON(statusCode, model.NewOpenAIError(message, errType, nil))
 }
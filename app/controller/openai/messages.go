@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"encoding/json"
+	"gin_base/app/model"
+	"gin_base/app/service/upstream"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anthropicFormatKey 上下文标记：错误响应使用 Anthropic 格式
+const anthropicFormatKey = "anthropic_format"
+
+// Messages 处理 /v1/messages 请求（Anthropic Messages 接口）
+// Anthropic 上游直接透传，其他上游由 Provider 负责与 chat 格式双向转换
+func (c *Controller) Messages(ctx *gin.Context) {
+	ctx.Set(anthropicFormatKey, true)
+
+	// 读取原始请求体
+	bodyBytes, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+		return
+	}
+
+	// 解析基本字段用于路由和验证
+	var req model.AnthropicMessagesRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// 验证必要字段
+	if req.Model == "" {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "model: Field required")
+		return
+	}
+	if len(req.Messages) == 0 {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "messages: Field required")
+		return
+	}
+	if req.MaxTokens <= 0 {
+		c.sendError(ctx, http.StatusBadRequest, "invalid_request_error", "max_tokens: Field required")
+		return
+	}
+	if !c.checkModelAccess(ctx, req.Model) {
+		return
+	}
+
+	// 使用负载均衡选择首选 ProviderModel，然后获取完整列表用于故障转移
+	providerModels := c.getLoadBalancedProviderModels(req.Model, upstream.MessagesPath)
+	if len(providerModels) == 0 {
+		c.sendNoProviderError(ctx, req.Model, http.StatusNotFound, "not_found_error")
+		return
+	}
+
+	headers := copyRequestHeaders(ctx)
+	reqID := generateRequestID()
+
+	if req.Stream {
+		c.handleStreamRequest(ctx, providerModels, upstream.MessagesPath, bodyBytes, headers, req.Model, reqID)
+	} else {
+		c.handleNonStreamRequest(ctx, providerModels, upstream.MessagesPath, bodyBytes, headers, req.Model, reqID)
+	}
+}
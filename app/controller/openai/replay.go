@@ -0,0 +1,211 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_base/app/helper/response_helper"
+	"gin_base/app/model"
+	"gin_base/app/service/upstream"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxReplayResponseBytes 重放结果中每个响应体最多返回的字节数
+const maxReplayResponseBytes = 64 * 1024
+
+// replayRequest 重放目标：指定供应商（和上游模型），或该别名的全部候选
+type replayRequest struct {
+	Provider      string `json:"provider"`
+	UpstreamModel string `json:"upstream_model"`
+	All           bool   `json:"all"`
+}
+
+// replayResult 单个目标的重放结果
+type replayResult struct {
+	Provider      string       `json:"provider"`
+	UpstreamModel string       `json:"upstream_model"`
+	Status        int          `json:"status"`
+	LatencyMs     int64        `json:"latency_ms"`
+	TtftMs        int64        `json:"ttft_ms"`
+	Usage         *model.Usage `json:"usage,omitempty"`
+	Cost          float64      `json:"cost"`
+	ResponseBody  string       `json:"response_body"`
+	Error         string       `json:"error,omitempty"`
+}
+
+// Replay 将已采集请求体的请求重放到指定供应商/上游模型或该别名的全部候选（绕过路由，不计入健康状态、统计和用量）
+// 各目标并发请求，结果按目标顺序返回
+func (c *Controller) Replay(ctx *gin.Context) {
+	if !c.configGetter.ValidateAPIKey(ctx.GetHeader("X-API-Key")) {
+		response_helper.Common(ctx, 401, "未授权")
+		return
+	}
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		response_helper.Fail(ctx, "参数错误: invalid id")
+		return
+	}
+	var req replayRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response_helper.Fail(ctx, "参数错误: "+err.Error())
+		return
+	}
+	if !req.All && req.Provider == "" {
+		response_helper.Fail(ctx, "参数错误: provider or all is required")
+		return
+	}
+
+	entry, err := c.requests.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response_helper.Fail(ctx, "请求记录不存在")
+		return
+	}
+	if err != nil {
+		response_helper.Fail(ctx, "查询请求记录失败: "+err.Error())
+		return
+	}
+	capture, err := c.requests.GetCapture(entry.Id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response_helper.Fail(ctx, "该请求未采集请求体，无法重放")
+		return
+	}
+	if err != nil {
+		response_helper.Fail(ctx, "查询请求体失败: "+err.Error())
+		return
+	}
+	body := []byte(capture.RequestBody)
+	if !json.Valid(body) {
+		response_helper.Fail(ctx, "采集的请求体不完整（超过大小上限被截断），无法重放")
+		return
+	}
+
+	var targets []upstream.ProviderModel
+	if req.All {
+		targets = c.getManager().GetAllProviderModels(entry.Alias)
+		if len(targets) == 0 {
+			response_helper.Fail(ctx, "模型别名 "+entry.Alias+" 没有配置任何供应商")
+			return
+		}
+	} else {
+		pm, err := c.getManager().FindProviderModel(req.Provider, entry.Alias, req.UpstreamModel)
+		if err != nil {
+			response_helper.Fail(ctx, "参数错误: "+err.Error())
+			return
+		}
+		targets = []upstream.ProviderModel{pm}
+	}
+
+	results := make([]replayResult, len(targets))
+	var wg sync.WaitGroup
+	for i, pm := range targets {
+		wg.Add(1)
+		go func(i int, pm upstream.ProviderModel) {
+			defer wg.Done()
+			results[i] = c.replayOne(ctx.Request.Context(), entry, body, pm)
+		}(i, pm)
+	}
+	wg.Wait()
+
+	response_helper.Success(ctx, "重放完成", gin.H{
+		"request_id": entry.RequestId,
+		"alias":      entry.Alias,
+		"endpoint":   entry.Endpoint,
+		"stream":     entry.Stream,
+		"redacted":   strings.Contains(capture.RequestBody, `"[REDACTED]"`),
+		"results":    results,
+	})
+}
+
+// replayOne 向单个目标发送请求，记录状态码、耗时、首 token 时间、token 用量和响应体
+func (c *Controller) replayOne(parent context.Context, entry *model.RequestLog, body []byte, pm upstream.ProviderModel) replayResult {
+	result := replayResult{Provider: pm.Provider.Config.Name, UpstreamModel: pm.Mapping.Upstream}
+
+	reqBody := processRequestBody(body, pm, entry.Alias)
+	if entry.Stream && entry.Endpoint == upstream.ChatCompletionsPath {
+		reqBody, _ = forceIncludeUsage(reqBody)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, time.Duration(pm.Provider.Config.Timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	if entry.Stream {
+		resp, err = pm.Provider.ProxyStreamRequest(ctx, entry.Endpoint, reqBody, map[string]string{})
+	} else {
+		resp, err = pm.Provider.ProxyRequest(ctx, "POST", entry.Endpoint, reqBody, map[string]string{})
+	}
+	if err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+
+	var respBody bytes.Buffer
+	if entry.Stream && resp.StatusCode == http.StatusOK {
+		// 读取完整事件流：首个有效数据块计为首 token，流内错误和未正常结束记为错误
+		tracker := &streamTracker{}
+		reader := bufio.NewReader(resp.Body)
+		var streamErr error
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if result.TtftMs == 0 && isValidStreamChunk(line) {
+					result.TtftMs = time.Since(start).Milliseconds()
+				}
+				respBody.Write(line)
+				if streamErr == nil {
+					streamErr = tracker.observe(line)
+				}
+			}
+			if readErr != nil {
+				if readErr != io.EOF {
+					streamErr = readErr
+				}
+				break
+			}
+		}
+		res := tracker.result(nil)
+		result.Usage = res.usage
+		if streamErr == nil {
+			streamErr = res.err
+		}
+		if streamErr != nil {
+			result.Error = streamErr.Error()
+		}
+	} else {
+		result.TtftMs = time.Since(start).Milliseconds()
+		if _, err := io.Copy(&respBody, resp.Body); err != nil {
+			result.Error = err.Error()
+		}
+		if resp.StatusCode == http.StatusOK {
+			result.Usage = parseUsage(respBody.Bytes())
+		} else if result.Error == "" {
+			result.Error = fmt.Sprintf("upstream returned status %d", resp.StatusCode)
+		}
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Cost = pm.Mapping.Price.Cost(result.Usage)
+
+	result.ResponseBody = respBody.String()
+	if respBody.Len() > maxReplayResponseBytes {
+		result.ResponseBody = strings.ToValidUTF8(string(respBody.Bytes()[:maxReplayResponseBytes]), "") +
+			fmt.Sprintf("\n...[truncated %d bytes]", respBody.Len()-maxReplayResponseBytes)
+	}
+	return result
+}
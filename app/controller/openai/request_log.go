@@ -0,0 +1,139 @@
+package openai
+
+import (
+	"encoding/json"
+	"gin_base/app/helper/type_helper"
+	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/requestlog"
+	"gin_base/app/service/upstream"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLogKey 上下文键：当前请求的记录
+const requestLogKey = "request_log"
+
+// requestLog 单个代理请求的记录（请求结束时写入请求记录表）
+type requestLog struct {
+	entry    model.RequestLog
+	start    time.Time
+	attempts []*upstream.Attempt
+	capture  *requestlog.Capture // 请求体/响应体采集（未采样时为 nil）
+	success  bool                // 是否成功返回（流式为正常结束或客户端主动断开）
+}
+
+// captureWriter 采集返回客户端的响应体
+type captureWriter struct {
+	gin.ResponseWriter
+	capture *requestlog.Capture
+}
+
+// Write 写入响应并采集
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.capture.AppendResponse(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString 写入响应并采集
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture.AppendResponse([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// startRequestLog 开始记录请求，并保存到请求上下文（供用量统计累加费用）
+// 按采集配置命中时同时采集客户端请求体和之后写出的响应体
+func (c *Controller) startRequestLog(ctx *gin.Context, reqID string, aliasModel string, stream bool, body []byte) *requestLog {
+	l := &requestLog{
+		start: time.Now(),
+		entry: model.RequestLog{
+			RequestId: reqID,
+			Endpoint:  ctx.Request.URL.Path,
+			Alias:     aliasModel,
+			Stream:    stream,
+		},
+	}
+	if key := apikey.FromContext(ctx); key != nil {
+		l.entry.KeyName = key.Name
+	}
+	if cfg := c.getBodyCapture(); requestlog.ShouldCapture(cfg, l.entry.KeyName, aliasModel) {
+		l.capture = requestlog.NewCapture(cfg)
+		l.capture.SetRequest(body)
+		ctx.Writer = &captureWriter{ResponseWriter: ctx.Writer, capture: l.capture}
+	}
+	ctx.Set(requestLogKey, l)
+	return l
+}
+
+// requestLogFromContext 获取当前请求的记录（未记录时返回 nil）
+func requestLogFromContext(ctx *gin.Context) *requestLog {
+	if v, exists := ctx.Get(requestLogKey); exists {
+		if l, ok := v.(*requestLog); ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// addAttempt 记录一次上游尝试（body 为发往上游的请求体）
+func (l *requestLog) addAttempt(attempt *upstream.Attempt, pm upstream.ProviderModel, body []byte) {
+	l.attempts = append(l.attempts, attempt)
+	l.capture.StartAttempt(pm.Provider.Config.Name, pm.Mapping.Upstream, body)
+}
+
+// attemptResponse 采集当前尝试的上游响应（流式按行追加）
+func (l *requestLog) attemptResponse(data []byte) {
+	if l != nil {
+		l.capture.AppendAttemptResponse(data)
+	}
+}
+
+// firstOutput 记录首 token 时间（从请求开始到该尝试收到首个 token，只记录第一次）
+func (l *requestLog) firstOutput(attempt *upstream.Attempt) {
+	if l.entry.TtftMs == 0 && attempt.TTFT() > 0 {
+		l.entry.TtftMs = (attempt.StartTime().Sub(l.start) + attempt.TTFT()).Milliseconds()
+	}
+}
+
+// finishRequestLog 结束请求：汇总各次尝试、状态码、耗时和 token 用量后写入请求记录
+func (c *Controller) finishRequestLog(ctx *gin.Context, l *requestLog, lastErr error) {
+	e := &l.entry
+	e.CreatedAt = type_helper.Time(l.start)
+	e.Status = ctx.Writer.Status()
+	e.LatencyMs = time.Since(l.start).Milliseconds()
+	e.Attempts = len(l.attempts)
+
+	if len(l.attempts) > 0 {
+		summaries := make([]upstream.AttemptSummary, 0, len(l.attempts))
+		for _, attempt := range l.attempts {
+			summaries = append(summaries, attempt.Summary())
+		}
+		last := summaries[len(summaries)-1]
+		e.Provider = last.Provider
+		e.UpstreamModel = last.UpstreamModel
+		if data, err := json.Marshal(summaries); err == nil {
+			e.AttemptDetails = string(data)
+		}
+	}
+
+	if !l.success && lastErr != nil {
+		e.Error = lastErr.Error()
+	}
+
+	if v, exists := ctx.Get(model.UsageContextKey); exists {
+		if usage, ok := v.(*model.Usage); ok {
+			e.PromptTokens = usage.PromptTokens
+			e.CompletionTokens = usage.CompletionTokens
+			e.TotalTokens = usage.TotalTokens
+			if usage.PromptTokensDetails != nil {
+				e.CachedTokens = usage.PromptTokensDetails.CachedTokens
+			}
+			if usage.CompletionTokensDetails != nil {
+				e.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+			}
+		}
+	}
+
+	c.requests.Record(e, l.capture.Model(l.start))
+}
@@ -0,0 +1,255 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/respcache"
+	"gin_base/app/service/tracing"
+	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseCacheKey 上下文键：未命中缓存时保存的缓存键（请求成功后写入缓存）
+const responseCacheKey = "response_cache_key"
+
+// cacheHeader 响应头：缓存查询结果（HIT / MISS / BYPASS）
+const cacheHeader = "X-Cache"
+
+// serveFromCache 查询 chat 请求的响应缓存，命中时直接返回缓存的响应（流式以 SSE 数据块重放）并返回 true
+// 未命中时在上下文中保存缓存键，请求成功后写入缓存
+// 客户端可通过 Cache-Control 跳过缓存：no-cache 不读取缓存但写入新的响应，no-store 既不读取也不写入
+func (c *Controller) serveFromCache(ctx *gin.Context, req *model.ChatCompletionRequest, body []byte) bool {
+	if !c.cache.Enabled(req.Model) {
+		return false
+	}
+	noCache, noStore := parseCacheControl(ctx.GetHeader("Cache-Control"))
+	if noCache || noStore {
+		ctx.Header(cacheHeader, "BYPASS")
+		respcache.ObserveLookup(req.Model, respcache.ResultBypass)
+		if noStore {
+			return false
+		}
+	}
+	var keyName string
+	if vk := apikey.FromContext(ctx); vk != nil {
+		keyName = vk.Name
+	}
+	key, err := respcache.Key(upstream.ChatCompletionsPath, keyName, body)
+	if err != nil {
+		return false
+	}
+
+	if !noCache {
+		if cached := c.cache.Get(key); cached != nil {
+			data := cached
+			if req.Stream {
+				includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+				if data, err = completionToStream(cached, includeUsage); err != nil {
+					log_helper.Warning(fmt.Sprintf("Invalid cached response for %s, request forwarded: %v", req.Model, err))
+					data = nil
+				}
+			}
+			if data != nil {
+				respcache.ObserveLookup(req.Model, respcache.ResultHit)
+				ctx.Header(cacheHeader, "HIT")
+				c.writeCachedResponse(ctx, req, body, data)
+				return true
+			}
+		}
+		respcache.ObserveLookup(req.Model, respcache.ResultMiss)
+		ctx.Header(cacheHeader, "MISS")
+	}
+
+	// 流式只能从单个 choice 的输出重建完整响应
+	if !req.Stream || req.N == nil || *req.N <= 1 {
+		ctx.Set(responseCacheKey, key)
+	}
+	return false
+}
+
+// parseCacheControl 解析请求头 Cache-Control 中的 no-cache / no-store
+func parseCacheControl(header string) (noCache, noStore bool) {
+	for _, directive := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
+
+// writeCachedResponse 返回缓存的响应：记录请求（不经过上游，不计 token 和费用）并单独统计命中次数
+func (c *Controller) writeCachedResponse(ctx *gin.Context, req *model.ChatCompletionRequest, body []byte, data []byte) {
+	reqID := generateRequestID()
+	tracing.SpanFromContext(ctx.Request.Context()).SetAttributes("request.id", reqID, "model.alias", req.Model, "stream", req.Stream, "cache.hit", true)
+	reqLog := c.startRequestLog(ctx, reqID, req.Model, req.Stream, body)
+	reqLog.entry.CacheHit = true
+	reqLog.success = true
+	defer func() { c.finishRequestLog(ctx, reqLog, nil) }()
+
+	// 限流按实际用量修正为 0 token
+	ctx.Set(model.UsageContextKey, &model.Usage{})
+	dim := usagestat.Dimension{Alias: req.Model}
+	if key := apikey.FromContext(ctx); key != nil {
+		dim.KeyName = key.Name
+	}
+	c.usage.RecordCacheHit(dim)
+
+	log_helper.Info(fmt.Sprintf("[%s] %s cache hit", reqID, req.Model))
+	if !req.Stream {
+		ctx.Data(http.StatusOK, "application/json", data)
+		return
+	}
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Write(data)
+	ctx.Writer.Flush()
+}
+
+// storeResponse 非流式请求成功后缓存响应体（未启用缓存或客户端要求不写入时跳过）
+func (c *Controller) storeResponse(ctx *gin.Context, body []byte) {
+	if key := ctx.GetString(responseCacheKey); key != "" {
+		c.cache.Set(key, body)
+	}
+}
+
+// storeStreamResponse 流式请求正常结束后，以输出的文本重建完整的 chat 响应并缓存
+// 输出了工具调用的流不缓存（无法从流中可靠地重建）
+func (c *Controller) storeStreamResponse(ctx *gin.Context, reqID, aliasModel string, result *streamResult) {
+	key := ctx.GetString(responseCacheKey)
+	if key == "" || result.err != nil || result.clientGone || result.hasToolCalls {
+		return
+	}
+	finishReason := result.finishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	completion := map[string]interface{}{
+		"id":      "chatcmpl-" + reqID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   aliasModel,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": result.content},
+			"finish_reason": finishReason,
+		}},
+	}
+	if result.usage != nil {
+		completion["usage"] = result.usage
+	}
+	data, err := json.Marshal(completion)
+	if err != nil {
+		return
+	}
+	c.cache.Set(key, data)
+}
+
+// cachedCompletion 缓存的 chat 响应中重建流所需的字段
+type cachedCompletion struct {
+	ID                string `json:"id"`
+	Created           int64  `json:"created"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Choices           []struct {
+		Index        int                    `json:"index"`
+		Message      map[string]interface{} `json:"message"`
+		Logprobs     interface{}            `json:"logprobs"`
+		FinishReason interface{}            `json:"finish_reason"`
+	} `json:"choices"`
+	Usage json.RawMessage `json:"usage"`
+}
+
+// cachedChunk 由缓存重建的 chat 流数据块
+type cachedChunk struct {
+	ID                string              `json:"id"`
+	Object            string              `json:"object"`
+	Created           int64               `json:"created"`
+	Model             string              `json:"model"`
+	SystemFingerprint string              `json:"system_fingerprint,omitempty"`
+	Choices           []cachedChunkChoice `json:"choices"`
+	Usage             json.RawMessage     `json:"usage,omitempty"`
+}
+
+// cachedChunkChoice 重建的数据块中的 choice
+type cachedChunkChoice struct {
+	Index        int                    `json:"index"`
+	Delta        map[string]interface{} `json:"delta"`
+	Logprobs     interface{}            `json:"logprobs,omitempty"`
+	FinishReason interface{}            `json:"finish_reason"`
+}
+
+// completionToStream 将缓存的 chat 响应转换为 SSE 事件流：
+// 每个 choice 一个包含完整消息的数据块和一个结束数据块，客户端要求时追加 usage 数据块，最后为 [DONE]
+func completionToStream(body []byte, includeUsage bool) ([]byte, error) {
+	var completion cachedCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in cached response")
+	}
+
+	var buf bytes.Buffer
+	writeChunk := func(choices []cachedChunkChoice, usage json.RawMessage) error {
+		data, err := json.Marshal(cachedChunk{
+			ID:                completion.ID,
+			Object:            "chat.completion.chunk",
+			Created:           completion.Created,
+			Model:             completion.Model,
+			SystemFingerprint: completion.SystemFingerprint,
+			Choices:           choices,
+			Usage:             usage,
+		})
+		if err != nil {
+			return err
+		}
+		buf.WriteString("data: ")
+		buf.Write(data)
+		buf.WriteString("\n\n")
+		return nil
+	}
+
+	for _, choice := range completion.Choices {
+		delta := choice.Message
+		if delta == nil {
+			delta = map[string]interface{}{}
+		}
+		// 流中的工具调用需带下标
+		if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+			for i, call := range toolCalls {
+				if m, ok := call.(map[string]interface{}); ok {
+					m["index"] = i
+				}
+			}
+		}
+		first := []cachedChunkChoice{{Index: choice.Index, Delta: delta, Logprobs: choice.Logprobs}}
+		if err := writeChunk(first, nil); err != nil {
+			return nil, err
+		}
+		last := []cachedChunkChoice{{Index: choice.Index, Delta: map[string]interface{}{}, FinishReason: choice.FinishReason}}
+		if err := writeChunk(last, nil); err != nil {
+			return nil, err
+		}
+	}
+	if includeUsage && len(completion.Usage) > 0 && string(completion.Usage) != "null" {
+		if err := writeChunk([]cachedChunkChoice{}, completion.Usage); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("data: [DONE]\n\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseStream 拆分 SSE 事件流，返回各数据块和是否以 [DONE] 结束
+func parseStream(t *testing.T, data []byte) ([]map[string]interface{}, bool) {
+	t.Helper()
+	var chunks []map[string]interface{}
+	done := false
+	for _, event := range strings.Split(strings.TrimSuffix(string(data), "\n\n"), "\n\n") {
+		payload, ok := strings.CutPrefix(event, "data: ")
+		if !ok {
+			t.Fatalf("unexpected event %q", event)
+		}
+		if payload == "[DONE]" {
+			done = true
+			continue
+		}
+		if done {
+			t.Fatalf("data after [DONE]: %q", payload)
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", payload, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, done
+}
+
+func TestCompletionToStream(t *testing.T) {
+	usage := map[string]interface{}{"prompt_tokens": float64(3), "completion_tokens": float64(2), "total_tokens": float64(5)}
+	tests := []struct {
+		name         string
+		body         string
+		includeUsage bool
+		wantDeltas   []map[string]interface{} // 各 choice 首个数据块的 delta
+		wantFinish   []interface{}            // 各 choice 结束数据块的 finish_reason
+		wantUsage    map[string]interface{}   // usage 数据块，nil 表示不应输出
+	}{
+		{
+			name:       "text without usage",
+			body:       `{"id":"c1","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			wantDeltas: []map[string]interface{}{{"role": "assistant", "content": "Hello"}},
+			wantFinish: []interface{}{"stop"},
+		},
+		{
+			name:         "text with usage",
+			body:         `{"id":"c1","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			includeUsage: true,
+			wantDeltas:   []map[string]interface{}{{"role": "assistant", "content": "Hello"}},
+			wantFinish:   []interface{}{"stop"},
+			wantUsage:    usage,
+		},
+		{
+			name:         "usage requested but missing",
+			body:         `{"id":"c1","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"length"}],"usage":null}`,
+			includeUsage: true,
+			wantDeltas:   []map[string]interface{}{{"role": "assistant", "content": "Hi"}},
+			wantFinish:   []interface{}{"length"},
+		},
+		{
+			name: "tool calls get indexes",
+			body: `{"id":"c1","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"a","type":"function","function":{"name":"f","arguments":"{}"}},{"id":"b","type":"function","function":{"name":"g","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			wantDeltas: []map[string]interface{}{{
+				"role":    "assistant",
+				"content": nil,
+				"tool_calls": []interface{}{
+					map[string]interface{}{"index": float64(0), "id": "a", "type": "function", "function": map[string]interface{}{"name": "f", "arguments": "{}"}},
+					map[string]interface{}{"index": float64(1), "id": "b", "type": "function", "function": map[string]interface{}{"name": "g", "arguments": "{}"}},
+				},
+			}},
+			wantFinish: []interface{}{"tool_calls"},
+		},
+		{
+			name:       "multiple choices",
+			body:       `{"id":"c1","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"A"},"finish_reason":"stop"},{"index":1,"message":{"role":"assistant","content":"B"},"finish_reason":"stop"}]}`,
+			wantDeltas: []map[string]interface{}{{"role": "assistant", "content": "A"}, {"role": "assistant", "content": "B"}},
+			wantFinish: []interface{}{"stop", "stop"},
+		},
+	}
+	for _, tt := range tests {
+		data, err := completionToStream([]byte(tt.body), tt.includeUsage)
+		if err != nil {
+			t.Errorf("%s: completionToStream error: %v", tt.name, err)
+			continue
+		}
+		chunks, done := parseStream(t, data)
+		if !done {
+			t.Errorf("%s: stream does not end with [DONE]", tt.name)
+		}
+		wantChunks := 2 * len(tt.wantDeltas)
+		if tt.wantUsage != nil {
+			wantChunks++
+		}
+		if len(chunks) != wantChunks {
+			t.Errorf("%s: got %d chunks, want %d", tt.name, len(chunks), wantChunks)
+			continue
+		}
+		for _, chunk := range chunks {
+			if chunk["id"] != "c1" || chunk["model"] != "m" || chunk["object"] != "chat.completion.chunk" || chunk["created"] != float64(1) {
+				t.Errorf("%s: chunk header = %v", tt.name, chunk)
+			}
+		}
+		for i := range tt.wantDeltas {
+			first := chunks[2*i]["choices"].([]interface{})[0].(map[string]interface{})
+			last := chunks[2*i+1]["choices"].([]interface{})[0].(map[string]interface{})
+			if first["index"] != float64(i) || last["index"] != float64(i) {
+				t.Errorf("%s: choice %d indexes = %v, %v", tt.name, i, first["index"], last["index"])
+			}
+			if !reflect.DeepEqual(first["delta"], map[string]interface{}(tt.wantDeltas[i])) {
+				t.Errorf("%s: choice %d delta = %v, want %v", tt.name, i, first["delta"], tt.wantDeltas[i])
+			}
+			if first["finish_reason"] != nil {
+				t.Errorf("%s: choice %d first chunk finish_reason = %v, want null", tt.name, i, first["finish_reason"])
+			}
+			if !reflect.DeepEqual(last["delta"], map[string]interface{}{}) || last["finish_reason"] != tt.wantFinish[i] {
+				t.Errorf("%s: choice %d last chunk = %v, want empty delta and finish_reason %v", tt.name, i, last, tt.wantFinish[i])
+			}
+		}
+		if tt.wantUsage != nil {
+			last := chunks[len(chunks)-1]
+			if choices, _ := last["choices"].([]interface{}); choices == nil || len(choices) != 0 {
+				t.Errorf("%s: usage chunk choices = %v, want []", tt.name, last["choices"])
+			}
+			if !reflect.DeepEqual(last["usage"], map[string]interface{}(tt.wantUsage)) {
+				t.Errorf("%s: usage = %v, want %v", tt.name, last["usage"], tt.wantUsage)
+			}
+		}
+	}
+}
+
+func TestCompletionToStreamInvalid(t *testing.T) {
+	for _, body := range []string{`not json`, `{"id":"c1","choices":[]}`} {
+		if _, err := completionToStream([]byte(body), false); err == nil {
+			t.Errorf("completionToStream(%s): want error", body)
+		}
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		header                   string
+		wantNoCache, wantNoStore bool
+	}{
+		{"", false, false},
+		{"no-cache", true, false},
+		{"No-Store", false, true},
+		{"max-age=0, no-cache , no-store", true, true},
+		{"no-cache-please", false, false},
+	}
+	for _, tt := range tests {
+		noCache, noStore := parseCacheControl(tt.header)
+		if noCache != tt.wantNoCache || noStore != tt.wantNoStore {
+			t.Errorf("parseCacheControl(%q) = (%v, %v), want (%v, %v)", tt.header, noCache, noStore, tt.wantNoCache, tt.wantNoStore)
+		}
+	}
+}
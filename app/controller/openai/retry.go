@@ -0,0 +1,73 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gin_base/app/service/upstream"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPassThroughMessage 非 JSON 上游错误体包装为错误消息时的最大长度
+const maxPassThroughMessage = 1000
+
+// classifyError 对请求错误分类：流内错误、超时或网络错误
+func classifyError(err error) upstream.ErrorClass {
+	var se *streamError
+	if errors.As(err, &se) {
+		return upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: se.classCode()}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return upstream.ErrorClass{Kind: upstream.ErrorKindTimeout}
+	}
+	return upstream.ErrorClass{Kind: upstream.ErrorKindNetwork}
+}
+
+// recordAttemptError 按重试策略记录一次失败的尝试，返回是否继续尝试下一个候选
+func (c *Controller) recordAttemptError(pm upstream.ProviderModel, aliasModel string, ec upstream.ErrorClass) bool {
+	manager := c.getManager()
+	retry, countAsFailure := manager.Classify(pm.Provider, ec)
+	if countAsFailure {
+		manager.RecordFailure(pm.Provider, aliasModel, pm.Mapping.Upstream, ec)
+	} else {
+		manager.RecordRejected(pm.Provider, aliasModel, pm.Mapping.Upstream, ec)
+	}
+	if retry {
+		manager.RecordFailover(pm.Provider, aliasModel, pm.Mapping.Upstream)
+	}
+	return retry
+}
+
+// passThroughError 将不可重试的上游错误原样返回给客户端（错误体不是 JSON 错误时包装为 OpenAI 格式）
+func (c *Controller) passThroughError(ctx *gin.Context, statusCode int, body []byte) {
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(body, &probe) == nil && probe["error"] != nil {
+		ctx.Data(statusCode, "application/json", body)
+		return
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	if runes := []rune(message); len(runes) > maxPassThroughMessage {
+		message = string(runes[:maxPassThroughMessage])
+	}
+	c.sendError(ctx, statusCode, "upstream_error", message)
+}
+
+// passThroughStream 将不可重试的流内错误原样返回给客户端
+func passThroughStream(ctx *gin.Context, lines [][]byte) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Status(http.StatusOK)
+	for _, line := range lines {
+		ctx.Writer.Write(line)
+	}
+	ctx.Writer.Flush()
+}
@@ -0,0 +1,42 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin_base/app/service/upstream"
+	"io"
+	"net"
+	"testing"
+)
+
+// timeoutError 模拟网络超时
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want upstream.ErrorClass
+	}{
+		{"stream error code", &streamError{message: "busy", code: "overloaded"}, upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: "overloaded"}},
+		{"stream error numeric code", &streamError{message: "busy", code: float64(529)}, upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: "529"}},
+		{"stream error type fallback", &streamError{message: "busy", errType: "overloaded_error"}, upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: "overloaded_error"}},
+		{"wrapped stream error", fmt.Errorf("read: %w", &streamError{message: "x", code: "c"}), upstream.ErrorClass{Kind: upstream.ErrorKindStreamError, Code: "c"}},
+		{"deadline exceeded", fmt.Errorf("request: %w", context.DeadlineExceeded), upstream.ErrorClass{Kind: upstream.ErrorKindTimeout}},
+		{"net timeout", &net.OpError{Op: "read", Err: timeoutError{}}, upstream.ErrorClass{Kind: upstream.ErrorKindTimeout}},
+		{"connection reset", errors.New("connection reset by peer"), upstream.ErrorClass{Kind: upstream.ErrorKindNetwork}},
+		{"unexpected eof", io.ErrUnexpectedEOF, upstream.ErrorClass{Kind: upstream.ErrorKindNetwork}},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: classifyError = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
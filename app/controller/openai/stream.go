@@ -0,0 +1,200 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/model"
+	"gin_base/app/service/upstream"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamResult 流式传输结果
+type streamResult struct {
+	err          error        // 流异常（上游中途断开、流内错误、未正常结束），nil 表示正常完成
+	clientGone   bool         // 客户端已断开（不计为上游失败）
+	content      string       // 本次已输出给客户端的 assistant 文本
+	hasToolCalls bool         // 本次已输出工具调用（此时无法续写）
+	finishReason string       // chat 流的结束原因
+	usage        *model.Usage // 流中的 token 用量（上游未返回时为 nil）
+	bytes        int64        // 从上游读取的字节数
+}
+
+// streamError 流内错误事件
+type streamError struct {
+	message string
+	code    interface{} // 错误码（可能是字符串或数字）
+	errType interface{} // 错误类型
+}
+
+func (e *streamError) Error() string {
+	if e.code == nil && e.errType == nil {
+		return "stream error: " + e.message
+	}
+	return fmt.Sprintf("stream error: %s (code: %v)", e.message, e.code)
+}
+
+// classCode 用于重试策略匹配的错误码：优先使用 code，没有时使用 type
+func (e *streamError) classCode() string {
+	for _, v := range []interface{}{e.code, e.errType} {
+		if v != nil && fmt.Sprintf("%v", v) != "" {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return ""
+}
+
+// streamTracker 跟踪已转发的流数据，用于判断流是否正常结束
+type streamTracker struct {
+	bytes        int64
+	completed    bool
+	content      strings.Builder
+	hasToolCalls bool
+	finishReason string
+	usage        usageTracker
+}
+
+// streamChunkProbe 从流数据中提取结束标记和 usage 所需的最小结构
+type streamChunkProbe struct {
+	usageEnvelope
+	Type    string `json:"type"`
+	Choices []struct {
+		Delta *struct {
+			Content   interface{}       `json:"content"`
+			ToolCalls []json.RawMessage `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// observe 检查一行流数据：返回流内错误，并记录结束标记和已输出内容
+func (t *streamTracker) observe(line []byte) error {
+	t.bytes += int64(len(line))
+	if err := detectStreamError(line); err != nil {
+		return err
+	}
+
+	data := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(data, []byte("data:")) {
+		return nil
+	}
+	data = bytes.TrimSpace(data[len("data:"):])
+	if bytes.Equal(data, []byte("[DONE]")) {
+		t.completed = true
+		return nil
+	}
+
+	var chunk streamChunkProbe
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+	t.usage.observe(&chunk.usageEnvelope)
+	switch chunk.Type {
+	// Responses 与 Anthropic Messages 流的结束事件
+	case "response.completed", "response.incomplete", "message_stop":
+		t.completed = true
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta != nil {
+			if text, ok := choice.Delta.Content.(string); ok {
+				t.content.WriteString(text)
+			}
+			if len(choice.Delta.ToolCalls) > 0 {
+				t.hasToolCalls = true
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.completed = true
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	return nil
+}
+
+// result 生成流式传输结果（readErr 为读取上游时遇到的错误）
+func (t *streamTracker) result(readErr error) *streamResult {
+	res := &streamResult{content: t.content.String(), hasToolCalls: t.hasToolCalls, finishReason: t.finishReason, usage: t.usage.result(), bytes: t.bytes}
+	if !t.completed {
+		if readErr != nil {
+			res.err = fmt.Errorf("stream interrupted: %v", readErr)
+		} else {
+			res.err = fmt.Errorf("stream ended without completion")
+		}
+	}
+	return res
+}
+
+// appendAssistantPrefix 将已输出的内容作为 assistant 消息追加到 chat 请求末尾，供下一个供应商续写
+func appendAssistantPrefix(body []byte, prefix string) []byte {
+	if prefix == "" {
+		return body
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body
+	}
+	messages, _ := data["messages"].([]interface{})
+	data["messages"] = append(messages, map[string]interface{}{"role": "assistant", "content": prefix})
+	newBody, err := json.Marshal(data)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+// isRoleOnlyChunk 是否为只声明 assistant 角色、不含内容的 chat 流首个数据块（续写时客户端已收到过，需丢弃）
+func isRoleOnlyChunk(line []byte) bool {
+	if !bytes.Contains(line, []byte(`"role"`)) {
+		return false
+	}
+	data := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(data, []byte("data:")) {
+		return false
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta *struct {
+				Role      string            `json:"role"`
+				Content   *string           `json:"content"`
+				ToolCalls []json.RawMessage `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *json.RawMessage `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data[len("data:"):]), &chunk); err != nil {
+		return false
+	}
+	if len(chunk.Choices) != 1 || (chunk.Usage != nil && string(*chunk.Usage) != "null") {
+		return false
+	}
+	choice := chunk.Choices[0]
+	if choice.Delta == nil || choice.Delta.Role == "" || len(choice.Delta.ToolCalls) > 0 {
+		return false
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		return false
+	}
+	return choice.Delta.Content == nil || *choice.Delta.Content == ""
+}
+
+// writeStreamError 在已开始的流中写入错误事件（按接口格式），告知客户端流未正常完成
+func writeStreamError(ctx *gin.Context, path string, message string) {
+	var event string
+	switch path {
+	case upstream.MessagesPath:
+		data, _ := json.Marshal(upstream.NewAnthropicError(http.StatusBadGateway, message))
+		event = fmt.Sprintf("event: error\ndata: %s\n\n", data)
+	case upstream.ResponsesPath:
+		data, _ := json.Marshal(map[string]interface{}{"type": "error", "code": "upstream_error", "message": message})
+		event = fmt.Sprintf("event: error\ndata: %s\n\n", data)
+	default:
+		data, _ := json.Marshal(model.NewOpenAIError(message, "upstream_error", nil))
+		event = fmt.Sprintf("data: %s\n\n", data)
+	}
+	ctx.Writer.WriteString(event)
+	ctx.Writer.Flush()
+}
@@ -0,0 +1,217 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStreamTrackerObserve(t *testing.T) {
+	tests := []struct {
+		name          string
+		lines         []string
+		wantErr       bool
+		wantCompleted bool
+		wantContent   string
+		wantToolCalls bool
+		wantFinish    string
+	}{
+		{
+			name: "chat stream with done",
+			lines: []string{
+				`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}` + "\n",
+				"\n",
+				`data: {"choices":[{"index":0,"delta":{"content":"lo"}}]}` + "\n",
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n",
+				"data: [DONE]\n",
+			},
+			wantCompleted: true,
+			wantContent:   "Hello",
+			wantFinish:    "stop",
+		},
+		{
+			name: "finish reason without done",
+			lines: []string{
+				`data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n",
+				`data: {"choices":[{"delta":{},"finish_reason":"length"}]}` + "\n",
+			},
+			wantCompleted: true,
+			wantContent:   "Hi",
+			wantFinish:    "length",
+		},
+		{
+			name: "truncated stream",
+			lines: []string{
+				`data: {"choices":[{"delta":{"content":"partial"}}]}` + "\n",
+			},
+			wantContent: "partial",
+		},
+		{
+			name: "tool calls",
+			lines: []string{
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"f","arguments":""}}]}}]}` + "\n",
+				`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}` + "\n",
+			},
+			wantCompleted: true,
+			wantToolCalls: true,
+			wantFinish:    "tool_calls",
+		},
+		{
+			name: "responses completed event",
+			lines: []string{
+				"event: response.completed\n",
+				`data: {"type":"response.completed","response":{"status":"completed"}}` + "\n",
+			},
+			wantCompleted: true,
+		},
+		{
+			name: "anthropic message stop",
+			lines: []string{
+				"event: message_stop\n",
+				`data: {"type":"message_stop"}` + "\n",
+			},
+			wantCompleted: true,
+		},
+		{
+			name: "error event",
+			lines: []string{
+				`data: {"error":{"message":"overloaded","code":"overloaded"}}` + "\n",
+			},
+			wantErr: true,
+		},
+		{
+			name: "non json data ignored",
+			lines: []string{
+				": keep-alive\n",
+				"data: not-json\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var tracker streamTracker
+		var gotErr error
+		for _, line := range tt.lines {
+			if err := tracker.observe([]byte(line)); err != nil {
+				gotErr = err
+				break
+			}
+		}
+		if (gotErr != nil) != tt.wantErr {
+			t.Errorf("%s: observe error = %v, wantErr %v", tt.name, gotErr, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			var se *streamError
+			if !errors.As(gotErr, &se) {
+				t.Errorf("%s: observe error = %T, want *streamError", tt.name, gotErr)
+			}
+			continue
+		}
+		res := tracker.result(nil)
+		if completed := res.err == nil; completed != tt.wantCompleted {
+			t.Errorf("%s: completed = %v, want %v (err %v)", tt.name, completed, tt.wantCompleted, res.err)
+		}
+		if res.content != tt.wantContent {
+			t.Errorf("%s: content = %q, want %q", tt.name, res.content, tt.wantContent)
+		}
+		if res.hasToolCalls != tt.wantToolCalls {
+			t.Errorf("%s: hasToolCalls = %v, want %v", tt.name, res.hasToolCalls, tt.wantToolCalls)
+		}
+		if res.finishReason != tt.wantFinish {
+			t.Errorf("%s: finishReason = %q, want %q", tt.name, res.finishReason, tt.wantFinish)
+		}
+	}
+}
+
+func TestStreamTrackerBytes(t *testing.T) {
+	var tracker streamTracker
+	lines := []string{"data: {}\n", "\n", "data: [DONE]\n"}
+	var want int64
+	for _, line := range lines {
+		tracker.observe([]byte(line))
+		want += int64(len(line))
+	}
+	if res := tracker.result(nil); res.bytes != want {
+		t.Errorf("bytes = %d, want %d", res.bytes, want)
+	}
+}
+
+func TestAppendAssistantPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		prefix string
+		want   []interface{} // 追加后的 messages，nil 表示请求体应保持不变
+	}{
+		{
+			name:   "appends assistant message",
+			body:   `{"model":"m","messages":[{"role":"user","content":"hi"}]}`,
+			prefix: "Hello",
+			want: []interface{}{
+				map[string]interface{}{"role": "user", "content": "hi"},
+				map[string]interface{}{"role": "assistant", "content": "Hello"},
+			},
+		},
+		{
+			name:   "missing messages",
+			body:   `{"model":"m"}`,
+			prefix: "Hello",
+			want: []interface{}{
+				map[string]interface{}{"role": "assistant", "content": "Hello"},
+			},
+		},
+		{
+			name:   "empty prefix",
+			body:   `{"model":"m","messages":[]}`,
+			prefix: "",
+		},
+		{
+			name:   "invalid json",
+			body:   `{"model":`,
+			prefix: "Hello",
+		},
+	}
+	for _, tt := range tests {
+		got := appendAssistantPrefix([]byte(tt.body), tt.prefix)
+		if tt.want == nil {
+			if string(got) != tt.body {
+				t.Errorf("%s: body = %s, want unchanged %s", tt.name, got, tt.body)
+			}
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(got, &data); err != nil {
+			t.Errorf("%s: invalid body %s: %v", tt.name, got, err)
+			continue
+		}
+		if data["model"] != "m" {
+			t.Errorf("%s: model = %v, want m", tt.name, data["model"])
+		}
+		if !reflect.DeepEqual(data["messages"], tt.want) {
+			t.Errorf("%s: messages = %v, want %v", tt.name, data["messages"], tt.want)
+		}
+	}
+}
+
+func TestIsRoleOnlyChunk(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{"role with empty content", `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}` + "\n", true},
+		{"role without content", `data: {"choices":[{"index":0,"delta":{"role":"assistant"}}]}`, true},
+		{"role with content", `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`, false},
+		{"role with tool calls", `data: {"choices":[{"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1"}]}}]}`, false},
+		{"role with finish reason", `data: {"choices":[{"delta":{"role":"assistant","content":""},"finish_reason":"stop"}]}`, false},
+		{"content only", `data: {"choices":[{"delta":{"content":"role"}}]}`, false},
+		{"done", "data: [DONE]\n", false},
+		{"not data line", `event: {"role":"assistant"}`, false},
+	}
+	for _, tt := range tests {
+		if got := isRoleOnlyChunk([]byte(tt.line)); got != tt.want {
+			t.Errorf("%s: isRoleOnlyChunk = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
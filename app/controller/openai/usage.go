@@ -0,0 +1,236 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
+
+	"github.com/gin-gonic/gin"
+)
+
+// usageProbe 各接口格式 usage 字段的并集
+// chat / embeddings 为 prompt/completion，Responses 与 Anthropic Messages 为 input/output（Anthropic 的缓存 token 单独计数）
+type usageProbe struct {
+	PromptTokens             int           `json:"prompt_tokens"`
+	CompletionTokens         int           `json:"completion_tokens"`
+	InputTokens              int           `json:"input_tokens"`
+	OutputTokens             int           `json:"output_tokens"`
+	CacheCreationInputTokens int           `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int           `json:"cache_read_input_tokens"`
+	PromptTokensDetails      *tokenDetails `json:"prompt_tokens_details"`
+	CompletionTokensDetails  *tokenDetails `json:"completion_tokens_details"`
+	InputTokensDetails       *tokenDetails `json:"input_tokens_details"`
+	OutputTokensDetails      *tokenDetails `json:"output_tokens_details"`
+}
+
+// tokenDetails 输入/输出 token 详情（chat 与 Responses 格式）
+type tokenDetails struct {
+	CachedTokens    int `json:"cached_tokens"`
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// cachedTokens 命中缓存的输入 token 数
+func (u *usageProbe) cachedTokens() int {
+	cached := u.CacheReadInputTokens
+	for _, d := range []*tokenDetails{u.PromptTokensDetails, u.InputTokensDetails} {
+		if d != nil {
+			cached += d.CachedTokens
+		}
+	}
+	return cached
+}
+
+// reasoningTokens 推理 token 数（已包含在输出 token 数中）
+func (u *usageProbe) reasoningTokens() int {
+	reasoning := 0
+	for _, d := range []*tokenDetails{u.CompletionTokensDetails, u.OutputTokensDetails} {
+		if d != nil {
+			reasoning += d.ReasoningTokens
+		}
+	}
+	return reasoning
+}
+
+// usageEnvelope 响应体或流事件中可能携带 usage 的位置
+type usageEnvelope struct {
+	Usage    *usageProbe `json:"usage"`
+	Response *struct {
+		Usage *usageProbe `json:"usage"`
+	} `json:"response"` // Responses 流的 response.completed 事件
+	Message *struct {
+		Usage *usageProbe `json:"usage"`
+	} `json:"message"` // Anthropic 流的 message_start 事件
+}
+
+// usageTracker 汇总流中分散在多个事件里的 usage（各字段取最大值，Anthropic 的 output_tokens 为累计值）
+type usageTracker struct {
+	usage     usageProbe
+	cached    int
+	reasoning int
+	found     bool
+}
+
+// observe 记录一个响应体或流事件中的 usage
+func (t *usageTracker) observe(env *usageEnvelope) {
+	for _, u := range []*usageProbe{env.Usage, t.nested(env)} {
+		if u == nil {
+			continue
+		}
+		t.found = true
+		t.usage.PromptTokens = maxInt(t.usage.PromptTokens, u.PromptTokens)
+		t.usage.CompletionTokens = maxInt(t.usage.CompletionTokens, u.CompletionTokens)
+		t.usage.InputTokens = maxInt(t.usage.InputTokens, u.InputTokens)
+		t.usage.OutputTokens = maxInt(t.usage.OutputTokens, u.OutputTokens)
+		t.usage.CacheCreationInputTokens = maxInt(t.usage.CacheCreationInputTokens, u.CacheCreationInputTokens)
+		t.usage.CacheReadInputTokens = maxInt(t.usage.CacheReadInputTokens, u.CacheReadInputTokens)
+		t.cached = maxInt(t.cached, u.cachedTokens())
+		t.reasoning = maxInt(t.reasoning, u.reasoningTokens())
+	}
+}
+
+// maxInt 取较大值
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// nested 获取嵌套在 response / message 中的 usage
+func (t *usageTracker) nested(env *usageEnvelope) *usageProbe {
+	if env.Response != nil {
+		return env.Response.Usage
+	}
+	if env.Message != nil {
+		return env.Message.Usage
+	}
+	return nil
+}
+
+// result 转换为统一的 token 用量，未出现 usage 时返回 nil
+func (t *usageTracker) result() *model.Usage {
+	if !t.found {
+		return nil
+	}
+	u := t.usage
+	prompt := u.PromptTokens + u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	completion := u.CompletionTokens + u.OutputTokens
+	usage := &model.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+	if t.cached > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: t.cached}
+	}
+	if t.reasoning > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{ReasoningTokens: t.reasoning}
+	}
+	return usage
+}
+
+// parseUsage 从非流式响应体中提取 token 用量
+func parseUsage(body []byte) *model.Usage {
+	var env usageEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil
+	}
+	var t usageTracker
+	t.observe(&env)
+	return t.result()
+}
+
+// recordUsage 记录本次尝试的 token 用量：按模型价格计费后计入用量统计，并累加到请求上下文（供限流使用）
+func (c *Controller) recordUsage(ctx *gin.Context, pm upstream.ProviderModel, aliasModel string, usage *model.Usage) {
+	dim := usagestat.Dimension{
+		Alias:         aliasModel,
+		Provider:      pm.Provider.Config.Name,
+		UpstreamModel: pm.Mapping.Upstream,
+	}
+	if key := apikey.FromContext(ctx); key != nil {
+		dim.KeyName = key.Name
+	}
+	cost := pm.Mapping.Price.Cost(usage)
+	c.usage.Record(dim, usage, cost)
+	if l := requestLogFromContext(ctx); l != nil {
+		l.entry.Cost += cost
+	}
+	c.getManager().RecordTokens(pm.Provider, aliasModel, pm.Mapping.Upstream, usage)
+
+	if usage == nil {
+		return
+	}
+	if v, exists := ctx.Get(model.UsageContextKey); exists {
+		if total, ok := v.(*model.Usage); ok {
+			addUsage(total, usage)
+			return
+		}
+	}
+	copied := &model.Usage{}
+	addUsage(copied, usage)
+	ctx.Set(model.UsageContextKey, copied)
+}
+
+// addUsage 将 src 的 token 用量累加到 dst
+func addUsage(dst, src *model.Usage) {
+	dst.PromptTokens += src.PromptTokens
+	dst.CompletionTokens += src.CompletionTokens
+	dst.TotalTokens += src.TotalTokens
+	if src.PromptTokensDetails != nil {
+		if dst.PromptTokensDetails == nil {
+			dst.PromptTokensDetails = &model.PromptTokensDetails{}
+		}
+		dst.PromptTokensDetails.CachedTokens += src.PromptTokensDetails.CachedTokens
+	}
+	if src.CompletionTokensDetails != nil {
+		if dst.CompletionTokensDetails == nil {
+			dst.CompletionTokensDetails = &model.CompletionTokensDetails{}
+		}
+		dst.CompletionTokensDetails.ReasoningTokens += src.CompletionTokensDetails.ReasoningTokens
+	}
+}
+
+// forceIncludeUsage 流式 chat 请求要求上游在流末尾返回 usage（stream_options.include_usage）
+// 返回处理后的请求体，以及客户端未要求 usage 时需从响应中去掉的标记
+func forceIncludeUsage(body []byte) ([]byte, bool) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body, false
+	}
+	options, _ := data["stream_options"].(map[string]interface{})
+	if include, _ := options["include_usage"].(bool); include {
+		return body, false
+	}
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	options["include_usage"] = true
+	data["stream_options"] = options
+	newBody, err := json.Marshal(data)
+	if err != nil {
+		return body, false
+	}
+	return newBody, true
+}
+
+// isUsageOnlyChunk 是否为 include_usage 产生的仅含 usage 的 chat 流数据块（choices 为空）
+func isUsageOnlyChunk(line []byte) bool {
+	if !bytes.Contains(line, []byte(`"usage"`)) {
+		return false
+	}
+	data := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(data, []byte("data:")) {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   *json.RawMessage  `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data[len("data:"):]), &chunk); err != nil {
+		return false
+	}
+	return len(chunk.Choices) == 0 && chunk.Usage != nil && string(*chunk.Usage) != "null"
+}
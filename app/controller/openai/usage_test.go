@@ -0,0 +1,199 @@
+package openai
+
+import (
+	"encoding/json"
+	"gin_base/app/model"
+	"reflect"
+	"testing"
+)
+
+// observeLines 依次记录流事件中的 usage（跳过非 data 行）
+func observeLines(lines []string) *model.Usage {
+	var tracker streamTracker
+	for _, line := range lines {
+		tracker.observe([]byte(line))
+	}
+	return tracker.usage.result()
+}
+
+func TestUsageTrackerStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  *model.Usage
+	}{
+		{
+			name: "chat include_usage chunk",
+			lines: []string{
+				`data: {"choices":[{"delta":{"content":"hi"}}]}`,
+				`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17,"prompt_tokens_details":{"cached_tokens":4},"completion_tokens_details":{"reasoning_tokens":2}}}`,
+				`data: [DONE]`,
+			},
+			want: &model.Usage{
+				PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17,
+				PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: 4},
+				CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: 2},
+			},
+		},
+		{
+			name: "responses completed event",
+			lines: []string{
+				`data: {"type":"response.output_text.delta","delta":"hi"}`,
+				`data: {"type":"response.completed","response":{"usage":{"input_tokens":20,"output_tokens":8,"input_tokens_details":{"cached_tokens":10},"output_tokens_details":{"reasoning_tokens":3}}}}`,
+			},
+			want: &model.Usage{
+				PromptTokens: 20, CompletionTokens: 8, TotalTokens: 28,
+				PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: 10},
+				CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: 3},
+			},
+		},
+		{
+			name: "anthropic message start and cumulative delta",
+			lines: []string{
+				`data: {"type":"message_start","message":{"usage":{"input_tokens":30,"cache_creation_input_tokens":5,"cache_read_input_tokens":7,"output_tokens":1}}}`,
+				`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`,
+				`data: {"type":"message_delta","usage":{"output_tokens":9}}`,
+				`data: {"type":"message_delta","usage":{"output_tokens":15}}`,
+				`data: {"type":"message_stop"}`,
+			},
+			want: &model.Usage{
+				PromptTokens: 42, CompletionTokens: 15, TotalTokens: 57,
+				PromptTokensDetails: &model.PromptTokensDetails{CachedTokens: 7},
+			},
+		},
+		{
+			name: "no usage",
+			lines: []string{
+				`data: {"choices":[{"delta":{"content":"hi"}}]}`,
+				`data: [DONE]`,
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := observeLines(tt.lines); !reflect.DeepEqual(got, tt.want) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			t.Errorf("%s: usage = %s, want %s", tt.name, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestParseUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *model.Usage
+	}{
+		{
+			name: "chat completion",
+			body: `{"id":"x","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`,
+			want: &model.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+		},
+		{
+			name: "embeddings",
+			body: `{"data":[],"usage":{"prompt_tokens":6,"total_tokens":6}}`,
+			want: &model.Usage{PromptTokens: 6, TotalTokens: 6},
+		},
+		{
+			name: "responses",
+			body: `{"object":"response","usage":{"input_tokens":10,"output_tokens":2,"total_tokens":12}}`,
+			want: &model.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+		},
+		{
+			name: "anthropic message",
+			body: `{"type":"message","usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":5}}`,
+			want: &model.Usage{PromptTokens: 100, CompletionTokens: 5, TotalTokens: 105, PromptTokensDetails: &model.PromptTokensDetails{CachedTokens: 90}},
+		},
+		{name: "missing usage", body: `{"id":"x"}`, want: nil},
+		{name: "invalid json", body: `not json`, want: nil},
+	}
+	for _, tt := range tests {
+		if got := parseUsage([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			t.Errorf("%s: parseUsage = %s, want %s", tt.name, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestForceIncludeUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantStrip bool
+		wantOpts  map[string]interface{} // 处理后的 stream_options，nil 表示请求体应保持不变
+	}{
+		{
+			name:      "no stream options",
+			body:      `{"model":"m","stream":true}`,
+			wantStrip: true,
+			wantOpts:  map[string]interface{}{"include_usage": true},
+		},
+		{
+			name:      "include_usage false",
+			body:      `{"model":"m","stream":true,"stream_options":{"include_usage":false}}`,
+			wantStrip: true,
+			wantOpts:  map[string]interface{}{"include_usage": true},
+		},
+		{
+			name:      "keeps other options",
+			body:      `{"model":"m","stream":true,"stream_options":{"include_obfuscation":false}}`,
+			wantStrip: true,
+			wantOpts:  map[string]interface{}{"include_usage": true, "include_obfuscation": false},
+		},
+		{
+			name: "client already requested usage",
+			body: `{"model":"m","stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name: "invalid json",
+			body: `{"model":`,
+		},
+	}
+	for _, tt := range tests {
+		got, strip := forceIncludeUsage([]byte(tt.body))
+		if strip != tt.wantStrip {
+			t.Errorf("%s: strip = %v, want %v", tt.name, strip, tt.wantStrip)
+		}
+		if tt.wantOpts == nil {
+			if string(got) != tt.body {
+				t.Errorf("%s: body = %s, want unchanged %s", tt.name, got, tt.body)
+			}
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(got, &data); err != nil {
+			t.Errorf("%s: invalid body %s: %v", tt.name, got, err)
+			continue
+		}
+		if !reflect.DeepEqual(data["stream_options"], tt.wantOpts) {
+			t.Errorf("%s: stream_options = %v, want %v", tt.name, data["stream_options"], tt.wantOpts)
+		}
+		if data["model"] != "m" || data["stream"] != true {
+			t.Errorf("%s: other fields changed: %s", tt.name, got)
+		}
+	}
+}
+
+func TestIsUsageOnlyChunk(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{"usage chunk", `data: {"id":"x","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}` + "\n", true},
+		{"usage chunk without choices", `data:{"usage":{"prompt_tokens":1}}`, true},
+		{"content chunk with null usage", `data: {"choices":[{"delta":{"content":"hi"}}],"usage":null}`, false},
+		{"empty choices with null usage", `data: {"choices":[],"usage":null}`, false},
+		{"final chunk with usage", `data: {"choices":[{"delta":{},"finish_reason":"stop"}],"usage":{"total_tokens":3}}`, false},
+		{"content mentions usage", `data: {"choices":[{"delta":{"content":"\"usage\""}}]}`, false},
+		{"done", "data: [DONE]\n", false},
+		{"not data line", `event: {"usage":{}}`, false},
+	}
+	for _, tt := range tests {
+		if got := isUsageOnlyChunk([]byte(tt.line)); got != tt.want {
+			t.Errorf("%s: isUsageOnlyChunk = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
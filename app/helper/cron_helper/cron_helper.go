@@ -2,6 +2,7 @@ package cron_helper
 
 import (
 	"gin_base/app/middleware"
+	"gin_base/app/service/requestlog"
 	"github.com/gogits/cron"
 )
 
@@ -10,6 +11,9 @@ func InitCron() {
 	c.AddFunc("定时清理ip限制缓存", "0 */1 * * * ?", func() {
 		middleware.ClearIpRateLimit()
 	})
+	c.AddFunc("定时清理过期请求记录", "0 0 */1 * * ?", func() {
+		requestlog.Prune()
+	})
 
 	c.Start()
 }
@@ -38,6 +38,10 @@ func InitApp(initTypes ...string) {
 			}
 			db.AutoMigrate(
 				&model.User{},
+				&model.UsageStat{},
+				&model.ProviderSnapshot{},
+				&model.RequestLog{},
+				&model.RequestCapture{},
 			)
 		}
 	}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/usagestat"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyBudget 按客户端密钥的每日/每月费用上限拦截请求
+// 费用在请求完成后才计入，已超出上限后的请求才会被拒绝（单个请求可能使费用略微超出上限）
+func KeyBudget(usage *usagestat.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vk := apikey.FromContext(c)
+		if vk == nil || !vk.HasBudget() {
+			c.Next()
+			return
+		}
+
+		daily, monthly := usage.Spend(vk.Name)
+		var message string
+		switch {
+		case vk.MonthlyBudget > 0 && monthly >= vk.MonthlyBudget:
+			message = fmt.Sprintf("You exceeded your monthly budget: spent $%.4f of $%.2f. The budget resets at the start of next month.", monthly, vk.MonthlyBudget)
+		case vk.DailyBudget > 0 && daily >= vk.DailyBudget:
+			message = fmt.Sprintf("You exceeded your daily budget: spent $%.4f of $%.2f. The budget resets at midnight.", daily, vk.DailyBudget)
+		default:
+			c.Next()
+			return
+		}
+
+		code := "insufficient_quota"
+		abortError(c, http.StatusTooManyRequests, message, "insufficient_quota", &code)
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/ratelimit"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyRateLimit 按客户端密钥限制每分钟请求数（RPM）和 token 数（TPM）
+// 请求前按请求体预估 token 数预占额度，完成后按上游返回的 usage 修正；超限返回 429（/v1/messages 为 Anthropic 格式）
+func KeyRateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 未启用认证时无法区分客户端，不限流
+		vk := apikey.FromContext(c)
+		if vk == nil {
+			c.Next()
+			return
+		}
+		limits := limiter.LimitsFor(vk.RPM, vk.TPM)
+		if limits.Unlimited() {
+			c.Next()
+			return
+		}
+
+		var estimate int64
+		if limits.TPM > 0 {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				abortError(c, http.StatusBadRequest, "failed to read request body", "invalid_request_error", nil)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			estimate = ratelimit.EstimateTokens(body)
+		}
+
+		reservation, result := limiter.Reserve(vk.Name, limits, estimate)
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.Reset.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			code := "rate_limit_exceeded"
+			var message string
+			if result.Exceeded == "tokens" {
+				message = fmt.Sprintf("Rate limit reached for tokens per minute (TPM): Limit %d, Used %d, Requested %d. Please try again in %ds.",
+					limits.TPM, result.Tokens, result.Requested, retryAfter)
+			} else {
+				message = fmt.Sprintf("Rate limit reached for requests per minute (RPM): Limit %d, Used %d, Requested 1. Please try again in %ds.",
+					limits.RPM, result.Requests, retryAfter)
+			}
+			abortError(c, http.StatusTooManyRequests, message, result.Exceeded, &code)
+			return
+		}
+
+		c.Next()
+
+		// 按实际用量修正：成功但上游未返回 usage 时保留预估值，失败的请求不计 token
+		if v, exists := c.Get(model.UsageContextKey); exists {
+			if usage, ok := v.(*model.Usage); ok {
+				reservation.Commit(int64(usage.TotalTokens))
+				return
+			}
+		}
+		if c.Writer.Status() != http.StatusOK {
+			reservation.Commit(0)
+		}
+	}
+}
+
+// setRateLimitHeaders 写入 x-ratelimit-* 响应头（仅限制的维度）
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	reset := result.Reset.Round(time.Millisecond).String()
+	if result.Limits.RPM > 0 {
+		c.Header("x-ratelimit-limit-requests", strconv.FormatInt(result.Limits.RPM, 10))
+		c.Header("x-ratelimit-remaining-requests", strconv.FormatInt(remaining(result.Limits.RPM, result.Requests), 10))
+		c.Header("x-ratelimit-reset-requests", reset)
+	}
+	if result.Limits.TPM > 0 {
+		c.Header("x-ratelimit-limit-tokens", strconv.FormatInt(result.Limits.TPM, 10))
+		c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(remaining(result.Limits.TPM, result.Tokens), 10))
+		c.Header("x-ratelimit-reset-tokens", reset)
+	}
+}
+
+// remaining 剩余额度（不小于 0）
+func remaining(limit, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
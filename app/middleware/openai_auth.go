@@ -1,54 +1,82 @@
 package middleware
 
 import (
+	"fmt"
 	"gin_base/app/model"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/upstream"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // OpenAIAuthMultiKeys API Key 认证中间件
-func OpenAIAuthMultiKeys(validAPIKeys []string) gin.HandlerFunc {
-	keySet := make(map[string]struct{}, len(validAPIKeys))
-	for _, key := range validAPIKeys {
-		keySet[key] = struct{}{}
-	}
-
+// 从密钥存储中查找客户端密钥，校验启用状态、有效期和接口权限，通过后将虚拟 Key 存入上下文
+// 每次请求读取存储的最新内容，未配置任何密钥时不启用认证（配置的密钥全部无效时拒绝所有请求）
+func OpenAIAuthMultiKeys(store *apikey.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, model.NewOpenAIError(
-				"Missing Authorization header",
-				"invalid_request_error",
-				nil,
-			))
-			c.Abort()
+		if !store.AuthRequired() {
+			c.Next()
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, model.NewOpenAIError(
-				"Invalid Authorization header format. Expected: Bearer <api_key>",
-				"invalid_request_error",
-				nil,
-			))
-			c.Abort()
+		apiKey, ok := extractAPIKey(c)
+		if !ok {
 			return
 		}
 
-		apiKey := strings.TrimSpace(parts[1])
-		if _, ok := keySet[apiKey]; !ok {
-			c.JSON(http.StatusUnauthorized, model.NewOpenAIError(
-				"Invalid API key",
-				"invalid_api_key",
-				nil,
-			))
-			c.Abort()
+		vk, ok := store.Lookup(apiKey)
+		if !ok {
+			abortError(c, http.StatusUnauthorized, "Invalid API key", "invalid_api_key", nil)
+			return
+		}
+		if !vk.IsEnabled() {
+			abortError(c, http.StatusUnauthorized, "API key is disabled", "invalid_api_key", nil)
+			return
+		}
+		if vk.Expired(time.Now()) {
+			abortError(c, http.StatusUnauthorized, "API key has expired", "invalid_api_key", nil)
+			return
+		}
+		if endpoint := apikey.EndpointFromPath(c.FullPath()); !vk.AllowEndpoint(endpoint) {
+			abortError(c, http.StatusForbidden, fmt.Sprintf("API key is not allowed to access /v1/%s", endpoint), "permission_error", nil)
 			return
 		}
 
+		c.Set(apikey.ContextKey, vk)
 		c.Next()
 	}
 }
+
+// abortError 返回错误并终止请求：/v1/messages 使用 Anthropic 格式（类型按状态码映射），其余接口使用 OpenAI 格式
+func abortError(c *gin.Context, statusCode int, message, errType string, code *string) {
+	if apikey.EndpointFromPath(c.FullPath()) == apikey.EndpointMessages {
+		c.JSON(statusCode, upstream.NewAnthropicError(statusCode, message))
+	} else {
+		c.JSON(statusCode, model.NewOpenAIError(message, errType, code))
+	}
+	c.Abort()
+}
+
+// extractAPIKey 从请求头中提取 API Key
+// 优先使用 Authorization: Bearer <api_key>，兼容 Anthropic SDK 的 x-api-key 请求头
+func extractAPIKey(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		if apiKey := strings.TrimSpace(c.GetHeader("x-api-key")); apiKey != "" {
+			return apiKey, true
+		}
+		abortError(c, http.StatusUnauthorized, "Missing Authorization header", "invalid_request_error", nil)
+		return "", false
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		abortError(c, http.StatusUnauthorized, "Invalid Authorization header format. Expected: Bearer <api_key>", "invalid_request_error", nil)
+		return "", false
+	}
+
+	return strings.TrimSpace(parts[1]), true
+}
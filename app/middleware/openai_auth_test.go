@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"encoding/json"
+	"gin_base/app/service/apikey"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAIAuthErrorFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := apikey.NewStore(nil, []apikey.VirtualKey{
+		{Name: "chat-only", Key: "sk-chat-only-key", Endpoints: []string{apikey.EndpointChatCompletions}},
+	})
+	engine := gin.New()
+	v1 := engine.Group("/v1", OpenAIAuthMultiKeys(store))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	v1.POST("/chat/completions", ok)
+	v1.POST("/messages", ok)
+
+	tests := []struct {
+		name    string
+		path    string
+		header  map[string]string
+		status  int
+		want    map[string]interface{} // nil 表示不检查响应体
+		wantErr map[string]interface{} // OpenAI 格式时检查 error 中的字段
+	}{
+		{
+			name:   "messages missing key",
+			path:   "/v1/messages",
+			status: http.StatusUnauthorized,
+			want:   anthropicError("authentication_error", "Missing Authorization header"),
+		},
+		{
+			name:   "messages invalid key",
+			path:   "/v1/messages",
+			header: map[string]string{"x-api-key": "sk-unknown"},
+			status: http.StatusUnauthorized,
+			want:   anthropicError("authentication_error", "Invalid API key"),
+		},
+		{
+			name:   "messages endpoint not allowed",
+			path:   "/v1/messages",
+			header: map[string]string{"x-api-key": "sk-chat-only-key"},
+			status: http.StatusForbidden,
+			want:   anthropicError("permission_error", "API key is not allowed to access /v1/messages"),
+		},
+		{
+			name:    "chat invalid key",
+			path:    "/v1/chat/completions",
+			header:  map[string]string{"Authorization": "Bearer sk-unknown"},
+			status:  http.StatusUnauthorized,
+			wantErr: map[string]interface{}{"message": "Invalid API key", "type": "invalid_api_key"},
+		},
+		{
+			name:   "chat allowed",
+			path:   "/v1/chat/completions",
+			header: map[string]string{"Authorization": "Bearer sk-chat-only-key"},
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.want == nil && tt.wantErr == nil {
+			continue
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("%s: invalid body %s: %v", tt.name, w.Body.String(), err)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: body = %s, want %v", tt.name, w.Body.String(), tt.want)
+		}
+		if tt.wantErr != nil {
+			detail, _ := got["error"].(map[string]interface{})
+			for k, v := range tt.wantErr {
+				if detail[k] != v {
+					t.Errorf("%s: error.%s = %v, want %v", tt.name, k, detail[k], v)
+				}
+			}
+		}
+	}
+}
+
+func TestAbortErrorFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	limited := func(c *gin.Context) {
+		code := "rate_limit_exceeded"
+		abortError(c, http.StatusTooManyRequests, "slow down", "requests", &code)
+	}
+	engine.POST("/v1/chat/completions", limited)
+	engine.POST("/v1/messages", limited)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/v1/messages", want: `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`},
+		{path: "/v1/chat/completions", want: `{"error":{"message":"slow down","type":"requests","param":null,"code":"rate_limit_exceeded"}}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, http.StatusTooManyRequests)
+		}
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+// anthropicError Anthropic 格式的错误响应体
+func anthropicError(errType, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errType, "message": message},
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracing 为每个客户端请求创建根跨度（请求头带 traceparent 时延续调用方的链路），未启用追踪时直接放行
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqCtx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		reqCtx, span := tracing.Start(reqCtx, c.Request.Method+" "+c.FullPath(), tracing.KindServer,
+			"http.method", c.Request.Method,
+			"http.route", c.FullPath(),
+			"client.ip", c.ClientIP(),
+		)
+		if span == nil {
+			c.Next()
+			return
+		}
+		c.Request = c.Request.WithContext(reqCtx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes("http.status_code", status, "response.bytes", c.Writer.Size())
+		if vk := apikey.FromContext(c); vk != nil {
+			span.SetAttributes("client.key_name", vk.Name)
+		}
+		if status >= 500 {
+			span.SetError(fmt.Errorf("request failed with status %d", status))
+		} else {
+			span.SetOK()
+		}
+		span.End()
+	}
+}
@@ -14,6 +14,7 @@ type ChatCompletionRequest struct {
 	LogitBias           map[string]float64 `json:"logit_bias,omitempty"`
 	Logprobs            *bool              `json:"logprobs,omitempty"`
 	MaxCompletionTokens *int               `json:"max_completion_tokens,omitempty"`
+	MaxTokens           *int               `json:"max_tokens,omitempty"` // 已废弃但仍被大量兼容上游使用
 	Metadata            map[string]string  `json:"metadata,omitempty"`
 	Modalities          []string           `json:"modalities,omitempty"`
 	N                   *int               `json:"n,omitempty"`
@@ -43,7 +44,7 @@ type ChatCompletionRequest struct {
 
 // ChatMessage 聊天消息
 type ChatMessage struct {
-	Role       string      `json:"role" binding:"required"`
+	Role       string      `json:"role,omitempty" binding:"required"`
 	Content    interface{} `json:"content"` // 可以是 string 或 []ContentPart
 	Name       string      `json:"name,omitempty"`
 	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
@@ -93,6 +94,7 @@ type FunctionDefinition struct {
 
 // ToolCall 工具调用
 type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // 流式响应中的工具调用序号
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
@@ -159,6 +161,9 @@ type Choice struct {
 	Logprobs     interface{}  `json:"logprobs,omitempty"`
 }
 
+// UsageContextKey 请求完成后 token 用量（*Usage，多次尝试累加）存放在 gin 上下文中的键名
+const UsageContextKey = "usage"
+
 // Usage 使用量统计
 type Usage struct {
 	PromptTokens            int                      `json:"prompt_tokens"`
@@ -194,6 +199,15 @@ type ChatCompletionChunk struct {
 	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
 }
 
+// EmbeddingRequest OpenAI 向量请求
+type EmbeddingRequest struct {
+	Model          string      `json:"model" binding:"required"`
+	Input          interface{} `json:"input" binding:"required"` // 可以是 string、[]string、[]int 或 [][]int
+	EncodingFormat string      `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
+
 // ModelsResponse 模型列表响应
 type ModelsResponse struct {
 	Object string      `json:"object"`
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"gin_base/app/helper/type_helper"
+)
+
+// ProviderSnapshot 供应商统计与健康状态快照（每个供应商一行，用于重启后恢复）
+type ProviderSnapshot struct {
+	Id        uint             `gorm:"primarykey;autoIncrement;comment:供应商统计快照表" json:"id"`
+	Name      string           `gorm:"type:varchar(100);not null;default:'';unique;comment:供应商名称" json:"name"`
+	Data      string           `gorm:"type:text;comment:快照数据（JSON）" json:"data"`
+	CreatedAt type_helper.Time `gorm:"comment:创建时间" json:"created_at"`
+	UpdatedAt type_helper.Time `gorm:"comment:更新时间" json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"gin_base/app/helper/type_helper"
+)
+
+// RequestCapture 代理请求的请求体/响应体采集（与请求记录一对一）
+type RequestCapture struct {
+	Id           uint             `gorm:"primarykey;autoIncrement;comment:请求体采集表" json:"id"`
+	RequestLogId uint             `gorm:"not null;default:0;uniqueIndex;comment:请求记录ID" json:"request_log_id"`
+	RequestBody  string           `gorm:"type:text;comment:客户端请求体" json:"request_body"`
+	Attempts     string           `gorm:"type:text;comment:各次尝试的上游请求体与响应体（JSON）" json:"attempts"`
+	ResponseBody string           `gorm:"type:text;comment:返回客户端的响应体（流式为完整事件流）" json:"response_body"`
+	CreatedAt    type_helper.Time `gorm:"index;comment:创建时间" json:"created_at"`
+}
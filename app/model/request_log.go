@@ -0,0 +1,32 @@
+package model
+
+import (
+	"gin_base/app/helper/type_helper"
+)
+
+// RequestLog 代理请求记录（每个客户端请求一行）
+type RequestLog struct {
+	Id               uint             `gorm:"primarykey;autoIncrement;comment:代理请求记录表" json:"id"`
+	RequestId        string           `gorm:"type:varchar(32);not null;default:'';index;comment:请求ID" json:"request_id"`
+	KeyName          string           `gorm:"type:varchar(100);not null;default:'';index;comment:客户端密钥名称" json:"key_name"`
+	Endpoint         string           `gorm:"type:varchar(50);not null;default:'';comment:接口" json:"endpoint"`
+	Alias            string           `gorm:"type:varchar(100);not null;default:'';index;comment:模型别名" json:"alias"`
+	Stream           bool             `gorm:"not null;default:false;comment:是否流式" json:"stream"`
+	Provider         string           `gorm:"type:varchar(100);not null;default:'';index;comment:最终使用的供应商" json:"provider"`
+	UpstreamModel    string           `gorm:"type:varchar(100);not null;default:'';comment:最终使用的上游模型" json:"upstream_model"`
+	Attempts         int              `gorm:"not null;default:0;comment:上游尝试次数" json:"attempts"`
+	AttemptDetails   string           `gorm:"type:text;comment:各次尝试详情（JSON）" json:"attempt_details"`
+	Status           int              `gorm:"not null;default:0;index;comment:返回客户端的状态码" json:"status"`
+	LatencyMs        int64            `gorm:"not null;default:0;comment:总耗时（毫秒）" json:"latency_ms"`
+	TtftMs           int64            `gorm:"not null;default:0;comment:首Token时间（毫秒）" json:"ttft_ms"`
+	PromptTokens     int              `gorm:"not null;default:0;comment:输入token数" json:"prompt_tokens"`
+	CompletionTokens int              `gorm:"not null;default:0;comment:输出token数" json:"completion_tokens"`
+	CachedTokens     int              `gorm:"not null;default:0;comment:命中缓存的输入token数" json:"cached_tokens"`
+	ReasoningTokens  int              `gorm:"not null;default:0;comment:推理token数" json:"reasoning_tokens"`
+	TotalTokens      int              `gorm:"not null;default:0;comment:总token数" json:"total_tokens"`
+	Cost             float64          `gorm:"not null;default:0;comment:费用（美元）" json:"cost"`
+	Error            string           `gorm:"type:text;comment:失败原因" json:"error"`
+	CacheHit         bool             `gorm:"not null;default:false;comment:是否命中响应缓存" json:"cache_hit"`
+	Captured         bool             `gorm:"not null;default:false;comment:是否采集了请求体/响应体" json:"captured"`
+	CreatedAt        type_helper.Time `gorm:"index;comment:请求时间" json:"created_at"`
+}
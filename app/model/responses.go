@@ -0,0 +1,151 @@
+package model
+
+import "encoding/json"
+
+// ResponsesRequest OpenAI Responses 请求
+type ResponsesRequest struct {
+	// 必填参数
+	Model string `json:"model" binding:"required"`
+
+	// 输入：可以是 string 或 []ResponsesInputItem
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// 可选参数
+	Instructions       string              `json:"instructions,omitempty"`
+	MaxOutputTokens    *int                `json:"max_output_tokens,omitempty"`
+	Metadata           map[string]string   `json:"metadata,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	Text               *ResponsesText      `json:"text,omitempty"`
+	ToolChoice         interface{}         `json:"tool_choice,omitempty"`
+	Tools              []ResponsesTool     `json:"tools,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+	User               string              `json:"user,omitempty"`
+}
+
+// ResponsesReasoning 推理配置
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponsesText 文本输出配置
+type ResponsesText struct {
+	Format    *ResponsesTextFormat `json:"format,omitempty"`
+	Verbosity string               `json:"verbosity,omitempty"`
+}
+
+// ResponsesTextFormat 文本输出格式
+type ResponsesTextFormat struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema,omitempty"`
+	Strict      *bool       `json:"strict,omitempty"`
+}
+
+// ResponsesTool 工具定义（Responses 中函数工具为扁平结构）
+type ResponsesTool struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+	Strict      *bool       `json:"strict,omitempty"`
+}
+
+// ResponsesInputItem 输入项（消息、函数调用、函数调用结果）
+type ResponsesInputItem struct {
+	Type    string          `json:"type,omitempty"`
+	Role    string          `json:"role,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"` // 可以是 string 或 []ResponsesContentPart
+
+	// type=function_call / function_call_output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// ResponsesContentPart 输入/输出内容部分
+type ResponsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// ResponsesOutputContent 输出内容部分（output_text）
+type ResponsesOutputContent struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// ResponsesResponse OpenAI Responses 响应
+type ResponsesResponse struct {
+	ID                string                      `json:"id"`
+	Object            string                      `json:"object"`
+	CreatedAt         int64                       `json:"created_at"`
+	Status            string                      `json:"status"`
+	Model             string                      `json:"model"`
+	Output            []ResponsesOutputItem       `json:"output"`
+	IncompleteDetails *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Usage             *ResponsesUsage             `json:"usage,omitempty"`
+}
+
+// ResponsesIncompleteDetails 未完成原因
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// ResponsesOutputItem 输出项（message 或 function_call）
+type ResponsesOutputItem struct {
+	Type      string                   `json:"type"`
+	ID        string                   `json:"id"`
+	Status    string                   `json:"status,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	CallID    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments string                   `json:"arguments,omitempty"`
+}
+
+// ResponsesUsage 使用量统计
+type ResponsesUsage struct {
+	InputTokens         int                           `json:"input_tokens"`
+	OutputTokens        int                           `json:"output_tokens"`
+	TotalTokens         int                           `json:"total_tokens"`
+	InputTokensDetails  *ResponsesInputTokensDetails  `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *ResponsesOutputTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+// ResponsesInputTokensDetails 输入 token 详情
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// ResponsesOutputTokensDetails 输出 token 详情
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ResponsesStreamEvent 流式事件（按 type 区分，字段按需填充）
+type ResponsesStreamEvent struct {
+	Type           string                  `json:"type"`
+	SequenceNumber int                     `json:"sequence_number"`
+	Response       *ResponsesResponse      `json:"response,omitempty"`
+	OutputIndex    *int                    `json:"output_index,omitempty"`
+	ContentIndex   *int                    `json:"content_index,omitempty"`
+	ItemID         string                  `json:"item_id,omitempty"`
+	Item           *ResponsesOutputItem    `json:"item,omitempty"`
+	Part           *ResponsesOutputContent `json:"part,omitempty"`
+	Delta          string                  `json:"delta,omitempty"`
+	Text           string                  `json:"text,omitempty"`
+	Arguments      string                  `json:"arguments,omitempty"`
+	Code           string                  `json:"code,omitempty"`
+	Message        string                  `json:"message,omitempty"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"gin_base/app/helper/type_helper"
+	"time"
+)
+
+// UsageStat token 用量统计（按小时、客户端密钥、模型别名、供应商、上游模型汇总）
+type UsageStat struct {
+	Id               uint             `gorm:"primarykey;autoIncrement;comment:token 用量统计表" json:"id"`
+	Hour             time.Time        `gorm:"not null;uniqueIndex:idx_usage_stat_dim;comment:统计小时" json:"hour"`
+	KeyName          string           `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_usage_stat_dim;comment:客户端密钥名称" json:"key_name"`
+	Alias            string           `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_usage_stat_dim;comment:模型别名" json:"alias"`
+	Provider         string           `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_usage_stat_dim;comment:供应商" json:"provider"`
+	UpstreamModel    string           `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_usage_stat_dim;comment:上游模型" json:"upstream_model"`
+	Requests         int64            `gorm:"not null;default:0;comment:请求数" json:"requests"`
+	CacheHits        int64            `gorm:"not null;default:0;comment:命中响应缓存的请求数" json:"cache_hits"`
+	PromptTokens     int64            `gorm:"not null;default:0;comment:输入token数" json:"prompt_tokens"`
+	CompletionTokens int64            `gorm:"not null;default:0;comment:输出token数" json:"completion_tokens"`
+	CachedTokens     int64            `gorm:"not null;default:0;comment:命中缓存的输入token数" json:"cached_tokens"`
+	ReasoningTokens  int64            `gorm:"not null;default:0;comment:推理token数" json:"reasoning_tokens"`
+	TotalTokens      int64            `gorm:"not null;default:0;comment:总token数" json:"total_tokens"`
+	Cost             float64          `gorm:"not null;default:0;comment:费用（美元）" json:"cost"`
+	CreatedAt        type_helper.Time `gorm:"comment:创建时间" json:"created_at"`
+	UpdatedAt        type_helper.Time `gorm:"comment:更新时间" json:"updated_at"`
+}
@@ -0,0 +1,182 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey 认证通过后，当前请求的虚拟 Key 存放在 gin 上下文中的键名
+const ContextKey = "virtual_key"
+
+// 可授权的接口（对应 /v1 下的路径）
+const (
+	EndpointChatCompletions = "chat/completions"
+	EndpointResponses       = "responses"
+	EndpointEmbeddings      = "embeddings"
+	EndpointMessages        = "messages"
+	EndpointModels          = "models"
+)
+
+// Endpoints 所有可授权的接口
+var Endpoints = []string{EndpointChatCompletions, EndpointResponses, EndpointEmbeddings, EndpointMessages, EndpointModels}
+
+// VirtualKey 虚拟 API Key：客户端使用的密钥及其权限
+type VirtualKey struct {
+	Key       string   `json:"key" yaml:"key" mapstructure:"key"`                                          // 客户端使用的密钥
+	Name      string   `json:"name" yaml:"name" mapstructure:"name"`                                       // 名称（唯一，用于管理和统计）
+	Owner     string   `json:"owner,omitempty" yaml:"owner,omitempty" mapstructure:"owner"`                // 所属团队/负责人
+	Models    []string `json:"models,omitempty" yaml:"models,omitempty" mapstructure:"models"`             // 允许使用的模型别名（支持 * 通配），为空不限制
+	Endpoints []string `json:"endpoints,omitempty" yaml:"endpoints,omitempty" mapstructure:"endpoints"`    // 允许访问的接口，为空不限制
+	ExpiresAt string   `json:"expires_at,omitempty" yaml:"expires_at,omitempty" mapstructure:"expires_at"` // 过期时间（RFC3339 或 2006-01-02），为空永不过期
+	Enabled   *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty" mapstructure:"enabled"`          // 是否启用（默认启用）
+	RPM       int      `json:"rpm,omitempty" yaml:"rpm,omitempty" mapstructure:"rpm"`                      // 每分钟请求数上限，0 使用全局默认，-1 不限制
+	TPM       int      `json:"tpm,omitempty" yaml:"tpm,omitempty" mapstructure:"tpm"`                      // 每分钟 token 数上限，0 使用全局默认，-1 不限制
+
+	DailyBudget   float64 `json:"daily_budget,omitempty" yaml:"daily_budget,omitempty" mapstructure:"daily_budget"`       // 每日费用上限（美元），0 不限制
+	MonthlyBudget float64 `json:"monthly_budget,omitempty" yaml:"monthly_budget,omitempty" mapstructure:"monthly_budget"` // 每月费用上限（美元），0 不限制
+
+	expiresAt time.Time // 解析后的过期时间
+}
+
+// HasBudget 是否设置了费用上限
+func (k *VirtualKey) HasBudget() bool {
+	return k.DailyBudget > 0 || k.MonthlyBudget > 0
+}
+
+// IsEnabled 是否启用
+func (k *VirtualKey) IsEnabled() bool {
+	return k.Enabled == nil || *k.Enabled
+}
+
+// Expired 是否已过期
+func (k *VirtualKey) Expired(now time.Time) bool {
+	return !k.expiresAt.IsZero() && !now.Before(k.expiresAt)
+}
+
+// AllowModel 是否允许使用该模型别名
+func (k *VirtualKey) AllowModel(alias string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+	for _, pattern := range k.Models {
+		if pattern == alias {
+			return true
+		}
+		if matched, err := path.Match(pattern, alias); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowEndpoint 是否允许访问该接口
+func (k *VirtualKey) AllowEndpoint(endpoint string) bool {
+	if len(k.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range k.Endpoints {
+		if strings.Trim(e, "/") == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验配置并解析过期时间
+func (k *VirtualKey) Validate() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(k.Key) == "" {
+		return fmt.Errorf("key is required")
+	}
+	for _, e := range k.Endpoints {
+		if !isEndpoint(strings.Trim(e, "/")) {
+			return fmt.Errorf("unknown endpoint %q, expected one of %s", e, strings.Join(Endpoints, ", "))
+		}
+	}
+	for _, pattern := range k.Models {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q", pattern)
+		}
+	}
+	if k.DailyBudget < 0 || k.MonthlyBudget < 0 {
+		return fmt.Errorf("budget must not be negative")
+	}
+	k.expiresAt = time.Time{}
+	if k.ExpiresAt != "" {
+		t, err := parseExpiresAt(k.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		k.expiresAt = t
+	}
+	return nil
+}
+
+// isEndpoint 是否为可授权的接口
+func isEndpoint(endpoint string) bool {
+	for _, e := range Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpiresAt 解析过期时间，支持 RFC3339 和日期（当天 0 点，本地时区）
+func parseExpiresAt(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires_at %q, expected RFC3339 or 2006-01-02", value)
+}
+
+// EndpointFromPath 从路由路径（如 /v1/chat/completions、/v1/models/:model）获取接口名
+func EndpointFromPath(fullPath string) string {
+	endpoint := strings.TrimPrefix(fullPath, "/v1/")
+	if strings.HasPrefix(endpoint, EndpointModels) {
+		return EndpointModels
+	}
+	return endpoint
+}
+
+// GenerateKey 生成随机密钥
+func GenerateKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "sk-" + hex.EncodeToString(b)
+}
+
+// MaskKey 密钥脱敏显示
+func MaskKey(key string) string {
+	if len(key) <= 10 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
+
+// FromContext 获取当前请求的虚拟 Key，未启用认证时返回 nil
+func FromContext(ctx *gin.Context) *VirtualKey {
+	if v, exists := ctx.Get(ContextKey); exists {
+		if key, ok := v.(*VirtualKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// AllowModel 当前请求是否允许使用该模型别名（未启用认证时不限制）
+func AllowModel(ctx *gin.Context, alias string) bool {
+	key := FromContext(ctx)
+	return key == nil || key.AllowModel(alias)
+}
@@ -0,0 +1,104 @@
+package apikey
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"strings"
+	"sync"
+)
+
+// Store 客户端密钥存储：合并 api_keys（不限权限）与 virtual_keys，供认证中间件查找
+type Store struct {
+	mu          sync.RWMutex
+	keys        map[string]*VirtualKey
+	apiKeys     []string
+	virtualKeys []VirtualKey
+	configured  int // 配置的密钥数量（含无效被跳过的，用于判断是否启用认证）
+}
+
+// NewStore 创建密钥存储
+func NewStore(apiKeys []string, virtualKeys []VirtualKey) *Store {
+	s := &Store{}
+	s.Update(apiKeys, virtualKeys)
+	return s
+}
+
+// Update 整体替换密钥（配置无效的虚拟 Key 记录警告后跳过，但仍计入已配置的密钥，认证保持启用）
+func (s *Store) Update(apiKeys []string, virtualKeys []VirtualKey) {
+	keys := make(map[string]*VirtualKey, len(apiKeys)+len(virtualKeys))
+	configured := len(virtualKeys)
+	for _, key := range apiKeys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		configured++
+		// api_keys 中的密钥视为不限权限的虚拟 Key，以脱敏密钥作为名称
+		keys[key] = &VirtualKey{Key: key, Name: MaskKey(key)}
+	}
+
+	names := make(map[string]struct{}, len(virtualKeys))
+	valid := make([]VirtualKey, 0, len(virtualKeys))
+	for _, vk := range virtualKeys {
+		vk := vk
+		if err := vk.Validate(); err != nil {
+			log_helper.Warning(fmt.Sprintf("Virtual key %q ignored: %v", vk.Name, err))
+			continue
+		}
+		if _, exists := names[vk.Name]; exists {
+			log_helper.Warning(fmt.Sprintf("Virtual key %q ignored: duplicate name", vk.Name))
+			continue
+		}
+		if _, exists := keys[vk.Key]; exists {
+			log_helper.Warning(fmt.Sprintf("Virtual key %q ignored: duplicate key", vk.Name))
+			continue
+		}
+		names[vk.Name] = struct{}{}
+		keys[vk.Key] = &vk
+		valid = append(valid, vk)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.apiKeys = apiKeys
+	s.virtualKeys = valid
+	s.configured = configured
+	if configured > 0 && len(keys) == 0 {
+		log_helper.Warning("All configured client keys are invalid, all /v1 requests will be rejected")
+	}
+}
+
+// SetAPIKeys 替换 api_keys（保留虚拟 Key）
+func (s *Store) SetAPIKeys(apiKeys []string) {
+	s.Update(apiKeys, s.VirtualKeys())
+}
+
+// Lookup 按密钥查找
+func (s *Store) Lookup(key string) (*VirtualKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vk, ok := s.keys[key]
+	return vk, ok
+}
+
+// AuthRequired 是否启用认证：配置了任何密钥时启用（即使全部无效也不会放行未认证的请求）
+func (s *Store) AuthRequired() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.configured > 0
+}
+
+// APIKeys 获取 api_keys
+func (s *Store) APIKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.apiKeys...)
+}
+
+// VirtualKeys 获取有效的虚拟 Key 列表
+func (s *Store) VirtualKeys() []VirtualKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]VirtualKey(nil), s.virtualKeys...)
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// collector 可导出的指标（以 Prometheus 文本格式写出）
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector // 按注册顺序导出
+)
+
+// register 注册指标
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText 以 Prometheus 文本格式写出所有已注册的指标
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// series 一组标签值对应的数据
+type series struct {
+	labelValues []string
+	value       float64  // counter / gauge 的值
+	buckets     []uint64 // histogram 各桶（不含 +Inf）的计数，非累计
+	count       uint64   // histogram 样本数
+	sum         float64  // histogram 样本和
+}
+
+// vec 带标签的指标
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64 // histogram 桶上界（升序）
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// newVec 创建并注册指标
+func newVec(name, help, kind string, buckets []float64, labelNames []string) *vec {
+	v := &vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	register(v)
+	return v
+}
+
+// get 获取标签值对应的数据（不存在时创建），调用方需持有锁
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if v.kind == typeHistogram {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// write 写出该指标的所有数据（按标签值排序，保证输出稳定）
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.series) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	for _, key := range keys {
+		s := v.series[key]
+		labels := formatLabels(v.labelNames, s.labelValues)
+		if v.kind != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, wrapLabels(joinLabels(labels, `le="`+formatFloat(bound)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, wrapLabels(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, wrapLabels(labels), s.count)
+	}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct{ v *vec }
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{v: newVec(name, help, typeCounter, nil, labelNames)}
+}
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加 delta（负数忽略）
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.get(labelValues).value += delta
+}
+
+// GaugeVec 带标签的仪表盘（通常在导出前按当前状态重新设置）
+type GaugeVec struct{ v *vec }
+
+// NewGaugeVec 创建并注册仪表盘
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{v: newVec(name, help, typeGauge, nil, labelNames)}
+}
+
+// Set 设置值
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.get(labelValues).value = value
+}
+
+// Reset 清空所有数据（用于移除已不存在的标签组合）
+func (g *GaugeVec) Reset() {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.series = make(map[string]*series)
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct{ v *vec }
+
+// NewHistogramVec 创建并注册直方图，buckets 为升序的桶上界
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{v: newVec(name, help, typeHistogram, buckets, labelNames)}
+}
+
+// Observe 记录一个样本
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	s := h.v.get(labelValues)
+	for i, bound := range h.v.buckets {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// formatLabels 格式化标签（不含花括号）
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+// joinLabels 追加一个标签
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+// wrapLabels 为非空标签加上花括号
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// escapeLabel 转义标签值中的反斜杠、双引号和换行
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// escapeHelp 转义帮助文本中的反斜杠和换行
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat 格式化数值
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"gin_base/app/helper/cache_helper"
+	"time"
+)
+
+// 计数后端
+const (
+	BackendMemory = "memory" // 进程内计数（默认）
+	BackendRedis  = "redis"  // Redis 计数，多个网关实例共享限额
+)
+
+// Backend 限流计数后端
+type Backend interface {
+	// IncrBy 累加计数并返回累加后的值，首次创建时设置过期时间
+	IncrBy(key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// memoryBackend 基于进程内缓存的计数
+type memoryBackend struct{}
+
+func (memoryBackend) IncrBy(key string, n int64, ttl time.Duration) (int64, error) {
+	c := cache_helper.GoCache()
+	// 已存在时 Add 失败，直接累加
+	c.Add(key, int64(0), ttl)
+	return c.IncrementInt64(key, n)
+}
+
+// redisIncrScript 累加计数，首次创建时设置过期时间
+const redisIncrScript = `
+local current = redis.call('incrby', KEYS[1], ARGV[1])
+if redis.call('ttl', KEYS[1]) < 0 then
+	redis.call('expire', KEYS[1], ARGV[2])
+end
+return current
+`
+
+// redisBackend 基于 Redis 的计数
+type redisBackend struct {
+	connection string
+}
+
+func (b redisBackend) IncrBy(key string, n int64, ttl time.Duration) (int64, error) {
+	client := cache_helper.RedisHelper(b.connection).Client
+	return client.Eval(context.Background(), redisIncrScript, []string{key}, n, int(ttl.Seconds())).Int64()
+}
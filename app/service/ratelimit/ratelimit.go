@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin_base/app/appconfig"
+	"gin_base/app/helper/log_helper"
+	"sync/atomic"
+	"time"
+)
+
+// window 限流窗口（固定窗口，按自然分钟计数）
+const window = time.Minute
+
+// Limits 限额（0 表示不限制）
+type Limits struct {
+	RPM int64
+	TPM int64
+}
+
+// Unlimited 是否不限制
+func (l Limits) Unlimited() bool {
+	return l.RPM <= 0 && l.TPM <= 0
+}
+
+// Result 限流检查结果（用于生成 x-ratelimit-* 响应头）
+type Result struct {
+	Allowed   bool
+	Limits    Limits
+	Requests  int64         // 当前窗口已用请求数（含本次）
+	Tokens    int64         // 当前窗口已用 token 数（含本次预占）
+	Requested int64         // 本次请求预估的 token 数
+	Reset     time.Duration // 距窗口重置的时间
+	Exceeded  string        // 超限的维度：requests / tokens
+}
+
+// Limiter 按客户端密钥限制每分钟请求数和 token 数
+type Limiter struct {
+	backend    Backend
+	defaultRPM atomic.Int64
+	defaultTPM atomic.Int64
+}
+
+// NewLimiter 创建限流器（计数后端在启动时确定，默认限额可热重载）
+func NewLimiter(cfg appconfig.RateLimitConfig) *Limiter {
+	l := &Limiter{backend: memoryBackend{}}
+	if cfg.Backend == BackendRedis {
+		connection := cfg.RedisConnection
+		if connection == "" {
+			connection = "default"
+		}
+		l.backend = redisBackend{connection: connection}
+	} else if cfg.Backend != "" && cfg.Backend != BackendMemory {
+		log_helper.Warning(fmt.Sprintf("Unknown rate limit backend %q, falling back to %s", cfg.Backend, BackendMemory))
+	}
+	l.SetDefaults(cfg)
+	return l
+}
+
+// SetDefaults 设置客户端密钥未单独配置时的默认限额
+func (l *Limiter) SetDefaults(cfg appconfig.RateLimitConfig) {
+	l.defaultRPM.Store(int64(cfg.RPM))
+	l.defaultTPM.Store(int64(cfg.TPM))
+}
+
+// LimitsFor 计算客户端密钥生效的限额：大于 0 使用自身配置，小于 0 不限制，为 0 使用默认限额
+func (l *Limiter) LimitsFor(rpm, tpm int) Limits {
+	pick := func(v int, def int64) int64 {
+		if v != 0 {
+			return int64(v)
+		}
+		return def
+	}
+	return Limits{RPM: pick(rpm, l.defaultRPM.Load()), TPM: pick(tpm, l.defaultTPM.Load())}
+}
+
+// Reservation 一次请求预占的额度，请求完成后按实际用量修正
+type Reservation struct {
+	limiter *Limiter
+	name    string
+	window  int64
+	tokens  int64 // 预占的 token 数
+	limited bool  // 是否限制 token 数（不限制时无需修正）
+}
+
+// Reserve 检查并预占一次请求和预估的 token 数，超限时不预占
+// 当前窗口尚无 token 用量时总是放行，避免预估值超过限额的单个请求永远无法通过
+func (l *Limiter) Reserve(name string, limits Limits, tokens int64) (*Reservation, Result) {
+	now := time.Now()
+	win := now.Unix() / int64(window.Seconds())
+	res := Result{
+		Allowed:   true,
+		Limits:    limits,
+		Requested: tokens,
+		Reset:     time.Unix((win+1)*int64(window.Seconds()), 0).Sub(now),
+	}
+	requestsKey := counterKey("requests", name, win)
+	tokensKey := counterKey("tokens", name, win)
+
+	if limits.RPM > 0 {
+		n, err := l.incr(requestsKey, 1)
+		if err == nil {
+			res.Requests = n
+			if n > limits.RPM {
+				l.incr(requestsKey, -1)
+				res.Requests = n - 1
+				res.Allowed = false
+				res.Exceeded = "requests"
+				if limits.TPM > 0 {
+					res.Tokens, _ = l.incr(tokensKey, 0)
+				}
+				return nil, res
+			}
+		}
+	}
+
+	if limits.TPM > 0 {
+		n, err := l.incr(tokensKey, tokens)
+		if err == nil {
+			res.Tokens = n
+			if n > limits.TPM && n-tokens > 0 {
+				l.incr(tokensKey, -tokens)
+				if limits.RPM > 0 {
+					l.incr(requestsKey, -1)
+				}
+				res.Tokens = n - tokens
+				res.Allowed = false
+				res.Exceeded = "tokens"
+				return nil, res
+			}
+		}
+	}
+
+	return &Reservation{limiter: l, name: name, window: win, tokens: tokens, limited: limits.TPM > 0}, res
+}
+
+// Commit 按实际 token 用量修正预占额度
+// 请求跨越窗口时，实际用量计入当前窗口
+func (r *Reservation) Commit(actual int64) {
+	if r == nil || !r.limited {
+		return
+	}
+	win := time.Now().Unix() / int64(window.Seconds())
+	delta := actual
+	if win == r.window {
+		delta = actual - r.tokens
+	}
+	if delta != 0 {
+		r.limiter.incr(counterKey("tokens", r.name, win), delta)
+	}
+}
+
+// incr 累加计数，后端异常时记录警告并放行（限流不影响网关可用性）
+func (l *Limiter) incr(key string, n int64) (int64, error) {
+	v, err := l.backend.IncrBy(key, n, 2*window)
+	if err != nil {
+		log_helper.Warning(fmt.Sprintf("Rate limit counter %s unavailable, request allowed: %v", key, err))
+	}
+	return v, err
+}
+
+// counterKey 计数键
+func counterKey(kind, name string, win int64) string {
+	return fmt.Sprintf("ratelimit:%s:%s:%d", kind, name, win)
+}
+
+// EstimateTokens 请求的预估 token 数：请求体长度按 4 字节/token 估算输入，加上请求的最大输出 token 数
+func EstimateTokens(body []byte) int64 {
+	var probe struct {
+		MaxTokens           int64 `json:"max_tokens"`
+		MaxCompletionTokens int64 `json:"max_completion_tokens"`
+		MaxOutputTokens     int64 `json:"max_output_tokens"`
+	}
+	json.Unmarshal(body, &probe)
+	output := probe.MaxTokens
+	if probe.MaxCompletionTokens > output {
+		output = probe.MaxCompletionTokens
+	}
+	if probe.MaxOutputTokens > output {
+		output = probe.MaxOutputTokens
+	}
+	return int64(len(body))/4 + output
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestLimiter 创建使用进程内计数的限流器，name 加上时间戳避免不同用例共用计数
+func newTestLimiter(t *testing.T) (*Limiter, string) {
+	return &Limiter{backend: memoryBackend{}}, fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+func TestReserveRequests(t *testing.T) {
+	l, name := newTestLimiter(t)
+	limits := Limits{RPM: 2}
+	for i := 1; i <= 2; i++ {
+		if _, res := l.Reserve(name, limits, 10); !res.Allowed || res.Requests != int64(i) {
+			t.Fatalf("request %d: allowed = %v, requests = %d", i, res.Allowed, res.Requests)
+		}
+	}
+	r, res := l.Reserve(name, limits, 10)
+	if r != nil || res.Allowed || res.Exceeded != "requests" || res.Requests != 2 {
+		t.Fatalf("request 3: reservation = %v, result = %+v, want rejected on requests", r, res)
+	}
+	if res.Reset <= 0 || res.Reset > window {
+		t.Errorf("reset = %v, want within one window", res.Reset)
+	}
+}
+
+func TestReserveTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserves []int64 // 依次预占的 token 数
+		want     []bool  // 每次是否放行
+	}{
+		{"within limit", []int64{40, 60}, []bool{true, true}},
+		{"exceeds limit", []int64{60, 50}, []bool{true, false}},
+		{"oversized first request allowed", []int64{150, 1}, []bool{true, false}},
+		{"rejected request does not consume", []int64{80, 30, 20}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, name := newTestLimiter(t)
+			for i, tokens := range tt.reserves {
+				r, res := l.Reserve(name, Limits{TPM: 100}, tokens)
+				if res.Allowed != tt.want[i] || (r != nil) != tt.want[i] {
+					t.Fatalf("reserve %d (%d tokens): allowed = %v, want %v (result %+v)", i, tokens, res.Allowed, tt.want[i], res)
+				}
+				if !res.Allowed && res.Exceeded != "tokens" {
+					t.Errorf("reserve %d: exceeded = %q, want tokens", i, res.Exceeded)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveTokensReleasesRequest(t *testing.T) {
+	l, name := newTestLimiter(t)
+	limits := Limits{RPM: 10, TPM: 100}
+	l.Reserve(name, limits, 90)
+	if _, res := l.Reserve(name, limits, 20); res.Allowed {
+		t.Fatalf("second reserve allowed, want rejected on tokens")
+	}
+	_, res := l.Reserve(name, limits, 5)
+	if !res.Allowed || res.Requests != 2 || res.Tokens != 95 {
+		t.Fatalf("third reserve: result = %+v, want allowed with 2 requests and 95 tokens", res)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	tests := []struct {
+		name       string
+		reserved   int64
+		actual     int64
+		next       int64 // 修正后再预占的 token 数
+		wantNext   bool
+		wantTokens int64 // 再次预占后窗口内的 token 数
+	}{
+		{"actual lower than estimate", 80, 20, 70, true, 90},
+		{"actual higher than estimate", 20, 80, 30, false, 80},
+		{"actual equals estimate", 50, 50, 50, true, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, name := newTestLimiter(t)
+			limits := Limits{TPM: 100}
+			r, res := l.Reserve(name, limits, tt.reserved)
+			if !res.Allowed {
+				t.Fatalf("first reserve rejected: %+v", res)
+			}
+			r.Commit(tt.actual)
+			_, res = l.Reserve(name, limits, tt.next)
+			if res.Allowed != tt.wantNext || res.Tokens != tt.wantTokens {
+				t.Fatalf("next reserve: allowed = %v, tokens = %d, want %v, %d", res.Allowed, res.Tokens, tt.wantNext, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestCommitWithoutTokenLimit(t *testing.T) {
+	l, name := newTestLimiter(t)
+	r, res := l.Reserve(name, Limits{RPM: 5}, 100)
+	if !res.Allowed || r == nil {
+		t.Fatalf("reserve rejected: %+v", res)
+	}
+	r.Commit(1000)
+	if v, _ := l.incr(counterKey("tokens", name, r.window), 0); v != 0 {
+		t.Errorf("tokens = %d, want 0 when TPM is unlimited", v)
+	}
+
+	var nilReservation *Reservation
+	nilReservation.Commit(10)
+}
+
+func TestLimitsFor(t *testing.T) {
+	l := &Limiter{}
+	l.defaultRPM.Store(60)
+	l.defaultTPM.Store(1000)
+	tests := []struct {
+		rpm, tpm int
+		want     Limits
+	}{
+		{0, 0, Limits{RPM: 60, TPM: 1000}},
+		{10, 0, Limits{RPM: 10, TPM: 1000}},
+		{-1, 500, Limits{RPM: -1, TPM: 500}},
+	}
+	for _, tt := range tests {
+		if got := l.LimitsFor(tt.rpm, tt.tpm); got != tt.want {
+			t.Errorf("LimitsFor(%d, %d) = %+v, want %+v", tt.rpm, tt.tpm, got, tt.want)
+		}
+	}
+	if !(Limits{RPM: -1}).Unlimited() {
+		t.Errorf("negative limits should be unlimited")
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		body string
+		want int64
+	}{
+		{`{"model":"m"}`, 3},
+		{`{"max_tokens":100}`, 4 + 100},
+		{`{"max_tokens":10,"max_completion_tokens":200}`, 11 + 200},
+		{`{"max_output_tokens":50}`, 6 + 50},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens([]byte(tt.body)); got != tt.want {
+			t.Errorf("EstimateTokens(%s) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
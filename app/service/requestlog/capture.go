@@ -0,0 +1,292 @@
+package requestlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/appconfig"
+	"gin_base/app/helper/type_helper"
+	"gin_base/app/model"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxBodyBytes = 64 * 1024    // 默认单个请求体/响应体最多保存的字节数
+	redactedValue       = "[REDACTED]" // 脱敏后的值
+)
+
+// ShouldCapture 按密钥、模型别名和采样比例决定是否采集该请求
+func ShouldCapture(cfg *appconfig.BodyCaptureConfig, keyName, alias string) bool {
+	if cfg == nil || !cfg.Enabled {
+		return false
+	}
+	if len(cfg.Keys) > 0 || len(cfg.Aliases) > 0 {
+		if !containsString(cfg.Keys, keyName) && !containsString(cfg.Aliases, alias) {
+			return false
+		}
+	}
+	if cfg.SampleRate != nil && rand.Float64() >= *cfg.SampleRate {
+		return false
+	}
+	return true
+}
+
+// containsString 列表是否包含 s（s 为空时不匹配）
+func containsString(list []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureAttempt 单次上游尝试采集的请求体与响应体
+type CaptureAttempt struct {
+	Provider      string `json:"provider"`
+	UpstreamModel string `json:"upstream_model"`
+	RequestBody   string `json:"request_body"`
+	ResponseBody  string `json:"response_body"`
+}
+
+// Capture 单个请求的请求体/响应体采集（所有方法对 nil 安全）
+// 保存前按配置脱敏，超过大小上限的部分截断
+type Capture struct {
+	mu       sync.Mutex
+	maxBytes int
+	redact   [][]string
+	request  []byte
+	attempts []*captureAttempt
+	response cappedBuffer
+}
+
+// captureAttempt 采集中的单次尝试
+type captureAttempt struct {
+	provider      string
+	upstreamModel string
+	request       []byte
+	response      cappedBuffer
+}
+
+// NewCapture 按配置创建请求采集
+func NewCapture(cfg *appconfig.BodyCaptureConfig) *Capture {
+	c := &Capture{maxBytes: cfg.MaxBodyBytes}
+	if c.maxBytes <= 0 {
+		c.maxBytes = defaultMaxBodyBytes
+	}
+	for _, path := range cfg.Redact {
+		if path = strings.TrimSpace(path); path != "" {
+			c.redact = append(c.redact, strings.Split(strings.TrimPrefix(path, "$."), "."))
+		}
+	}
+	c.response.limit = c.maxBytes
+	return c
+}
+
+// SetRequest 记录客户端请求体
+func (c *Capture) SetRequest(body []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.request = body
+}
+
+// StartAttempt 开始记录一次上游尝试（body 为发往上游的请求体）
+func (c *Capture) StartAttempt(provider, upstreamModel string, body []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts = append(c.attempts, &captureAttempt{
+		provider:      provider,
+		upstreamModel: upstreamModel,
+		request:       body,
+		response:      cappedBuffer{limit: c.maxBytes},
+	})
+}
+
+// AppendAttemptResponse 追加当前尝试的上游响应（流式按行追加）
+func (c *Capture) AppendAttemptResponse(data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.attempts) == 0 {
+		return
+	}
+	c.attempts[len(c.attempts)-1].response.write(c.redactBody(data))
+}
+
+// AppendResponse 追加返回客户端的响应
+func (c *Capture) AppendResponse(data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.response.write(c.redactBody(data))
+}
+
+// Model 生成待保存的采集记录（请求体在此时脱敏和截断）
+func (c *Capture) Model(createdAt time.Time) *model.RequestCapture {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	attempts := make([]CaptureAttempt, 0, len(c.attempts))
+	for _, a := range c.attempts {
+		attempts = append(attempts, CaptureAttempt{
+			Provider:      a.provider,
+			UpstreamModel: a.upstreamModel,
+			RequestBody:   c.truncate(c.redactBody(a.request)),
+			ResponseBody:  a.response.String(),
+		})
+	}
+	data, _ := json.Marshal(attempts)
+	return &model.RequestCapture{
+		RequestBody:  c.truncate(c.redactBody(c.request)),
+		Attempts:     string(data),
+		ResponseBody: c.response.String(),
+		CreatedAt:    type_helper.Time(createdAt),
+	}
+}
+
+// truncate 按大小上限截断
+func (c *Capture) truncate(body []byte) string {
+	if len(body) <= c.maxBytes {
+		return string(body)
+	}
+	kept := runePrefix(body, c.maxBytes)
+	return string(kept) + truncatedNote(len(body)-len(kept))
+}
+
+// runePrefix 截取不超过 n 字节的前缀（不截断多字节字符）
+func runePrefix(data []byte, n int) []byte {
+	if n >= len(data) {
+		return data
+	}
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	return data[:n]
+}
+
+// truncatedNote 截断说明
+func truncatedNote(dropped int) string {
+	return fmt.Sprintf("\n...[truncated %d bytes]", dropped)
+}
+
+// redactBody 脱敏：整体为 JSON 时按路径替换；否则按行处理 SSE 事件（data: 后的 JSON）
+func (c *Capture) redactBody(body []byte) []byte {
+	if len(c.redact) == 0 || len(body) == 0 {
+		return body
+	}
+	if redacted, ok := c.redactJSON(body); ok {
+		return redacted
+	}
+	if !bytes.Contains(body, []byte("data:")) {
+		return body
+	}
+	lines := bytes.SplitAfter(body, []byte("\n"))
+	for i, line := range lines {
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if !bytes.HasPrefix(trimmed, []byte("data:")) {
+			continue
+		}
+		if redacted, ok := c.redactJSON(bytes.TrimSpace(trimmed[len("data:"):])); ok {
+			lines[i] = append(append([]byte("data: "), redacted...), line[len(trimmed):]...)
+		}
+	}
+	return bytes.Join(lines, nil)
+}
+
+// redactJSON 解析 JSON 并替换所有匹配路径的值，不是 JSON 时返回 false
+func (c *Capture) redactJSON(body []byte) ([]byte, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || (body[0] != '{' && body[0] != '[') {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, false
+	}
+	for _, path := range c.redact {
+		data = redactPath(data, path)
+	}
+	redacted, err := json.Marshal(data)
+	if err != nil {
+		return nil, false
+	}
+	return redacted, true
+}
+
+// redactPath 替换 data 中匹配 path 的值（* 匹配任意键或数组元素，数字匹配数组下标）
+func redactPath(data interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	key, rest := path[0], path[1:]
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if key == "*" || key == k {
+				v[k] = redactPath(child, rest)
+			}
+		}
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		for i, child := range v {
+			if key == "*" || (err == nil && i == index) {
+				v[i] = redactPath(child, rest)
+			}
+		}
+	}
+	return data
+}
+
+// cappedBuffer 有大小上限的缓冲区，超出部分只计数
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+// write 追加数据，超出上限的部分丢弃
+func (b *cappedBuffer) write(data []byte) {
+	room := b.limit - b.buf.Len()
+	if room < len(data) {
+		if room < 0 {
+			room = 0
+		}
+		kept := runePrefix(data, room)
+		b.buf.Write(kept)
+		b.dropped += len(data) - len(kept)
+		b.limit = b.buf.Len() // 已截断，之后的数据全部丢弃
+		return
+	}
+	b.buf.Write(data)
+}
+
+// String 缓冲区内容（有截断时附加说明）
+func (b *cappedBuffer) String() string {
+	if b.dropped > 0 {
+		return b.buf.String() + truncatedNote(b.dropped)
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,72 @@
+package requestlog
+
+import (
+	"fmt"
+	"gin_base/app/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Filter 请求记录查询条件（为空时不限制）
+type Filter struct {
+	Start     time.Time
+	End       time.Time
+	RequestID string
+	KeyName   string
+	Alias     string
+	Provider  string
+	Status    string // 状态码（如 502）或状态类别（2xx、4xx、5xx）
+}
+
+// parseStatus 解析状态过滤条件，返回 [min, max] 状态码区间
+func parseStatus(status string) (int, int, error) {
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		if class, err := strconv.Atoi(status[:1]); err == nil && class >= 1 && class <= 5 {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+	if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+		return code, code, nil
+	}
+	return 0, 0, fmt.Errorf("invalid status %q, expected a status code or 2xx/4xx/5xx", status)
+}
+
+// Query 按条件构造请求记录查询（按时间倒序），供分页使用
+func (r *Recorder) Query(filter Filter) (*gorm.DB, error) {
+	if !r.Enabled() {
+		return nil, fmt.Errorf("request log database unavailable")
+	}
+	// 先写入内存中的记录，保证刚完成的请求可查
+	r.Flush()
+
+	db := r.db.Model(&model.RequestLog{})
+	if !filter.Start.IsZero() {
+		db = db.Where("created_at >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		db = db.Where("created_at < ?", filter.End)
+	}
+	if filter.RequestID != "" {
+		db = db.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.KeyName != "" {
+		db = db.Where("key_name = ?", filter.KeyName)
+	}
+	if filter.Alias != "" {
+		db = db.Where("alias = ?", filter.Alias)
+	}
+	if filter.Provider != "" {
+		db = db.Where("provider = ?", filter.Provider)
+	}
+	if filter.Status != "" {
+		min, max, err := parseStatus(filter.Status)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("status BETWEEN ? AND ?", min, max)
+	}
+	return db.Order("id DESC"), nil
+}
@@ -0,0 +1,229 @@
+package requestlog
+
+import (
+	"fmt"
+	"gin_base/app/helper/db_helper"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/model"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	flushInterval        = 2 * time.Second // 内存中的请求记录写入数据库的间隔
+	flushBatchSize       = 100             // 单次批量写入的行数
+	maxPending           = 10000           // 内存中最多保留的未写入记录（数据库持续写入失败时丢弃最早的）
+	defaultRetentionDays = 7               // 默认保留天数
+)
+
+// retentionDays 请求记录保留天数（小于 0 时不清理）
+var retentionDays atomic.Int64
+
+func init() {
+	retentionDays.Store(defaultRetentionDays)
+}
+
+// SetRetentionDays 设置请求记录保留天数：0 使用默认值（7 天），小于 0 不清理
+func SetRetentionDays(days int) {
+	if days == 0 {
+		days = defaultRetentionDays
+	}
+	retentionDays.Store(int64(days))
+}
+
+// Recorder 记录每个代理请求，批量异步写入数据库
+// 数据库不可用时不记录
+type Recorder struct {
+	mu       sync.Mutex
+	flushMu  sync.Mutex // 串行化写入
+	pending  []pendingLog
+	db       *gorm.DB // 为 nil 时不记录
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// pendingLog 待写入的请求记录及其请求体采集（未采集时为 nil）
+type pendingLog struct {
+	log     *model.RequestLog
+	capture *model.RequestCapture
+}
+
+// NewRecorder 创建请求记录器，使用 db_helper 的默认数据库连接持久化（自动建表）
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		db:       openDB(),
+		stopChan: make(chan struct{}),
+	}
+	go r.flushLoop()
+	return r
+}
+
+// openDB 获取数据库连接并创建请求记录表，失败时返回 nil
+func openDB() (db *gorm.DB) {
+	defer func() {
+		if err := recover(); err != nil {
+			log_helper.Warning(fmt.Sprintf("Request log database unavailable, request logging disabled: %v", err))
+			db = nil
+		}
+	}()
+	db = db_helper.Db()
+	if err := db.AutoMigrate(&model.RequestLog{}, &model.RequestCapture{}); err != nil {
+		log_helper.Warning(fmt.Sprintf("Request log database unavailable, request logging disabled: %v", err))
+		return nil
+	}
+	return db
+}
+
+// Enabled 是否可记录和查询（数据库可用）
+func (r *Recorder) Enabled() bool {
+	return r != nil && r.db != nil
+}
+
+// Record 记录一个请求及其请求体采集（capture 可为 nil，异步写入）
+func (r *Recorder) Record(entry *model.RequestLog, capture *model.RequestCapture) {
+	if !r.Enabled() {
+		return
+	}
+	entry.Captured = capture != nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) >= maxPending {
+		r.pending = r.pending[1:]
+	}
+	r.pending = append(r.pending, pendingLog{log: entry, capture: capture})
+}
+
+// flushLoop 定期将内存中的请求记录写入数据库
+func (r *Recorder) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Flush 将内存中的请求记录写入数据库，写入失败的保留到下次重试
+func (r *Recorder) Flush() {
+	if !r.Enabled() {
+		return
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	logs := make([]*model.RequestLog, 0, len(pending))
+	for _, p := range pending {
+		logs = append(logs, p.log)
+	}
+	if err := r.db.CreateInBatches(logs, flushBatchSize).Error; err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to save %d request logs, will retry: %v", len(pending), err))
+		for _, entry := range logs {
+			entry.Id = 0
+		}
+		r.mu.Lock()
+		r.pending = append(pending, r.pending...)
+		if len(r.pending) > maxPending {
+			r.pending = r.pending[len(r.pending)-maxPending:]
+		}
+		r.mu.Unlock()
+		return
+	}
+
+	// 请求记录写入后才有 ID，再写入对应的请求体采集
+	var captures []*model.RequestCapture
+	for _, p := range pending {
+		if p.capture != nil {
+			p.capture.RequestLogId = p.log.Id
+			captures = append(captures, p.capture)
+		}
+	}
+	if len(captures) == 0 {
+		return
+	}
+	if err := r.db.CreateInBatches(captures, flushBatchSize).Error; err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to save %d request captures: %v", len(captures), err))
+	}
+}
+
+// Get 获取请求记录
+func (r *Recorder) Get(id uint) (*model.RequestLog, error) {
+	if !r.Enabled() {
+		return nil, fmt.Errorf("request log database unavailable")
+	}
+	r.Flush()
+	var entry model.RequestLog
+	if err := r.db.First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetCapture 获取请求记录对应的请求体采集
+func (r *Recorder) GetCapture(requestLogID uint) (*model.RequestCapture, error) {
+	if !r.Enabled() {
+		return nil, fmt.Errorf("request log database unavailable")
+	}
+	r.Flush()
+	var capture model.RequestCapture
+	if err := r.db.Where("request_log_id = ?", requestLogID).First(&capture).Error; err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
+
+// Stop 停止定期写入，并写入剩余的请求记录
+func (r *Recorder) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+		r.Flush()
+	})
+}
+
+// Prune 删除超过保留天数的请求记录（由定时任务调用）
+func Prune() {
+	days := retentionDays.Load()
+	if days < 0 {
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			log_helper.Warning(fmt.Sprintf("Failed to prune request logs: %v", err))
+		}
+	}()
+	db := db_helper.Db()
+	if !db.Migrator().HasTable(&model.RequestLog{}) {
+		return
+	}
+	before := time.Now().AddDate(0, 0, -int(days))
+	if db.Migrator().HasTable(&model.RequestCapture{}) {
+		if err := db.Where("created_at < ?", before).Delete(&model.RequestCapture{}).Error; err != nil {
+			log_helper.Warning(fmt.Sprintf("Failed to prune request captures: %v", err))
+		}
+	}
+	result := db.Where("created_at < ?", before).Delete(&model.RequestLog{})
+	if result.Error != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to prune request logs: %v", result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		log_helper.Info(fmt.Sprintf("Pruned %d request logs older than %d days", result.RowsAffected, days))
+	}
+}
@@ -0,0 +1,60 @@
+package respcache
+
+import (
+	"errors"
+	"gin_base/app/helper/cache_helper"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 存储后端
+const (
+	BackendMemory = "memory" // 进程内缓存（默认）
+	BackendRedis  = "redis"  // Redis 缓存，多个网关实例共享
+)
+
+// Store 响应缓存存储后端
+type Store interface {
+	// Get 获取缓存的响应，不存在时返回 nil
+	Get(key string) ([]byte, error)
+	// Set 保存响应并设置过期时间
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// memoryStore 基于进程内缓存的存储
+type memoryStore struct{}
+
+func (memoryStore) Get(key string) ([]byte, error) {
+	if v, ok := cache_helper.GoCache().Get(key); ok {
+		if data, ok := v.([]byte); ok {
+			return data, nil
+		}
+	}
+	return nil, nil
+}
+
+func (memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	cache_helper.GoCache().Set(key, value, ttl)
+	return nil
+}
+
+// redisStore 基于 Redis 的存储
+type redisStore struct {
+	connection string
+}
+
+func (s redisStore) Get(key string) ([]byte, error) {
+	res, err := cache_helper.RedisHelper(s.connection).RedisGet(key)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(res), nil
+}
+
+func (s redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	return cache_helper.RedisHelper(s.connection).RedisSet(key, value, ttl)
+}
@@ -0,0 +1,129 @@
+package respcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/appconfig"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/service/metrics"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	keyPrefix            = "respcache:" // 缓存键前缀
+	defaultTTL           = time.Hour    // 默认缓存有效期
+	defaultMaxEntryBytes = 1024 * 1024  // 默认单个响应最多缓存的字节数
+)
+
+// 查询结果（model_switch_cache_requests_total 的 result 标签）
+const (
+	ResultHit    = "hit"    // 命中缓存
+	ResultMiss   = "miss"   // 未命中，请求上游
+	ResultBypass = "bypass" // 客户端要求跳过缓存
+)
+
+// promLookups 响应缓存查询次数（进程级）
+var promLookups = metrics.NewCounterVec("model_switch_cache_requests_total",
+	"Response cache lookups by result (hit, miss, bypass).",
+	"alias", "result")
+
+// Cache 按归一化请求缓存上游的成功响应
+type Cache struct {
+	store Store
+	cfg   atomic.Pointer[appconfig.ResponseCacheConfig]
+}
+
+// NewCache 创建响应缓存（存储后端在启动时确定，其余配置可热重载）
+func NewCache(cfg appconfig.ResponseCacheConfig) *Cache {
+	c := &Cache{store: memoryStore{}}
+	if cfg.Backend == BackendRedis {
+		connection := cfg.RedisConnection
+		if connection == "" {
+			connection = "default"
+		}
+		c.store = redisStore{connection: connection}
+	} else if cfg.Backend != "" && cfg.Backend != BackendMemory {
+		log_helper.Warning(fmt.Sprintf("Unknown response cache backend %q, falling back to %s", cfg.Backend, BackendMemory))
+	}
+	c.SetConfig(cfg)
+	return c
+}
+
+// SetConfig 设置是否启用、有效期和缓存的模型别名（用于热重载）
+func (c *Cache) SetConfig(cfg appconfig.ResponseCacheConfig) {
+	c.cfg.Store(&cfg)
+}
+
+// Enabled 该模型别名是否启用缓存
+func (c *Cache) Enabled(alias string) bool {
+	if c == nil {
+		return false
+	}
+	cfg := c.cfg.Load()
+	if !cfg.Enabled {
+		return false
+	}
+	if len(cfg.Aliases) == 0 {
+		return true
+	}
+	for _, a := range cfg.Aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 获取缓存的响应体，未命中或存储不可用时返回 nil
+func (c *Cache) Get(key string) []byte {
+	data, err := c.store.Get(key)
+	if err != nil {
+		log_helper.Warning(fmt.Sprintf("Response cache unavailable, request forwarded: %v", err))
+		return nil
+	}
+	return data
+}
+
+// Set 缓存响应体（超过大小上限时不缓存）
+func (c *Cache) Set(key string, body []byte) {
+	cfg := c.cfg.Load()
+	maxBytes := cfg.MaxEntryBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxEntryBytes
+	}
+	if len(body) > maxBytes {
+		return
+	}
+	ttl := time.Duration(cfg.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if err := c.store.Set(key, body, ttl); err != nil {
+		log_helper.Warning(fmt.Sprintf("Response cache unavailable, response not cached: %v", err))
+	}
+}
+
+// Key 由接口路径、客户端密钥名称和归一化的请求体生成缓存键（不同密钥的缓存互不共享，未启用认证时 keyName 为空）
+// 去掉只影响返回形式的 stream / stream_options 后按键名排序重新序列化，数值按浮点数归一（0 与 0.0 相同）
+func Key(path, keyName string, body []byte) (string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", err
+	}
+	delete(data, "stream")
+	delete(data, "stream_options")
+	normalized, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(path+"\n"+keyName+"\n"), normalized...))
+	return keyPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// ObserveLookup 记录一次缓存查询结果
+func ObserveLookup(alias, result string) {
+	promLookups.Inc(alias, result)
+}
@@ -0,0 +1,120 @@
+package respcache
+
+import (
+	"fmt"
+	"gin_base/app/appconfig"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	base := `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":0}`
+	tests := []struct {
+		name    string
+		path    string
+		keyName string
+		body    string
+		equal   bool // 是否与 base 的键相同
+	}{
+		{"identical", "/v1/chat/completions", "team-a", base, true},
+		{"key order", "/v1/chat/completions", "team-a", `{"temperature":0,"messages":[{"content":"hi","role":"user"}],"model":"m"}`, true},
+		{"whitespace", "/v1/chat/completions", "team-a", "{ \"model\": \"m\",\n \"messages\": [{\"role\": \"user\", \"content\": \"hi\"}], \"temperature\": 0 }", true},
+		{"float form", "/v1/chat/completions", "team-a", `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":0.0}`, true},
+		{"stream ignored", "/v1/chat/completions", "team-a", `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":0,"stream":true,"stream_options":{"include_usage":true}}`, true},
+		{"different content", "/v1/chat/completions", "team-a", `{"model":"m","messages":[{"role":"user","content":"hello"}],"temperature":0}`, false},
+		{"different parameter", "/v1/chat/completions", "team-a", `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":1}`, false},
+		{"different model", "/v1/chat/completions", "team-a", `{"model":"n","messages":[{"role":"user","content":"hi"}],"temperature":0}`, false},
+		{"different path", "/v1/responses", "team-a", base, false},
+		{"different key", "/v1/chat/completions", "team-b", base, false},
+		{"no key", "/v1/chat/completions", "", base, false},
+	}
+	want, err := Key("/v1/chat/completions", "team-a", []byte(base))
+	if err != nil {
+		t.Fatalf("Key(base): %v", err)
+	}
+	if !strings.HasPrefix(want, keyPrefix) {
+		t.Errorf("key %q missing prefix %q", want, keyPrefix)
+	}
+	for _, tt := range tests {
+		got, err := Key(tt.path, tt.keyName, []byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: Key error: %v", tt.name, err)
+			continue
+		}
+		if (got == want) != tt.equal {
+			t.Errorf("%s: key equal = %v, want %v", tt.name, got == want, tt.equal)
+		}
+	}
+	if _, err := Key("/v1/chat/completions", "team-a", []byte(`{"model":`)); err == nil {
+		t.Errorf("Key(invalid json): want error")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   appconfig.ResponseCacheConfig
+		alias string
+		want  bool
+	}{
+		{"disabled", appconfig.ResponseCacheConfig{}, "gpt", false},
+		{"all aliases", appconfig.ResponseCacheConfig{Enabled: true}, "gpt", true},
+		{"listed alias", appconfig.ResponseCacheConfig{Enabled: true, Aliases: []string{"gpt", "claude"}}, "claude", true},
+		{"unlisted alias", appconfig.ResponseCacheConfig{Enabled: true, Aliases: []string{"gpt"}}, "claude", false},
+	}
+	for _, tt := range tests {
+		if got := NewCache(tt.cfg).Enabled(tt.alias); got != tt.want {
+			t.Errorf("%s: Enabled(%q) = %v, want %v", tt.name, tt.alias, got, tt.want)
+		}
+	}
+	var nilCache *Cache
+	if nilCache.Enabled("gpt") {
+		t.Errorf("nil cache should be disabled")
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	c := NewCache(appconfig.ResponseCacheConfig{Enabled: true, MaxEntryBytes: 8, TTL: 60})
+	prefix := fmt.Sprintf("%s%s-%d:", keyPrefix, t.Name(), time.Now().UnixNano())
+	tests := []struct {
+		name string
+		body string
+		want string // 读取到的内容，空表示未缓存
+	}{
+		{"within limit", "12345678", "12345678"},
+		{"over limit", "123456789", ""},
+	}
+	for _, tt := range tests {
+		key := prefix + tt.name
+		c.Set(key, []byte(tt.body))
+		if got := string(c.Get(key)); got != tt.want {
+			t.Errorf("%s: Get = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := c.Get(prefix + "missing"); got != nil {
+		t.Errorf("Get(missing) = %q, want nil", got)
+	}
+}
+
+func TestKeysDoNotShareEntries(t *testing.T) {
+	c := NewCache(appconfig.ResponseCacheConfig{Enabled: true, TTL: 60})
+	body := []byte(fmt.Sprintf(`{"model":"m","messages":[{"role":"user","content":"%s-%d"}]}`, t.Name(), time.Now().UnixNano()))
+	keyA, err := Key("/v1/chat/completions", "team-a", body)
+	if err != nil {
+		t.Fatalf("Key(team-a): %v", err)
+	}
+	keyB, err := Key("/v1/chat/completions", "team-b", body)
+	if err != nil {
+		t.Fatalf("Key(team-b): %v", err)
+	}
+
+	c.Set(keyA, []byte("response-a"))
+	if got := c.Get(keyB); got != nil {
+		t.Errorf("team-b read team-a's entry: %q", got)
+	}
+	c.Set(keyB, []byte("response-b"))
+	if got := string(c.Get(keyA)); got != "response-a" {
+		t.Errorf("team-a entry = %q, want response-a", got)
+	}
+}
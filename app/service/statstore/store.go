@@ -0,0 +1,140 @@
+package statstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin_base/app/helper/db_helper"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/model"
+	"gin_base/app/service/upstream"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// saveInterval 统计快照写入数据库的间隔
+const saveInterval = 30 * time.Second
+
+// Store 定期将供应商统计与健康状态快照写入数据库，重启后用于恢复
+// 数据库不可用时不做任何持久化
+type Store struct {
+	db         *gorm.DB                 // 为 nil 时不持久化
+	getManager func() *upstream.Manager // 获取当前 Manager（Start 时设置）
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewStore 创建统计快照存储，使用 db_helper 的默认数据库连接（自动建表）
+func NewStore() *Store {
+	return &Store{
+		db:       openDB(),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// openDB 获取数据库连接并创建快照表，失败时返回 nil
+func openDB() (db *gorm.DB) {
+	defer func() {
+		if err := recover(); err != nil {
+			log_helper.Warning(fmt.Sprintf("Provider stats database unavailable, stats will not survive restarts: %v", err))
+			db = nil
+		}
+	}()
+	db = db_helper.Db()
+	if err := db.AutoMigrate(&model.ProviderSnapshot{}); err != nil {
+		log_helper.Warning(fmt.Sprintf("Provider stats database unavailable, stats will not survive restarts: %v", err))
+		return nil
+	}
+	return db
+}
+
+// Load 读取数据库中保存的快照，无法解析的行会被跳过
+func (s *Store) Load() []upstream.ProviderSnapshot {
+	if s == nil || s.db == nil {
+		return nil
+	}
+	var rows []model.ProviderSnapshot
+	if err := s.db.Find(&rows).Error; err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to load provider stats: %v", err))
+		return nil
+	}
+	snapshots := make([]upstream.ProviderSnapshot, 0, len(rows))
+	for _, row := range rows {
+		var snapshot upstream.ProviderSnapshot
+		if err := json.Unmarshal([]byte(row.Data), &snapshot); err != nil {
+			log_helper.Warning(fmt.Sprintf("Skipping unreadable stats snapshot of provider %s: %v", row.Name, err))
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// Save 写入快照（按供应商名称覆盖）
+func (s *Store) Save(snapshots []upstream.ProviderSnapshot) {
+	if s == nil || s.db == nil {
+		return
+	}
+	for _, snapshot := range snapshots {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			continue
+		}
+		row := model.ProviderSnapshot{Name: snapshot.Name, Data: string(data)}
+		err = s.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "name"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"data":       row.Data,
+				"updated_at": time.Now(),
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			log_helper.Warning(fmt.Sprintf("Failed to save stats of provider %s: %v", snapshot.Name, err))
+		}
+	}
+}
+
+// Start 定期保存 getManager 返回的当前 Manager 的快照（Manager 热重载后自动跟随）
+func (s *Store) Start(getManager func() *upstream.Manager) {
+	if s == nil || s.db == nil {
+		return
+	}
+	s.getManager = getManager
+	go func() {
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.saveCurrent()
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// saveCurrent 保存当前 Manager 的快照
+func (s *Store) saveCurrent() {
+	if s.getManager == nil {
+		return
+	}
+	if manager := s.getManager(); manager != nil {
+		s.Save(manager.Snapshot())
+	}
+}
+
+// Stop 停止定期保存，并保存当前 Manager 的最终快照
+func (s *Store) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		if s.db != nil {
+			s.saveCurrent()
+		}
+	})
+}
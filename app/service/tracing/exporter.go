@@ -0,0 +1,233 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	exportInterval  = 5 * time.Second // 定期导出间隔
+	exportBatchSize = 512             // 累积到该数量时立即导出
+	exportQueueSize = 4096            // 待导出队列长度，队列满时丢弃新跨度
+	exportTimeout   = 10 * time.Second
+)
+
+// exporter 以 OTLP/HTTP JSON 格式批量导出跨度
+type exporter struct {
+	cfg         Config
+	sampleBound uint64 // 链路 ID 低 8 字节小于该值时采样
+	client      *http.Client
+	queue       chan *Span
+	stopChan    chan struct{}
+	done        chan struct{}
+	dropOnce    sync.Once
+}
+
+// newExporter 创建导出器并启动后台导出
+func newExporter(cfg Config, ratio float64) *exporter {
+	e := &exporter{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: exportTimeout},
+		queue:    make(chan *Span, exportQueueSize),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if ratio >= 1 {
+		e.sampleBound = ^uint64(0)
+	} else {
+		e.sampleBound = uint64(ratio * float64(^uint64(0)))
+	}
+	go e.loop()
+	return e
+}
+
+// sample 按链路 ID 决定是否采样（同一链路的判定结果一致）
+func (e *exporter) sample(traceID [16]byte) bool {
+	return e.sampleBound == ^uint64(0) || binary.BigEndian.Uint64(traceID[8:]) < e.sampleBound
+}
+
+// enqueue 提交待导出的跨度，队列满时丢弃
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropOnce.Do(func() {
+			log_helper.Warning("Trace export queue is full, dropping spans")
+		})
+	}
+}
+
+// loop 后台批量导出
+func (e *exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = make([]*Span, 0, exportBatchSize)
+		}
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopChan:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown 停止导出器并导出剩余的跨度
+func (e *exporter) shutdown() {
+	close(e.stopChan)
+	<-e.done
+}
+
+// export 发送一批跨度，失败时只记录日志
+func (e *exporter) export(spans []*Span) {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to encode spans: %v", err))
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to export spans: %v", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log_helper.Warning(fmt.Sprintf("Failed to export %d spans to %s: %v", len(spans), e.cfg.Endpoint, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log_helper.Warning(fmt.Sprintf("Failed to export %d spans to %s: status %d", len(spans), e.cfg.Endpoint, resp.StatusCode))
+	}
+}
+
+// OTLP/JSON 结构（opentelemetry-proto 的 JSON 映射，ID 为十六进制字符串，64 位整数为字符串）
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+// payload 构造 OTLP 导出请求
+func (e *exporter) payload(spans []*Span) otlpRequest {
+	serviceName := e.cfg.ServiceName
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.sc.traceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.status, Message: s.message},
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, attr := range s.attributes {
+			span.Attributes = append(span.Attributes, otlpKeyValue{Key: attr.key, Value: toOTLPValue(attr.value)})
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpValue{StringValue: &serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: defaultServiceName},
+			Spans: out,
+		}},
+	}}}
+}
+
+// toOTLPValue 转换属性值
+func toOTLPValue(v interface{}) otlpValue {
+	switch value := v.(type) {
+	case bool:
+		return otlpValue{BoolValue: &value}
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &value}
+	case string:
+		return otlpValue{StringValue: &value}
+	}
+	s := fmt.Sprintf("%v", v)
+	return otlpValue{StringValue: &s}
+}
@@ -0,0 +1,295 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 跨度类型（与 OTLP SpanKind 取值一致）
+const (
+	KindInternal = 1 // 内部操作
+	KindServer   = 2 // 处理客户端请求
+	KindClient   = 3 // 调用上游
+)
+
+// 跨度状态（与 OTLP StatusCode 取值一致）
+const (
+	statusUnset = 0
+	statusOK    = 1
+	statusError = 2
+)
+
+// Config 链路追踪配置
+type Config struct {
+	Enabled     bool              `json:"enabled" yaml:"enabled" mapstructure:"enabled"`                                    // 是否启用
+	Endpoint    string            `json:"endpoint,omitempty" yaml:"endpoint,omitempty" mapstructure:"endpoint"`             // OTLP/HTTP 接收地址（默认 http://localhost:4318/v1/traces）
+	ServiceName string            `json:"service_name,omitempty" yaml:"service_name,omitempty" mapstructure:"service_name"` // service.name 资源属性（默认 model_auto_switch）
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" mapstructure:"headers"`                // 导出时附加的请求头（如认证头）
+	SampleRatio *float64          `json:"sample_ratio,omitempty" yaml:"sample_ratio,omitempty" mapstructure:"sample_ratio"` // 无上游 traceparent 时的采样比例（默认 1，全部采样）
+}
+
+const (
+	defaultEndpoint    = "http://localhost:4318/v1/traces"
+	defaultServiceName = "model_auto_switch"
+)
+
+// tracer 全局追踪器（为 nil 时追踪关闭）
+var (
+	tracerMu sync.RWMutex
+	tracer   *exporter
+)
+
+// Init 按配置启动追踪（重复调用时先关闭旧的导出器）
+func Init(cfg Config) {
+	Shutdown()
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultEndpoint
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = math.Max(0, math.Min(1, *cfg.SampleRatio))
+	}
+	e := newExporter(cfg, ratio)
+	tracerMu.Lock()
+	tracer = e
+	tracerMu.Unlock()
+}
+
+// Shutdown 停止追踪并导出剩余的跨度
+func Shutdown() {
+	tracerMu.Lock()
+	e := tracer
+	tracer = nil
+	tracerMu.Unlock()
+	if e != nil {
+		e.shutdown()
+	}
+}
+
+// current 获取当前导出器
+func current() *exporter {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// spanContext 跨度标识（W3C Trace Context）
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// traceparent 格式化为 traceparent 头
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent 解析 traceparent 头，格式不合法时返回 false
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || sc.traceID == [16]byte{} {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || sc.spanID == [8]byte{} {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// attribute 跨度属性
+type attribute struct {
+	key   string
+	value interface{} // string / int64 / float64 / bool
+}
+
+// Span 一次操作的跨度；追踪关闭时为 nil，所有方法均可安全调用
+type Span struct {
+	sc       spanContext
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	exporter *exporter
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	status     int
+	message    string
+	ended      bool
+}
+
+type spanKey struct{}
+
+// remoteKey 上游传入的跨度标识（尚未创建本地跨度）
+type remoteKey struct{}
+
+// SpanFromContext 获取上下文中的当前跨度
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Extract 从请求头读取 traceparent，作为后续根跨度的父跨度
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if current() == nil {
+		return ctx
+	}
+	if sc, ok := parseTraceparent(header.Get("traceparent")); ok {
+		return context.WithValue(ctx, remoteKey{}, sc)
+	}
+	return ctx
+}
+
+// Inject 将当前跨度写入请求头的 traceparent（追踪关闭或没有跨度时不修改请求头）
+func Inject(ctx context.Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil {
+		header.Set("traceparent", span.sc.traceparent())
+	}
+}
+
+// Start 创建跨度：上下文中有跨度时作为其子跨度，否则延续 Extract 的上游跨度或开启新的链路
+// 追踪关闭时返回原上下文和 nil
+func Start(ctx context.Context, name string, kind int, attrs ...interface{}) (context.Context, *Span) {
+	e := current()
+	if e == nil {
+		return ctx, nil
+	}
+	span := &Span{name: name, kind: kind, start: time.Now(), exporter: e}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.sc.traceID = parent.sc.traceID
+		span.sc.sampled = parent.sc.sampled
+		span.parentID = parent.sc.spanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(spanContext); ok {
+		span.sc.traceID = remote.traceID
+		span.sc.sampled = remote.sampled
+		span.parentID = remote.spanID
+	} else {
+		rand.Read(span.sc.traceID[:])
+		span.sc.sampled = e.sample(span.sc.traceID)
+	}
+	rand.Read(span.sc.spanID[:])
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// TraceID 链路 ID（十六进制），span 为 nil 时返回空
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.sc.traceID[:])
+}
+
+// SetAttributes 设置属性，参数为键值对（值支持 string、整数、浮点数、bool，其他类型按 %v 转为字符串）
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
+		}
+		var value interface{}
+		switch v := kv[i+1].(type) {
+		case string, bool, float64, int64:
+			value = v
+		case int:
+			value = int64(v)
+		case int32:
+			value = int64(v)
+		case float32:
+			value = float64(v)
+		case time.Duration:
+			value = float64(v) / float64(time.Millisecond)
+		default:
+			value = fmt.Sprintf("%v", v)
+		}
+		s.setAttribute(key, value)
+	}
+}
+
+// setAttribute 设置单个属性（覆盖同名属性），调用方需持有锁
+func (s *Span) setAttribute(key string, value interface{}) {
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// SetError 标记跨度失败（err 为 nil 时忽略）
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = statusError
+	s.message = err.Error()
+}
+
+// SetOK 标记跨度成功（已标记失败时不覆盖）
+func (s *Span) SetOK() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == statusUnset {
+		s.status = statusOK
+	}
+}
+
+// End 结束跨度并提交导出（重复调用无效）
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.sampled {
+		s.exporter.enqueue(s)
+	}
+}
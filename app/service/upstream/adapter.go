@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// 上游接口路径（OpenAI 兼容）
+const (
+	ChatCompletionsPath = "/v1/chat/completions"
+	EmbeddingsPath      = "/v1/embeddings"
+	ResponsesPath       = "/v1/responses"
+	MessagesPath        = "/v1/messages" // Anthropic Messages 接口
+)
+
+// SupportsEndpoint 供应商是否支持该接口（Anthropic 与 Gemini 上游没有 embeddings 接口）
+func (p *Provider) SupportsEndpoint(path string) bool {
+	if path == EmbeddingsPath {
+		return p.Config.Type != ProviderTypeAnthropic && p.Config.Type != ProviderTypeGemini
+	}
+	return true
+}
+
+// sseEvent SSE 事件
+type sseEvent struct {
+	Event string // event: 字段（可能为空）
+	Data  []byte // data: 字段（多行 data 以换行拼接）
+}
+
+// readSSEEvent 从流中读取一个完整的 SSE 事件（以空行分隔）
+// 返回 io.EOF 表示流已结束且没有剩余事件
+func readSSEEvent(reader *bufio.Reader) (*sseEvent, error) {
+	ev := &sseEvent{}
+	hasField := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		trimmed := bytes.TrimRight(line, "\r\n")
+
+		if len(trimmed) == 0 {
+			if hasField {
+				return ev, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("event:")):
+			ev.Event = string(bytes.TrimSpace(trimmed[len("event:"):]))
+			hasField = true
+		case bytes.HasPrefix(trimmed, []byte("data:")):
+			data := bytes.TrimPrefix(trimmed[len("data:"):], []byte(" "))
+			if len(ev.Data) > 0 {
+				ev.Data = append(ev.Data, '\n')
+			}
+			ev.Data = append(ev.Data, data...)
+			hasField = true
+		}
+
+		if err != nil {
+			if hasField {
+				return ev, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// wrapStreamResponse 使用转换函数包装上游流式响应
+// convert 从上游读取原始流并向 w 写入转换后的 SSE 数据，返回后上游连接自动关闭
+func wrapStreamResponse(resp *http.Response, convert func(reader *bufio.Reader, w io.Writer) error) *http.Response {
+	pr, pw := io.Pipe()
+	go func() {
+		defer resp.Body.Close()
+		pw.CloseWithError(convert(bufio.NewReader(resp.Body), pw))
+	}()
+
+	newResp := *resp
+	newResp.Header = resp.Header.Clone()
+	newResp.Header.Set("Content-Type", "text/event-stream")
+	newResp.Header.Del("Content-Length")
+	newResp.ContentLength = -1
+	newResp.Body = pr
+	return &newResp
+}
+
+// replaceResponseBody 替换响应体（用于非流式响应格式转换）
+func replaceResponseBody(resp *http.Response, body []byte) *http.Response {
+	newResp := *resp
+	newResp.Header = resp.Header.Clone()
+	newResp.Header.Set("Content-Type", "application/json")
+	newResp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	newResp.ContentLength = int64(len(body))
+	newResp.Body = io.NopCloser(bytes.NewReader(body))
+	return &newResp
+}
+
+// randomID 生成带前缀的随机ID
+func randomID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,505 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/model"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnthropicVersion  = "2023-06-01"
+	defaultAnthropicMaxToken = 4096 // Anthropic 要求必须指定 max_tokens
+)
+
+// anthropicVersion 获取 anthropic-version 请求头
+func (p *Provider) anthropicVersion() string {
+	if p.Config.APIVersion != "" {
+		return p.Config.APIVersion
+	}
+	return defaultAnthropicVersion
+}
+
+// proxyAnthropic 将 OpenAI chat 请求转换为 Anthropic Messages 请求发送，并将响应转换回 OpenAI 格式
+// Anthropic Messages 请求直接透传
+func (p *Provider) proxyAnthropic(ctx context.Context, path string, body []byte, headers map[string]string, stream bool) (*http.Response, error) {
+	if path == MessagesPath {
+		return p.proxyAnthropicNative(ctx, body, headers, stream)
+	}
+	if path != ChatCompletionsPath {
+		return nil, fmt.Errorf("anthropic provider does not support %s", path)
+	}
+
+	var chatReq model.ChatCompletionRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		return nil, fmt.Errorf("parse chat request failed: %w", err)
+	}
+	anthropicReq, err := ChatToAnthropicRequest(&chatReq)
+	if err != nil {
+		return nil, err
+	}
+	anthropicReq.Stream = stream
+	anthropicBody, err := json.Marshal(anthropicReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal anthropic request failed: %w", err)
+	}
+
+	req, err := p.newUpstreamRequest(ctx, "POST", MessagesPath, anthropicBody)
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+
+	client := p.httpClient
+	if stream {
+		client = p.streamClient
+		req.Header.Set("Accept", "text/event-stream")
+		setForwardHeaders(req, headers, "Accept", "Content-Type")
+	} else {
+		setForwardHeaders(req, headers, "Content-Type")
+	}
+
+	resp, err := p.do(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 错误响应统一转换为 OpenAI 错误格式
+	if resp.StatusCode != http.StatusOK {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		return replaceResponseBody(resp, anthropicErrorToOpenAI(respBody)), nil
+	}
+
+	if stream {
+		includeUsage := chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage
+		return wrapStreamResponse(resp, func(reader *bufio.Reader, w io.Writer) error {
+			return convertAnthropicStreamToChat(reader, w, includeUsage)
+		}), nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var anthropicResp model.AnthropicMessagesResponse
+	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
+		return nil, fmt.Errorf("parse anthropic response failed: %w", err)
+	}
+	newBody, err := json.Marshal(AnthropicResponseToChat(&anthropicResp))
+	if err != nil {
+		return nil, err
+	}
+	return replaceResponseBody(resp, newBody), nil
+}
+
+// proxyAnthropicNative 透传 Anthropic Messages 请求
+func (p *Provider) proxyAnthropicNative(ctx context.Context, body []byte, headers map[string]string, stream bool) (*http.Response, error) {
+	req, err := p.newUpstreamRequest(ctx, "POST", MessagesPath, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+		setForwardHeaders(req, headers, "Accept")
+		return p.do(p.streamClient, req)
+	}
+	setForwardHeaders(req, headers)
+	return p.do(p.httpClient, req)
+}
+
+// ChatToAnthropicRequest 将 OpenAI chat 请求转换为 Anthropic Messages 请求
+func ChatToAnthropicRequest(req *model.ChatCompletionRequest) (*model.AnthropicMessagesRequest, error) {
+	result := &model.AnthropicMessagesRequest{
+		Model:       req.Model,
+		MaxTokens:   defaultAnthropicMaxToken,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.MaxCompletionTokens != nil && *req.MaxCompletionTokens > 0 {
+		result.MaxTokens = *req.MaxCompletionTokens
+	} else if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		result.MaxTokens = *req.MaxTokens
+	}
+
+	// 停止序列：string 或 []string
+	switch stop := req.Stop.(type) {
+	case string:
+		result.StopSequences = []string{stop}
+	case []interface{}:
+		for _, s := range stop {
+			if str, ok := s.(string); ok {
+				result.StopSequences = append(result.StopSequences, str)
+			}
+		}
+	}
+
+	// 工具
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		result.Tools = append(result.Tools, model.AnthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	result.ToolChoice = chatToolChoiceToAnthropic(req.ToolChoice)
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && len(result.Tools) > 0 {
+		if result.ToolChoice == nil {
+			result.ToolChoice = &model.AnthropicToolChoice{Type: "auto"}
+		}
+		result.ToolChoice.DisableParallelToolUse = true
+	}
+	if result.ToolChoice != nil && result.ToolChoice.Type == "none" {
+		// none 时不携带工具定义，兼容不支持 none 的旧版本
+		result.Tools = nil
+		result.ToolChoice = nil
+	}
+
+	// 消息：system 消息提取到 system 字段，tool 消息转换为 tool_result，连续同角色消息合并
+	var systemTexts []string
+	var messages []anthropicMessageBuilder
+	appendBlocks := func(role string, blocks []model.AnthropicContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1].role == role {
+			messages[n-1].blocks = append(messages[n-1].blocks, blocks...)
+			return
+		}
+		messages = append(messages, anthropicMessageBuilder{role: role, blocks: blocks})
+	}
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := chatContentText(msg.Content); text != "" {
+				systemTexts = append(systemTexts, text)
+			}
+		case "tool":
+			appendBlocks("user", []model.AnthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   mustMarshal(chatContentText(msg.Content)),
+			}})
+		case "assistant":
+			blocks := chatContentToAnthropic(msg.Content)
+			for _, tc := range msg.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) || len(input) == 0 {
+					input = json.RawMessage(`{}`)
+				}
+				blocks = append(blocks, model.AnthropicContentBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+			appendBlocks("assistant", blocks)
+		default:
+			appendBlocks("user", chatContentToAnthropic(msg.Content))
+		}
+	}
+
+	if len(systemTexts) > 0 {
+		result.System = mustMarshal(strings.Join(systemTexts, "\n\n"))
+	}
+	for _, m := range messages {
+		result.Messages = append(result.Messages, model.AnthropicMessage{Role: m.role, Content: mustMarshal(m.blocks)})
+	}
+	if len(result.Messages) == 0 {
+		return nil, fmt.Errorf("messages is required")
+	}
+	return result, nil
+}
+
+// anthropicMessageBuilder 构建 Anthropic 消息（用于合并连续同角色消息）
+type anthropicMessageBuilder struct {
+	role   string
+	blocks []model.AnthropicContentBlock
+}
+
+// chatToolChoiceToAnthropic 转换工具选择
+func chatToolChoiceToAnthropic(toolChoice interface{}) *model.AnthropicToolChoice {
+	switch tc := toolChoice.(type) {
+	case string:
+		switch tc {
+		case "auto":
+			return &model.AnthropicToolChoice{Type: "auto"}
+		case "required":
+			return &model.AnthropicToolChoice{Type: "any"}
+		case "none":
+			return &model.AnthropicToolChoice{Type: "none"}
+		}
+	case map[string]interface{}:
+		if fn, ok := tc["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok {
+				return &model.AnthropicToolChoice{Type: "tool", Name: name}
+			}
+		}
+	}
+	return nil
+}
+
+// chatContentToAnthropic 将 chat 消息内容转换为 Anthropic 内容块
+func chatContentToAnthropic(content interface{}) []model.AnthropicContentBlock {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []model.AnthropicContentBlock{{Type: "text", Text: c}}
+	case []interface{}:
+		var blocks []model.AnthropicContentBlock
+		for _, part := range c {
+			m, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				if text, _ := m["text"].(string); text != "" {
+					blocks = append(blocks, model.AnthropicContentBlock{Type: "text", Text: text})
+				}
+			case "image_url":
+				imageURL, _ := m["image_url"].(map[string]interface{})
+				url, _ := imageURL["url"].(string)
+				if source := imageURLToAnthropic(url); source != nil {
+					blocks = append(blocks, model.AnthropicContentBlock{Type: "image", Source: source})
+				}
+			}
+		}
+		return blocks
+	}
+	return nil
+}
+
+// imageURLToAnthropic 将图片 URL（支持 data URL）转换为 Anthropic 图片来源
+func imageURLToAnthropic(url string) *model.AnthropicImageSource {
+	if url == "" {
+		return nil
+	}
+	// data:image/png;base64,xxxx
+	if strings.HasPrefix(url, "data:") {
+		meta, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !found {
+			return nil
+		}
+		return &model.AnthropicImageSource{Type: "base64", MediaType: strings.TrimSuffix(meta, ";base64"), Data: data}
+	}
+	return &model.AnthropicImageSource{Type: "url", URL: url}
+}
+
+// AnthropicResponseToChat 将 Anthropic Messages 响应转换为 OpenAI chat 响应
+func AnthropicResponseToChat(resp *model.AnthropicMessagesResponse) *model.ChatCompletionResponse {
+	message := &model.ChatMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, model.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+	message.Content = text.String()
+
+	finishReason := anthropicStopReasonToChat(resp.StopReason)
+	return &model.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []model.Choice{{Index: 0, Message: message, FinishReason: &finishReason}},
+		Usage:   anthropicUsageToChat(resp.Usage),
+	}
+}
+
+// anthropicStopReasonToChat 转换结束原因
+func anthropicStopReasonToChat(stopReason *string) string {
+	if stopReason == nil {
+		return "stop"
+	}
+	switch *stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// anthropicUsageToChat 转换使用量统计（Anthropic 的 input_tokens 不含缓存部分）
+func anthropicUsageToChat(usage *model.AnthropicUsage) *model.Usage {
+	if usage == nil {
+		return nil
+	}
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	result := &model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 {
+		result.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: usage.CacheReadInputTokens}
+	}
+	return result
+}
+
+// anthropicErrorToOpenAI 将 Anthropic 错误响应体转换为 OpenAI 错误格式
+func anthropicErrorToOpenAI(body []byte) []byte {
+	var anthropicErr model.AnthropicError
+	if err := json.Unmarshal(body, &anthropicErr); err != nil || anthropicErr.Error.Message == "" {
+		return body
+	}
+	code := anthropicErr.Error.Type
+	return mustMarshal(model.NewOpenAIError(anthropicErr.Error.Message, anthropicErr.Error.Type, &code))
+}
+
+// convertAnthropicStreamToChat 将 Anthropic 流式事件转换为 OpenAI chat 流式数据块
+func convertAnthropicStreamToChat(reader *bufio.Reader, w io.Writer, includeUsage bool) error {
+	var (
+		id        string
+		modelName string
+		created   = time.Now().Unix()
+		usage     model.AnthropicUsage
+		toolIndex = make(map[int]int) // Anthropic 内容块序号 -> OpenAI tool_calls 序号
+	)
+
+	writeChunk := func(choices []model.Choice, u *model.Usage) error {
+		if choices == nil {
+			choices = []model.Choice{}
+		}
+		data, err := json.Marshal(model.ChatCompletionChunk{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: modelName, Choices: choices, Usage: u,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+	writeDelta := func(delta *model.ChatMessage, finishReason *string) error {
+		return writeChunk([]model.Choice{{Index: 0, Delta: delta, FinishReason: finishReason}}, nil)
+	}
+
+	for {
+		ev, err := readSSEEvent(reader)
+		if err != nil {
+			if err == io.EOF {
+				// 未收到 message_stop，视为流被截断
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if len(ev.Data) == 0 {
+			continue
+		}
+
+		var event model.AnthropicStreamEvent
+		if err := json.Unmarshal(ev.Data, &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				id = event.Message.ID
+				modelName = event.Message.Model
+				if event.Message.Usage != nil {
+					usage = *event.Message.Usage
+				}
+			}
+			if err := writeDelta(&model.ChatMessage{Role: "assistant", Content: ""}, nil); err != nil {
+				return err
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" && event.Index != nil {
+				idx := len(toolIndex)
+				toolIndex[*event.Index] = idx
+				if err := writeDelta(&model.ChatMessage{ToolCalls: []model.ToolCall{{
+					Index:    intPtr(idx),
+					ID:       event.ContentBlock.ID,
+					Type:     "function",
+					Function: model.FunctionCall{Name: event.ContentBlock.Name, Arguments: ""},
+				}}}, nil); err != nil {
+					return err
+				}
+			}
+		case "content_block_delta":
+			if event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				if err := writeDelta(&model.ChatMessage{Content: event.Delta.Text}, nil); err != nil {
+					return err
+				}
+			case "input_json_delta":
+				if event.Index == nil {
+					continue
+				}
+				if err := writeDelta(&model.ChatMessage{ToolCalls: []model.ToolCall{{
+					Index:    intPtr(toolIndex[*event.Index]),
+					Function: model.FunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}, nil); err != nil {
+					return err
+				}
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+				// 部分兼容实现在 message_delta 中才返回输入 token
+				if event.Usage.InputTokens > 0 {
+					usage.InputTokens = event.Usage.InputTokens
+				}
+			}
+			if event.Delta != nil && event.Delta.StopReason != nil {
+				finishReason := anthropicStopReasonToChat(event.Delta.StopReason)
+				if err := writeDelta(&model.ChatMessage{}, &finishReason); err != nil {
+					return err
+				}
+			}
+		case "message_stop":
+			if includeUsage {
+				if err := writeChunk(nil, anthropicUsageToChat(&usage)); err != nil {
+					return err
+				}
+			}
+			_, err := io.WriteString(w, "data: [DONE]\n\n")
+			return err
+		case "error":
+			// 转换为 OpenAI 错误格式，便于上层检测流内错误
+			errDetail := model.AnthropicErrorDetail{Type: "api_error", Message: "upstream stream error"}
+			if event.Error != nil {
+				errDetail = *event.Error
+			}
+			code := errDetail.Type
+			_, err := fmt.Fprintf(w, "data: %s\n\n", mustMarshal(model.NewOpenAIError(errDetail.Message, errDetail.Type, &code)))
+			return err
+		}
+	}
+}
+
+// mustMarshal 序列化为 JSON（用于已知可序列化的值）
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
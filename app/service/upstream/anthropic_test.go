@@ -0,0 +1,326 @@
+package upstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"gin_base/app/model"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// normalizeJSON 将值序列化后再解析为通用结构（去掉顶层随时间变化的 created 字段），用于与期望的 JSON 比较
+func normalizeJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", v, err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	if m, ok := result.(map[string]interface{}); ok {
+		delete(m, "created")
+	}
+	return result
+}
+
+// assertJSON 检查 got 与期望的 JSON 是否一致（忽略键顺序和空白）
+func assertJSON(t *testing.T, name string, got interface{}, want string) {
+	t.Helper()
+	var wantValue interface{}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("%s: invalid expected JSON: %v", name, err)
+	}
+	if gotValue := normalizeJSON(t, got); !reflect.DeepEqual(gotValue, wantValue) {
+		gotJSON, _ := json.Marshal(gotValue)
+		t.Errorf("%s:\n got: %s\nwant: %s", name, gotJSON, want)
+	}
+}
+
+// sseOutput 转换后的一个 SSE 事件
+type sseOutput struct {
+	Event string      `json:"event,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// convertStream 使用 convert 转换 SSE 输入，返回输出的事件（JSON 数据去掉 created 字段，非 JSON 数据保留原文）
+func convertStream(t *testing.T, input string, convert func(reader *bufio.Reader, w io.Writer) error) ([]sseOutput, error) {
+	t.Helper()
+	var out strings.Builder
+	err := convert(bufio.NewReader(strings.NewReader(input)), &out)
+	var events []sseOutput
+	reader := bufio.NewReader(strings.NewReader(out.String()))
+	for {
+		ev, readErr := readSSEEvent(reader)
+		if readErr != nil {
+			break
+		}
+		var data interface{}
+		if json.Unmarshal(ev.Data, &data) == nil {
+			if m, ok := data.(map[string]interface{}); ok {
+				delete(m, "created")
+			}
+		} else {
+			data = string(ev.Data)
+		}
+		events = append(events, sseOutput{Event: ev.Event, Data: data})
+	}
+	return events, err
+}
+
+// sse 拼接 SSE 事件（每个元素为 "事件名|数据"，事件名为空时只输出 data）
+func sse(events ...string) string {
+	var sb strings.Builder
+	for _, e := range events {
+		name, data, found := strings.Cut(e, "|")
+		if !found {
+			name, data = "", e
+		}
+		if name != "" {
+			sb.WriteString("event: " + name + "\n")
+		}
+		sb.WriteString("data: " + data + "\n\n")
+	}
+	return sb.String()
+}
+
+func TestChatToAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "system prompts, sampling and merged user turns",
+			req: `{"model":"claude","max_tokens":100,"max_completion_tokens":200,"stop":"END","temperature":0.5,"messages":[
+				{"role":"system","content":"A"},
+				{"role":"developer","content":[{"type":"text","text":"B"}]},
+				{"role":"user","content":"hi"},
+				{"role":"user","content":[{"type":"text","text":"there"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			want: `{"model":"claude","max_tokens":200,"system":"A\n\nB","stop_sequences":["END"],"temperature":0.5,"messages":[
+				{"role":"user","content":[
+					{"type":"text","text":"hi"},
+					{"type":"text","text":"there"},
+					{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}},
+					{"type":"image","source":{"type":"url","url":"https://example.com/a.png"}}]}]}`,
+		},
+		{
+			name: "tool calls and tool results",
+			req: `{"model":"claude","messages":[
+				{"role":"user","content":"weather?"},
+				{"role":"assistant","content":"","tool_calls":[
+					{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+					{"id":"call_2","type":"function","function":{"name":"noop","arguments":""}}]},
+				{"role":"tool","tool_call_id":"call_1","content":"sunny"},
+				{"role":"tool","tool_call_id":"call_2","content":"ok"}],
+				"tools":[
+					{"type":"function","function":{"name":"get_weather","description":"Get weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}},
+					{"type":"function","function":{"name":"noop"}}],
+				"tool_choice":"required","parallel_tool_calls":false}`,
+			want: `{"model":"claude","max_tokens":4096,"messages":[
+				{"role":"user","content":[{"type":"text","text":"weather?"}]},
+				{"role":"assistant","content":[
+					{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}},
+					{"type":"tool_use","id":"call_2","name":"noop","input":{}}]},
+				{"role":"user","content":[
+					{"type":"tool_result","tool_use_id":"call_1","content":"sunny"},
+					{"type":"tool_result","tool_use_id":"call_2","content":"ok"}]}],
+				"tools":[
+					{"name":"get_weather","description":"Get weather","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}},
+					{"name":"noop","input_schema":{"type":"object","properties":{}}}],
+				"tool_choice":{"type":"any","disable_parallel_tool_use":true}}`,
+		},
+		{
+			name: "named tool choice",
+			req:  `{"model":"claude","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}],"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+			want: `{"model":"claude","max_tokens":10,"messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}],
+				"tools":[{"name":"f","input_schema":{"type":"object","properties":{}}}],"tool_choice":{"type":"tool","name":"f"}}`,
+		},
+		{
+			name: "tool choice none drops tools",
+			req:  `{"model":"claude","max_tokens":10,"stop":["a","b"],"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}],"tool_choice":"none"}`,
+			want: `{"model":"claude","max_tokens":10,"stop_sequences":["a","b"],"messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`,
+		},
+		{
+			name:    "only system messages",
+			req:     `{"model":"claude","messages":[{"role":"system","content":"A"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		var req model.ChatCompletionRequest
+		if err := json.Unmarshal([]byte(tt.req), &req); err != nil {
+			t.Fatalf("%s: invalid request: %v", tt.name, err)
+		}
+		got, err := ChatToAnthropicRequest(&req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			assertJSON(t, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnthropicResponseToChat(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{
+			name: "text and tool use",
+			resp: `{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[
+				{"type":"thinking","thinking":"hmm","signature":"s"},
+				{"type":"text","text":"Let me check."},
+				{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":20,"cache_creation_input_tokens":3}}`,
+			want: `{"id":"msg_1","object":"chat.completion","model":"claude","choices":[{"index":0,"message":{"role":"assistant","content":"Let me check.",
+				"tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":33,"completion_tokens":5,"total_tokens":38,"prompt_tokens_details":{"cached_tokens":20}}}`,
+		},
+		{
+			name: "max tokens without usage",
+			resp: `{"id":"msg_2","model":"claude","content":[{"type":"text","text":"a"},{"type":"text","text":"b"}],"stop_reason":"max_tokens"}`,
+			want: `{"id":"msg_2","object":"chat.completion","model":"claude","choices":[{"index":0,"message":{"role":"assistant","content":"ab"},"finish_reason":"length"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		var resp model.AnthropicMessagesResponse
+		if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", tt.name, err)
+		}
+		assertJSON(t, tt.name, AnthropicResponseToChat(&resp), tt.want)
+	}
+}
+
+func TestAnthropicStopReasonToChat(t *testing.T) {
+	tests := []struct {
+		stopReason string
+		want       string
+	}{
+		{"end_turn", "stop"},
+		{"stop_sequence", "stop"},
+		{"max_tokens", "length"},
+		{"tool_use", "tool_calls"},
+		{"refusal", "content_filter"},
+	}
+	for _, tt := range tests {
+		stopReason := tt.stopReason
+		if got := anthropicStopReasonToChat(&stopReason); got != tt.want {
+			t.Errorf("anthropicStopReasonToChat(%q) = %q, want %q", tt.stopReason, got, tt.want)
+		}
+	}
+	if got := anthropicStopReasonToChat(nil); got != "stop" {
+		t.Errorf("anthropicStopReasonToChat(nil) = %q, want stop", got)
+	}
+}
+
+func TestAnthropicErrorToOpenAI(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "anthropic error",
+			body: `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			want: `{"error":{"message":"Overloaded","type":"overloaded_error","param":null,"code":"overloaded_error"}}`,
+		},
+		{name: "not an anthropic error", body: `upstream unavailable`, want: `upstream unavailable`},
+	}
+	for _, tt := range tests {
+		got := anthropicErrorToOpenAI([]byte(tt.body))
+		if json.Valid([]byte(tt.want)) {
+			assertJSON(t, tt.name, json.RawMessage(got), tt.want)
+		} else if string(got) != tt.want {
+			t.Errorf("%s: got %s, want unchanged %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConvertAnthropicStreamToChat(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		includeUsage bool
+		want         string
+		wantErr      bool
+	}{
+		{
+			name: "text and tool use with usage",
+			input: sse(
+				`message_start|{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+				`content_block_start|{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`ping|{"type":"ping"}`,
+				`content_block_delta|{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+				`content_block_stop|{"type":"content_block_stop","index":0}`,
+				`content_block_start|{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"f","input":{}}}`,
+				`content_block_delta|{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":"}}`,
+				`content_block_delta|{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"1}"}}`,
+				`content_block_stop|{"type":"content_block_stop","index":1}`,
+				`message_delta|{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+				`message_stop|{"type":"message_stop"}`,
+			),
+			includeUsage: true,
+			want: `[
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":null,"tool_calls":[{"index":0,"id":"toolu_1","type":"function","function":{"name":"f","arguments":""}}]},"finish_reason":null}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":null,"tool_calls":[{"index":0,"id":"","type":"","function":{"name":"","arguments":"{\"a\":"}}]},"finish_reason":null}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":null,"tool_calls":[{"index":0,"id":"","type":"","function":{"name":"","arguments":"1}"}}]},"finish_reason":null}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":null},"finish_reason":"tool_calls"}]}},
+				{"data":{"id":"msg_1","object":"chat.completion.chunk","model":"claude","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":7,"total_tokens":17}}},
+				{"data":"[DONE]"}]`,
+		},
+		{
+			name: "text without usage",
+			input: sse(
+				`message_start|{"type":"message_start","message":{"id":"msg_2","model":"claude","content":[],"usage":{"input_tokens":3,"output_tokens":1}}}`,
+				`content_block_delta|{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+				`message_delta|{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+				`message_stop|{"type":"message_stop"}`,
+			),
+			want: `[
+				{"data":{"id":"msg_2","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"id":"msg_2","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}},
+				{"data":{"id":"msg_2","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":null},"finish_reason":"stop"}]}},
+				{"data":"[DONE]"}]`,
+		},
+		{
+			name: "error event",
+			input: sse(
+				`message_start|{"type":"message_start","message":{"id":"msg_3","model":"claude","content":[]}}`,
+				`error|{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			),
+			want: `[
+				{"data":{"id":"msg_3","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"error":{"message":"Overloaded","type":"overloaded_error","param":null,"code":"overloaded_error"}}}]`,
+		},
+		{
+			name: "truncated stream",
+			input: sse(
+				`message_start|{"type":"message_start","message":{"id":"msg_4","model":"claude","content":[]}}`,
+				`content_block_delta|{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			),
+			want: `[
+				{"data":{"id":"msg_4","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"id":"msg_4","object":"chat.completion.chunk","model":"claude","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		events, err := convertStream(t, tt.input, func(reader *bufio.Reader, w io.Writer) error {
+			return convertAnthropicStreamToChat(reader, w, tt.includeUsage)
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		assertJSON(t, tt.name, events, tt.want)
+	}
+}
@@ -0,0 +1,213 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"gin_base/app/service/tracing"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	latencyEWMAAlpha  = 0.2 // EWMA 平滑系数（越大越偏向最近的样本）
+	latencyWindowSize = 64  // 计算 P50 延迟的滑动窗口大小
+)
+
+// latencyStats 延迟统计（EWMA 延迟、EWMA 首 token 时间、滑动窗口 P50）
+type latencyStats struct {
+	mu        sync.Mutex
+	ewmaMs    float64   // 总延迟 EWMA（毫秒）
+	ttftMs    float64   // 首 token 时间 EWMA（毫秒）
+	window    []float64 // 最近的总延迟样本（毫秒）
+	windowPos int
+	samples   int64 // 样本总数
+}
+
+// observe 记录一次成功请求的延迟
+func (s *latencyStats) observe(latency, ttft time.Duration) {
+	latencyMs := float64(latency) / float64(time.Millisecond)
+	ttftMs := float64(ttft) / float64(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples == 0 {
+		s.ewmaMs = latencyMs
+		s.ttftMs = ttftMs
+	} else {
+		s.ewmaMs = latencyEWMAAlpha*latencyMs + (1-latencyEWMAAlpha)*s.ewmaMs
+		s.ttftMs = latencyEWMAAlpha*ttftMs + (1-latencyEWMAAlpha)*s.ttftMs
+	}
+	if len(s.window) < latencyWindowSize {
+		s.window = append(s.window, latencyMs)
+	} else {
+		s.window[s.windowPos] = latencyMs
+		s.windowPos = (s.windowPos + 1) % latencyWindowSize
+	}
+	s.samples++
+}
+
+// snapshot 获取当前延迟统计：EWMA 延迟、P50 延迟、EWMA 首 token 时间（毫秒）及样本数
+func (s *latencyStats) snapshot() (ewmaMs, p50Ms, ttftMs float64, samples int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.window) > 0 {
+		sorted := append([]float64(nil), s.window...)
+		sort.Float64s(sorted)
+		p50Ms = sorted[len(sorted)/2]
+	}
+	return s.ewmaMs, p50Ms, s.ttftMs, s.samples
+}
+
+// Attempt 单次上游请求尝试（用于统计并发数和延迟，并记录追踪跨度）
+type Attempt struct {
+	provider   *Provider
+	alias      string
+	upstream   string
+	stats      *ModelStats
+	trial      *ModelHealth // 半开状态下的试探请求（结束时释放试探名额）
+	series     *timeSeries
+	ctx        context.Context
+	span       *tracing.Span
+	start      time.Time
+	ttft       time.Duration
+	duration   time.Duration
+	statusCode int
+	err        error
+	success    bool
+	finished   atomic.Bool
+}
+
+// AttemptSummary 单次尝试的结果摘要（用于请求记录）
+type AttemptSummary struct {
+	Provider      string `json:"provider"`
+	UpstreamModel string `json:"upstream_model"`
+	Status        int    `json:"status,omitempty"` // 上游状态码（未收到响应时为 0）
+	Success       bool   `json:"success"`
+	Error         string `json:"error,omitempty"`
+	LatencyMs     int64  `json:"latency_ms"`
+	TtftMs        int64  `json:"ttft_ms,omitempty"`
+}
+
+// StartAttempt 开始一次上游请求尝试：并发数 +1（半开状态下同时占用一个试探名额），开始计时，并在 ctx 的链路下创建尝试跨度
+// 上游请求应使用 Attempt.Context()；调用方必须在尝试结束后调用 Finish
+func (m *Manager) StartAttempt(ctx context.Context, p *Provider, alias string, upstreamModel string) *Attempt {
+	a := &Attempt{provider: p, alias: alias, upstream: upstreamModel, start: time.Now(), series: p.modelSeries[upstreamModel]}
+	a.ctx, a.span = tracing.Start(ctx, "upstream "+p.Config.Name, tracing.KindClient,
+		"provider", p.Config.Name,
+		"provider.type", p.Config.Type,
+		"model.alias", alias,
+		"model.upstream", upstreamModel,
+	)
+	if stats, exists := p.modelStats[alias+"|"+upstreamModel]; exists {
+		a.stats = stats
+		stats.InFlight.Add(1)
+	}
+	if health, exists := p.modelHealths[upstreamModel]; exists && health.state.Load() == breakerHalfOpen {
+		a.trial = health
+		health.halfOpenTrials.Add(1)
+	}
+	return a
+}
+
+// Context 本次尝试的上下文（携带尝试跨度，用于发送上游请求）
+func (a *Attempt) Context() context.Context {
+	return a.ctx
+}
+
+// SetResponse 记录上游响应的状态码和响应体字节数
+func (a *Attempt) SetResponse(statusCode int, bytes int64) {
+	a.statusCode = statusCode
+	a.span.SetAttributes("http.status_code", statusCode, "response.bytes", bytes)
+}
+
+// SetError 记录本次尝试的错误（err 为 nil 时忽略）
+func (a *Attempt) SetError(err error) {
+	if err != nil {
+		a.err = err
+	}
+}
+
+// FirstToken 标记收到首个 token（流式为首个有效数据块，非流式为响应头）
+func (a *Attempt) FirstToken() {
+	if a.ttft == 0 {
+		a.ttft = time.Since(a.start)
+	}
+}
+
+// Finish 结束请求尝试：并发数 -1，成功时记录延迟，并结束尝试跨度（重复调用无效）
+func (a *Attempt) Finish(success bool) {
+	if !a.finished.CompareAndSwap(false, true) {
+		return
+	}
+	a.duration = time.Since(a.start)
+	a.success = success
+	a.finishSpan(success)
+	if a.trial != nil {
+		a.trial.halfOpenTrials.Add(-1)
+	}
+	if a.stats == nil {
+		return
+	}
+	a.stats.InFlight.Add(-1)
+	if success {
+		latency := time.Since(a.start)
+		ttft := a.ttft
+		if ttft == 0 {
+			ttft = latency
+		}
+		a.stats.latency.observe(latency, ttft)
+		if a.series != nil {
+			a.series.observeLatency(time.Now(), latency, ttft)
+		}
+		observeAttemptMetrics(a.provider, a.alias, a.upstream, latency, ttft)
+	}
+}
+
+// StartTime 本次尝试的开始时间
+func (a *Attempt) StartTime() time.Time {
+	return a.start
+}
+
+// TTFT 本次尝试的首 token 时间（未收到时为 0）
+func (a *Attempt) TTFT() time.Duration {
+	return a.ttft
+}
+
+// Summary 本次尝试的结果摘要（应在 Finish 之后调用）
+func (a *Attempt) Summary() AttemptSummary {
+	s := AttemptSummary{
+		Provider:      a.provider.Config.Name,
+		UpstreamModel: a.upstream,
+		Status:        a.statusCode,
+		Success:       a.success,
+		LatencyMs:     a.duration.Milliseconds(),
+		TtftMs:        a.ttft.Milliseconds(),
+	}
+	if a.err != nil {
+		s.Error = a.err.Error()
+	}
+	return s
+}
+
+// finishSpan 结束尝试跨度：记录首 token 时间和结果
+func (a *Attempt) finishSpan(success bool) {
+	if a.span == nil {
+		return
+	}
+	if a.ttft > 0 {
+		a.span.SetAttributes("ttft_ms", a.ttft)
+	}
+	switch {
+	case success:
+		a.span.SetOK()
+	case a.err != nil:
+		a.span.SetError(a.err)
+	case a.statusCode != 0:
+		a.span.SetError(fmt.Errorf("upstream returned status %d", a.statusCode))
+	default:
+		a.span.SetError(fmt.Errorf("attempt failed"))
+	}
+	a.span.End()
+}
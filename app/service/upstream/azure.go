@@ -0,0 +1,35 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const defaultAzureAPIVersion = "2024-10-21"
+
+// azureAPIVersion 获取 Azure OpenAI 的 api-version 查询参数
+func (p *Provider) azureAPIVersion() string {
+	if p.Config.APIVersion != "" {
+		return p.Config.APIVersion
+	}
+	return defaultAzureAPIVersion
+}
+
+// azureDeploymentPath 将 OpenAI 接口路径转换为 Azure 部署路径
+// 如 /v1/chat/completions -> /openai/deployments/{deployment}/chat/completions?api-version=xxx
+// 部署名取自请求体中的 model（即模型映射的 upstream）
+func (p *Provider) azureDeploymentPath(path string, body []byte) (string, error) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", fmt.Errorf("parse request model failed: %w", err)
+	}
+	if req.Model == "" {
+		return "", fmt.Errorf("model is required for azure deployment")
+	}
+	return "/openai/deployments/" + url.PathEscape(req.Model) + strings.TrimPrefix(path, "/v1") +
+		"?api-version=" + url.QueryEscape(p.azureAPIVersion()), nil
+}
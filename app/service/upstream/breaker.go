@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"math/rand"
+	"time"
+)
+
+// 恢复模式
+const (
+	RecoveryModeBreaker = "breaker" // 熔断器：冷却后放行部分真实流量试探，连续成功后恢复（默认）
+	RecoveryModeProbe   = "probe"   // 探测：健康检查时发起一次最小请求，成功即恢复
+)
+
+// 熔断器状态
+const (
+	breakerClosed   int32 = iota // 关闭（健康，正常接收流量）
+	breakerOpen                  // 打开（不健康，不接收流量）
+	breakerHalfOpen              // 半开（放行部分流量试探）
+)
+
+const (
+	defaultHalfOpenRatio     = 0.1 // 半开状态默认放行比例
+	defaultHalfOpenSuccesses = 3   // 半开状态默认需连续成功次数
+)
+
+// breakerStateName 熔断器状态名称
+func breakerStateName(state int32) string {
+	switch state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+// isHealthy 是否健康（熔断器关闭）
+func (h *ModelHealth) isHealthy() bool {
+	return h.state.Load() == breakerClosed
+}
+
+// admit 判断该 upstream 是否接收本次请求
+// 熔断器模式下，打开状态冷却 recoveryInterval 后转为半开，半开状态按 halfOpenRatio 放行
+// 半开状态同时进行的试探请求不超过 halfOpenSuccesses 个，避免突发流量同时压到刚恢复的上游
+func (m *Manager) admit(p *Provider, upstreamModel string, health *ModelHealth) bool {
+	switch health.state.Load() {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if m.recoveryMode != RecoveryModeBreaker {
+			return false
+		}
+		if time.Since(time.Unix(0, health.OpenedAt.Load())) < m.recoveryInterval {
+			return false
+		}
+		if health.state.CompareAndSwap(breakerOpen, breakerHalfOpen) {
+			health.halfOpenSuccesses.Store(0)
+			log_helper.Info(fmt.Sprintf("Provider %s upstream model %s circuit half-open, allowing trial traffic", p.Config.Name, upstreamModel))
+		}
+	}
+	if int(health.halfOpenTrials.Load()) >= m.halfOpenSuccesses {
+		return false
+	}
+	return rand.Float64() < m.halfOpenRatio
+}
+
+// tryOpen 从指定状态打开熔断器（标记为不健康），返回是否由本次调用完成切换
+// 先记录打开时间再切换状态，避免并发的 admit 读到旧的打开时间而提前进入半开
+func (h *ModelHealth) tryOpen(from int32) bool {
+	h.OpenedAt.Store(time.Now().UnixNano())
+	if !h.state.CompareAndSwap(from, breakerOpen) {
+		return false
+	}
+	h.halfOpenSuccesses.Store(0)
+	return true
+}
+
+// closeCircuit 关闭熔断器（恢复健康）
+func (h *ModelHealth) closeCircuit() {
+	h.FailureCount.Store(0)
+	h.halfOpenSuccesses.Store(0)
+	h.state.Store(breakerClosed)
+}
+
+// recordBreakerSuccess 根据熔断器状态处理一次成功请求
+func (m *Manager) recordBreakerSuccess(p *Provider, upstreamModel string, health *ModelHealth) {
+	state := health.state.Load()
+	if state == breakerClosed {
+		health.FailureCount.Store(0)
+		return
+	}
+
+	// 探测模式：任意一次成功即恢复
+	if m.recoveryMode != RecoveryModeBreaker {
+		health.closeCircuit()
+		log_helper.Info(fmt.Sprintf("Provider %s upstream model %s recovered and marked as healthy", p.Config.Name, upstreamModel))
+		return
+	}
+
+	// 熔断器模式：打开状态下的成功（如所有候选均不健康时的兜底请求）同样进入半开计数
+	if state == breakerOpen {
+		health.state.CompareAndSwap(breakerOpen, breakerHalfOpen)
+	}
+	successes := health.halfOpenSuccesses.Add(1)
+	if int(successes) >= m.halfOpenSuccesses && health.state.CompareAndSwap(breakerHalfOpen, breakerClosed) {
+		health.FailureCount.Store(0)
+		health.halfOpenSuccesses.Store(0)
+		log_helper.Info(fmt.Sprintf("Provider %s upstream model %s circuit closed after %d successful trial requests", p.Config.Name, upstreamModel, successes))
+	}
+}
+
+// recordBreakerFailure 根据熔断器状态处理一次失败请求
+func (m *Manager) recordBreakerFailure(p *Provider, upstreamModel string, health *ModelHealth) {
+	failures := health.FailureCount.Add(1)
+	health.LastFailure.Store(time.Now().Unix())
+
+	switch health.state.Load() {
+	case breakerClosed:
+		// 窗口错误率模式：最近窗口内的错误占比达到阈值才熔断
+		if m.errorRateThreshold > 0 {
+			if exceeded, rate := m.windowedErrorRateExceeded(p, upstreamModel, health); exceeded && health.tryOpen(breakerClosed) {
+				log_helper.Warning(fmt.Sprintf("Provider %s upstream model %s marked as unhealthy, error rate %.1f%% in the last %s", p.Config.Name, upstreamModel, rate, m.errorRateWindow))
+			}
+			return
+		}
+		if int(failures) >= health.maxFailures && health.tryOpen(breakerClosed) {
+			log_helper.Warning(fmt.Sprintf("Provider %s upstream model %s marked as unhealthy after %d consecutive failures", p.Config.Name, upstreamModel, failures))
+		}
+	case breakerHalfOpen:
+		// 半开状态下任意失败立即重新打开，重新冷却
+		if health.tryOpen(breakerHalfOpen) {
+			log_helper.Warning(fmt.Sprintf("Provider %s upstream model %s trial request failed, circuit re-opened", p.Config.Name, upstreamModel))
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package upstream
+
+import (
+	"context"
+	"gin_base/app/helper/log_helper"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain 在临时目录中初始化日志（熔断器状态切换会写日志，避免在源码目录下生成日志文件）
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "upstream-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	log_helper.InitlogHelper()
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestBreaker 创建熔断器模式的 Manager 和单模型 Provider：连续失败 2 次打开，半开全量放行，连续成功 2 次关闭
+func newTestBreaker() (*Manager, *Provider, *ModelHealth) {
+	m := &Manager{
+		recoveryMode:      RecoveryModeBreaker,
+		recoveryInterval:  time.Minute,
+		halfOpenRatio:     1,
+		halfOpenSuccesses: 2,
+	}
+	health := &ModelHealth{maxFailures: 2}
+	p := &Provider{
+		Config:       ProviderConfig{Name: "p"},
+		modelHealths: map[string]*ModelHealth{"m": health},
+	}
+	return m, p, health
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	type step struct {
+		op        string // fail / succeed / admit / elapse（冷却时间已过）
+		wantAdmit bool
+		wantState int32
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "closed to open to half-open to closed",
+			steps: []step{
+				{op: "fail", wantState: breakerClosed},
+				{op: "fail", wantState: breakerOpen},
+				{op: "admit", wantAdmit: false, wantState: breakerOpen},
+				{op: "elapse", wantState: breakerOpen},
+				{op: "admit", wantAdmit: true, wantState: breakerHalfOpen},
+				{op: "succeed", wantState: breakerHalfOpen},
+				{op: "succeed", wantState: breakerClosed},
+				{op: "admit", wantAdmit: true, wantState: breakerClosed},
+			},
+		},
+		{
+			name: "half-open failure re-opens",
+			steps: []step{
+				{op: "fail", wantState: breakerClosed},
+				{op: "fail", wantState: breakerOpen},
+				{op: "elapse", wantState: breakerOpen},
+				{op: "admit", wantAdmit: true, wantState: breakerHalfOpen},
+				{op: "succeed", wantState: breakerHalfOpen},
+				{op: "fail", wantState: breakerOpen},
+				{op: "admit", wantAdmit: false, wantState: breakerOpen},
+			},
+		},
+		{
+			name: "success resets consecutive failures",
+			steps: []step{
+				{op: "fail", wantState: breakerClosed},
+				{op: "succeed", wantState: breakerClosed},
+				{op: "fail", wantState: breakerClosed},
+				{op: "admit", wantAdmit: true, wantState: breakerClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		m, p, health := newTestBreaker()
+		for i, s := range tt.steps {
+			switch s.op {
+			case "fail":
+				m.recordBreakerFailure(p, "m", health)
+			case "succeed":
+				m.recordBreakerSuccess(p, "m", health)
+			case "elapse":
+				health.OpenedAt.Store(time.Now().Add(-2 * m.recoveryInterval).UnixNano())
+			case "admit":
+				if got := m.admit(p, "m", health); got != s.wantAdmit {
+					t.Errorf("%s: step %d admit = %v, want %v", tt.name, i+1, got, s.wantAdmit)
+				}
+			}
+			if got := health.state.Load(); got != s.wantState {
+				t.Errorf("%s: step %d (%s) state = %s, want %s", tt.name, i+1, s.op, breakerStateName(got), breakerStateName(s.wantState))
+			}
+		}
+	}
+}
+
+func TestAdmitCapsHalfOpenTrials(t *testing.T) {
+	m, p, health := newTestBreaker()
+	health.state.Store(breakerHalfOpen)
+
+	var attempts []*Attempt
+	for i := 0; i < m.halfOpenSuccesses; i++ {
+		if !m.admit(p, "m", health) {
+			t.Fatalf("trial %d not admitted", i+1)
+		}
+		attempts = append(attempts, m.StartAttempt(context.Background(), p, "alias", "m"))
+	}
+	if m.admit(p, "m", health) {
+		t.Errorf("admitted more than %d concurrent trials", m.halfOpenSuccesses)
+	}
+
+	attempts[0].Finish(false)
+	if !m.admit(p, "m", health) {
+		t.Errorf("trial not admitted after a running trial finished")
+	}
+	attempts[0].Finish(false) // 重复结束不应再次释放名额
+	attempts[1].Finish(true)
+	if got := health.halfOpenTrials.Load(); got != 0 {
+		t.Errorf("halfOpenTrials = %d after all trials finished, want 0", got)
+	}
+}
@@ -0,0 +1,134 @@
+package upstream
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRateLimitCooldown = 10 * time.Second // 限流响应未给出重置时间时的默认冷却时间
+	maxRateLimitCooldown     = 10 * time.Minute // 冷却时间上限，避免异常的重置时间导致长期不可用
+)
+
+// rateLimitResetHeaders 上游返回的限流重置时间响应头（OpenAI / Anthropic 等）
+var rateLimitResetHeaders = []string{
+	"x-ratelimit-reset-requests",
+	"x-ratelimit-reset-tokens",
+	"x-ratelimit-reset",
+	"anthropic-ratelimit-requests-reset",
+	"anthropic-ratelimit-tokens-reset",
+	"anthropic-ratelimit-input-tokens-reset",
+	"anthropic-ratelimit-output-tokens-reset",
+}
+
+// parseRateLimitCooldown 从限流响应头解析冷却时间
+// 优先使用 Retry-After / retry-after-ms，否则取各 reset 头中最晚的重置时间，均无则使用默认值
+func parseRateLimitCooldown(header http.Header, now time.Time) time.Duration {
+	var cooldown time.Duration
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			cooldown = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if cooldown <= 0 {
+		cooldown = parseResetValue(header.Get("Retry-After"), now)
+	}
+	if cooldown <= 0 {
+		for _, name := range rateLimitResetHeaders {
+			if d := parseResetValue(header.Get(name), now); d > cooldown {
+				cooldown = d
+			}
+		}
+	}
+
+	if cooldown <= 0 {
+		return defaultRateLimitCooldown
+	}
+	if cooldown > maxRateLimitCooldown {
+		return maxRateLimitCooldown
+	}
+	return cooldown
+}
+
+// parseResetValue 解析单个重置时间值，支持：
+// 秒数（"30"、"1.5"）、Unix 时间戳、Go 风格时长（"6m0s"、"20ms"）、HTTP 日期、RFC3339 时间
+func parseResetValue(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		// 超过 10 亿视为 Unix 时间戳（秒）
+		if n > 1e9 {
+			return time.Unix(int64(n), 0).Sub(now)
+		}
+		return time.Duration(n * float64(time.Second))
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now)
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// inCooldown 是否处于限流冷却中
+func (h *ModelHealth) inCooldown(now time.Time) bool {
+	return h.CooldownUntil.Load() > now.UnixNano()
+}
+
+// RecordRateLimited 按限流响应（429）的重置时间让该 upstream 进入冷却，返回本次设置的冷却时间
+// 请求统计、故障转移和是否计入失败由调用方按重试策略记录，这里只叠加冷却
+func (m *Manager) RecordRateLimited(p *Provider, upstreamModel string, header http.Header) time.Duration {
+	cooldown := parseRateLimitCooldown(header, time.Now())
+	if health, exists := p.modelHealths[upstreamModel]; exists {
+		until := time.Now().Add(cooldown).UnixNano()
+		// 只延长不缩短：并发的限流响应以最晚的重置时间为准
+		for {
+			current := health.CooldownUntil.Load()
+			if current >= until || health.CooldownUntil.CompareAndSwap(current, until) {
+				break
+			}
+		}
+	}
+	log_helper.Warning(fmt.Sprintf("Provider %s upstream model %s rate limited, cooling down for %s", p.Config.Name, upstreamModel, cooldown.Round(time.Millisecond)))
+	return cooldown
+}
+
+// IsCoolingDown 检查 upstream 是否处于限流冷却中
+func (m *Manager) IsCoolingDown(p *Provider, upstreamModel string) bool {
+	if health, exists := p.modelHealths[upstreamModel]; exists {
+		return health.inCooldown(time.Now())
+	}
+	return false
+}
+
+// CooldownRemaining 别名的所有候选均处于限流冷却时，返回最短的剩余冷却时间；否则返回0
+func (m *Manager) CooldownRemaining(alias string) time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var remaining time.Duration
+	for _, p := range m.providers {
+		for _, idx := range p.modelIndex[alias] {
+			health, exists := p.modelHealths[p.Config.ModelMappings[idx].Upstream]
+			if !exists || !health.inCooldown(now) {
+				return 0
+			}
+			d := time.Duration(health.CooldownUntil.Load() - now.UnixNano())
+			if remaining == 0 || d < remaining {
+				remaining = d
+			}
+		}
+	}
+	return remaining
+}
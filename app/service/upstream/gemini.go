@@ -0,0 +1,569 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/model"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const defaultGeminiVersion = "v1beta"
+
+// geminiVersion 获取 Gemini 接口版本（URL 路径前缀）
+func (p *Provider) geminiVersion() string {
+	if p.Config.APIVersion != "" {
+		return p.Config.APIVersion
+	}
+	return defaultGeminiVersion
+}
+
+// geminiModelPath 获取 Gemini 模型接口路径，如 /v1beta/models/gemini-2.5-pro:generateContent
+func (p *Provider) geminiModelPath(modelName string, stream bool) string {
+	action := ":generateContent"
+	if stream {
+		action = ":streamGenerateContent?alt=sse"
+	}
+	return "/" + p.geminiVersion() + "/models/" + strings.TrimPrefix(modelName, "models/") + action
+}
+
+// proxyGemini 将 OpenAI chat 请求转换为 Gemini generateContent 请求发送，并将响应转换回 OpenAI 格式
+func (p *Provider) proxyGemini(ctx context.Context, path string, body []byte, headers map[string]string, stream bool) (*http.Response, error) {
+	if path != ChatCompletionsPath {
+		return nil, fmt.Errorf("gemini provider does not support %s", path)
+	}
+
+	var chatReq model.ChatCompletionRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		return nil, fmt.Errorf("parse chat request failed: %w", err)
+	}
+	geminiReq, err := ChatToGeminiRequest(&chatReq)
+	if err != nil {
+		return nil, err
+	}
+	geminiBody, err := json.Marshal(geminiReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal gemini request failed: %w", err)
+	}
+
+	req, err := p.newUpstreamRequest(ctx, "POST", p.geminiModelPath(chatReq.Model, stream), geminiBody)
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+
+	client := p.httpClient
+	if stream {
+		client = p.streamClient
+		req.Header.Set("Accept", "text/event-stream")
+		setForwardHeaders(req, headers, "Accept", "Content-Type")
+	} else {
+		setForwardHeaders(req, headers, "Content-Type")
+	}
+
+	resp, err := p.do(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 错误响应统一转换为 OpenAI 错误格式
+	if resp.StatusCode != http.StatusOK {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		return replaceResponseBody(resp, geminiErrorToOpenAI(respBody)), nil
+	}
+
+	if stream {
+		includeUsage := chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage
+		return wrapStreamResponse(resp, func(reader *bufio.Reader, w io.Writer) error {
+			return convertGeminiStreamToChat(reader, w, chatReq.Model, includeUsage)
+		}), nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var geminiResp model.GeminiResponse
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
+		return nil, fmt.Errorf("parse gemini response failed: %w", err)
+	}
+	newBody, err := json.Marshal(GeminiResponseToChat(&geminiResp, chatReq.Model))
+	if err != nil {
+		return nil, err
+	}
+	return replaceResponseBody(resp, newBody), nil
+}
+
+// ChatToGeminiRequest 将 OpenAI chat 请求转换为 Gemini generateContent 请求
+func ChatToGeminiRequest(req *model.ChatCompletionRequest) (*model.GeminiRequest, error) {
+	result := &model.GeminiRequest{}
+
+	// 生成配置
+	genConfig := &model.GeminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		CandidateCount:   req.N,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	if req.MaxCompletionTokens != nil && *req.MaxCompletionTokens > 0 {
+		genConfig.MaxOutputTokens = req.MaxCompletionTokens
+	} else if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		genConfig.MaxOutputTokens = req.MaxTokens
+	}
+	switch stop := req.Stop.(type) {
+	case string:
+		genConfig.StopSequences = []string{stop}
+	case []interface{}:
+		for _, s := range stop {
+			if str, ok := s.(string); ok {
+				genConfig.StopSequences = append(genConfig.StopSequences, str)
+			}
+		}
+	}
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case "json_object":
+			genConfig.ResponseMimeType = "application/json"
+		case "json_schema":
+			genConfig.ResponseMimeType = "application/json"
+			if schema, ok := req.ResponseFormat.JSONSchema.(map[string]interface{}); ok {
+				genConfig.ResponseJSONSchema = schema["schema"]
+			}
+		}
+	}
+	result.GenerationConfig = genConfig
+
+	// 工具
+	var declarations []model.GeminiFunctionDeclaration
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		declarations = append(declarations, model.GeminiFunctionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  cleanGeminiSchema(t.Function.Parameters),
+		})
+	}
+	if len(declarations) > 0 {
+		result.Tools = []model.GeminiTool{{FunctionDeclarations: declarations}}
+		result.ToolConfig = chatToolChoiceToGemini(req.ToolChoice)
+	}
+
+	// 消息：system 消息提取到 systemInstruction，tool 消息转换为 functionResponse，连续同角色消息合并
+	toolNames := make(map[string]string) // tool_call_id -> 函数名（functionResponse 需要函数名）
+	var systemParts []model.GeminiPart
+	appendParts := func(role string, parts []model.GeminiPart) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(result.Contents); n > 0 && result.Contents[n-1].Role == role {
+			result.Contents[n-1].Parts = append(result.Contents[n-1].Parts, parts...)
+			return
+		}
+		result.Contents = append(result.Contents, model.GeminiContent{Role: role, Parts: parts})
+	}
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := chatContentText(msg.Content); text != "" {
+				systemParts = append(systemParts, model.GeminiPart{Text: text})
+			}
+		case "tool":
+			appendParts("user", []model.GeminiPart{{FunctionResponse: &model.GeminiFunctionResponse{
+				Name:     toolNames[msg.ToolCallID],
+				Response: toolResultToGemini(chatContentText(msg.Content)),
+			}}})
+		case "assistant":
+			parts := chatContentToGemini(msg.Content)
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				var args map[string]interface{}
+				if tc.Function.Arguments != "" {
+					json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				}
+				parts = append(parts, model.GeminiPart{FunctionCall: &model.GeminiFunctionCall{Name: tc.Function.Name, Args: args}})
+			}
+			appendParts("model", parts)
+		default:
+			appendParts("user", chatContentToGemini(msg.Content))
+		}
+	}
+
+	if len(systemParts) > 0 {
+		result.SystemInstruction = &model.GeminiContent{Parts: systemParts}
+	}
+	if len(result.Contents) == 0 {
+		return nil, fmt.Errorf("messages is required")
+	}
+	return result, nil
+}
+
+// chatToolChoiceToGemini 转换工具选择
+func chatToolChoiceToGemini(toolChoice interface{}) *model.GeminiToolConfig {
+	var cfg *model.GeminiFunctionCallingConfig
+	switch tc := toolChoice.(type) {
+	case string:
+		switch tc {
+		case "auto":
+			cfg = &model.GeminiFunctionCallingConfig{Mode: "AUTO"}
+		case "required":
+			cfg = &model.GeminiFunctionCallingConfig{Mode: "ANY"}
+		case "none":
+			cfg = &model.GeminiFunctionCallingConfig{Mode: "NONE"}
+		}
+	case map[string]interface{}:
+		if fn, ok := tc["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok {
+				cfg = &model.GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{name}}
+			}
+		}
+	}
+	if cfg == nil {
+		return nil
+	}
+	return &model.GeminiToolConfig{FunctionCallingConfig: cfg}
+}
+
+// cleanGeminiSchema 移除 Gemini 函数参数不支持的 JSON Schema 字段
+func cleanGeminiSchema(schema interface{}) interface{} {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			switch k {
+			case "$schema", "additionalProperties", "strict":
+				continue
+			}
+			result[k] = cleanGeminiSchema(v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(s))
+		for i, v := range s {
+			result[i] = cleanGeminiSchema(v)
+		}
+		return result
+	}
+	return schema
+}
+
+// toolResultToGemini 转换工具调用结果（Gemini 要求为 JSON 对象，非对象内容包装到 content 字段）
+func toolResultToGemini(content string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &obj); err == nil && obj != nil {
+		return obj
+	}
+	return map[string]interface{}{"content": content}
+}
+
+// chatContentToGemini 将 chat 消息内容转换为 Gemini 内容部分
+func chatContentToGemini(content interface{}) []model.GeminiPart {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []model.GeminiPart{{Text: c}}
+	case []interface{}:
+		var parts []model.GeminiPart
+		for _, item := range c {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				if text, _ := m["text"].(string); text != "" {
+					parts = append(parts, model.GeminiPart{Text: text})
+				}
+			case "image_url":
+				imageURL, _ := m["image_url"].(map[string]interface{})
+				url, _ := imageURL["url"].(string)
+				if part := imageURLToGemini(url); part != nil {
+					parts = append(parts, *part)
+				}
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// imageURLToGemini 将图片 URL（支持 data URL）转换为 Gemini 内容部分
+func imageURLToGemini(url string) *model.GeminiPart {
+	if url == "" {
+		return nil
+	}
+	// data:image/png;base64,xxxx
+	if strings.HasPrefix(url, "data:") {
+		meta, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !found {
+			return nil
+		}
+		return &model.GeminiPart{InlineData: &model.GeminiBlob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}}
+	}
+	mimeType := mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return &model.GeminiPart{FileData: &model.GeminiFileData{MimeType: mimeType, FileURI: url}}
+}
+
+// GeminiResponseToChat 将 Gemini generateContent 响应转换为 OpenAI chat 响应
+func GeminiResponseToChat(resp *model.GeminiResponse, modelName string) *model.ChatCompletionResponse {
+	result := &model.ChatCompletionResponse{
+		ID:      geminiResponseID(resp),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelName,
+		Choices: []model.Choice{},
+		Usage:   geminiUsageToChat(resp.UsageMetadata),
+	}
+
+	// 提示词被拦截时没有候选结果
+	if len(resp.Candidates) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		finishReason := "content_filter"
+		result.Choices = append(result.Choices, model.Choice{
+			Index:        0,
+			Message:      &model.ChatMessage{Role: "assistant", Content: ""},
+			FinishReason: &finishReason,
+		})
+		return result
+	}
+
+	for _, candidate := range resp.Candidates {
+		message := &model.ChatMessage{Role: "assistant"}
+		var text strings.Builder
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				switch {
+				case part.FunctionCall != nil:
+					message.ToolCalls = append(message.ToolCalls, geminiFunctionCallToChat(part.FunctionCall, nil))
+				case part.Thought:
+					// 思考内容不输出
+				default:
+					text.WriteString(part.Text)
+				}
+			}
+		}
+		message.Content = text.String()
+
+		finishReason := geminiFinishReasonToChat(candidate.FinishReason, len(message.ToolCalls) > 0)
+		result.Choices = append(result.Choices, model.Choice{Index: candidate.Index, Message: message, FinishReason: &finishReason})
+	}
+	return result
+}
+
+// geminiResponseID 获取响应ID（Gemini 未返回时生成）
+func geminiResponseID(resp *model.GeminiResponse) string {
+	if resp.ResponseID != "" {
+		return "chatcmpl-" + resp.ResponseID
+	}
+	return randomID("chatcmpl-")
+}
+
+// geminiFunctionCallToChat 转换函数调用（Gemini 未返回调用ID时生成）
+func geminiFunctionCallToChat(fc *model.GeminiFunctionCall, index *int) model.ToolCall {
+	id := fc.ID
+	if id == "" {
+		id = randomID("call_")
+	}
+	args := "{}"
+	if fc.Args != nil {
+		args = string(mustMarshal(fc.Args))
+	}
+	return model.ToolCall{
+		Index:    index,
+		ID:       id,
+		Type:     "function",
+		Function: model.FunctionCall{Name: fc.Name, Arguments: args},
+	}
+}
+
+// geminiFinishReasonToChat 转换结束原因（安全拦截类原因统一映射为 content_filter）
+func geminiFinishReasonToChat(finishReason string, hasToolCalls bool) string {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY", "LANGUAGE":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiUsageToChat 转换使用量统计
+func geminiUsageToChat(usage *model.GeminiUsageMetadata) *model.Usage {
+	if usage == nil {
+		return nil
+	}
+	// candidatesTokenCount 不含思考 token，OpenAI 的 completion_tokens 包含推理 token
+	completionTokens := usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	result := &model.Usage{
+		PromptTokens:     usage.PromptTokenCount,
+		CompletionTokens: completionTokens,
+		TotalTokens:      usage.TotalTokenCount,
+	}
+	if result.TotalTokens == 0 {
+		result.TotalTokens = usage.PromptTokenCount + completionTokens
+	}
+	if usage.CachedContentTokenCount > 0 {
+		result.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: usage.CachedContentTokenCount}
+	}
+	if usage.ThoughtsTokenCount > 0 {
+		result.CompletionTokensDetails = &model.CompletionTokensDetails{ReasoningTokens: usage.ThoughtsTokenCount}
+	}
+	return result
+}
+
+// geminiErrorToOpenAI 将 Gemini 错误响应体转换为 OpenAI 错误格式
+func geminiErrorToOpenAI(body []byte) []byte {
+	// 部分接口以数组形式返回错误
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var errs []model.GeminiError
+		if err := json.Unmarshal(body, &errs); err == nil && len(errs) > 0 {
+			body = mustMarshal(errs[0])
+		}
+	}
+
+	var geminiErr model.GeminiError
+	if err := json.Unmarshal(body, &geminiErr); err != nil || geminiErr.Error.Message == "" {
+		return body
+	}
+	code := geminiErr.Error.Status
+	return mustMarshal(model.NewOpenAIError(geminiErr.Error.Message, geminiErr.Error.Status, &code))
+}
+
+// convertGeminiStreamToChat 将 Gemini 流式数据块转换为 OpenAI chat 流式数据块
+func convertGeminiStreamToChat(reader *bufio.Reader, w io.Writer, modelName string, includeUsage bool) error {
+	var (
+		id        string
+		created   = time.Now().Unix()
+		usage     *model.GeminiUsageMetadata
+		started   = make(map[int]bool) // 候选序号 -> 是否已输出 role
+		toolCount = make(map[int]int)  // 候选序号 -> 已输出的工具调用数
+		finished  bool
+	)
+
+	writeChunk := func(choices []model.Choice, u *model.Usage) error {
+		if choices == nil {
+			choices = []model.Choice{}
+		}
+		data, err := json.Marshal(model.ChatCompletionChunk{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: modelName, Choices: choices, Usage: u,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+	writeDelta := func(index int, delta *model.ChatMessage, finishReason *string) error {
+		return writeChunk([]model.Choice{{Index: index, Delta: delta, FinishReason: finishReason}}, nil)
+	}
+
+	for {
+		ev, err := readSSEEvent(reader)
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			// Gemini 流没有结束标记，以收到 finishReason 作为完整结束的依据
+			if !finished {
+				return io.ErrUnexpectedEOF
+			}
+			if includeUsage && usage != nil {
+				if err := writeChunk(nil, geminiUsageToChat(usage)); err != nil {
+					return err
+				}
+			}
+			_, err := io.WriteString(w, "data: [DONE]\n\n")
+			return err
+		}
+		if len(ev.Data) == 0 {
+			continue
+		}
+
+		// 流内错误：转换为 OpenAI 错误格式，便于上层检测
+		if strings.Contains(string(ev.Data), `"error"`) {
+			var geminiErr model.GeminiError
+			if err := json.Unmarshal(ev.Data, &geminiErr); err == nil && geminiErr.Error.Message != "" {
+				_, err := fmt.Fprintf(w, "data: %s\n\n", geminiErrorToOpenAI(ev.Data))
+				return err
+			}
+		}
+
+		var chunk model.GeminiResponse
+		if err := json.Unmarshal(ev.Data, &chunk); err != nil {
+			continue
+		}
+		if id == "" {
+			id = geminiResponseID(&chunk)
+		}
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+
+		// 提示词被拦截
+		if len(chunk.Candidates) == 0 && chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			finishReason := "content_filter"
+			if err := writeDelta(0, &model.ChatMessage{Role: "assistant", Content: ""}, &finishReason); err != nil {
+				return err
+			}
+			finished = true
+			continue
+		}
+
+		for _, candidate := range chunk.Candidates {
+			idx := candidate.Index
+			if !started[idx] {
+				started[idx] = true
+				if err := writeDelta(idx, &model.ChatMessage{Role: "assistant", Content: ""}, nil); err != nil {
+					return err
+				}
+			}
+			if candidate.Content != nil {
+				for _, part := range candidate.Content.Parts {
+					switch {
+					case part.FunctionCall != nil:
+						// Gemini 一次性返回完整的函数调用
+						tc := geminiFunctionCallToChat(part.FunctionCall, intPtr(toolCount[idx]))
+						toolCount[idx]++
+						if err := writeDelta(idx, &model.ChatMessage{ToolCalls: []model.ToolCall{tc}}, nil); err != nil {
+							return err
+						}
+					case part.Thought || part.Text == "":
+						continue
+					default:
+						if err := writeDelta(idx, &model.ChatMessage{Content: part.Text}, nil); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			if candidate.FinishReason != "" {
+				finishReason := geminiFinishReasonToChat(candidate.FinishReason, toolCount[idx] > 0)
+				if err := writeDelta(idx, &model.ChatMessage{}, &finishReason); err != nil {
+					return err
+				}
+				finished = true
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package upstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"gin_base/app/model"
+	"io"
+	"testing"
+)
+
+func TestChatToGeminiRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "system instruction, generation config and images",
+			req: `{"model":"gemini","temperature":0.2,"max_tokens":50,"n":2,"stop":"END",
+				"response_format":{"type":"json_schema","json_schema":{"name":"r","schema":{"type":"object"}}},
+				"messages":[
+					{"role":"system","content":"Be brief"},
+					{"role":"user","content":[
+						{"type":"text","text":"What is this?"},
+						{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},
+						{"type":"image_url","image_url":{"url":"https://example.com/cat.png?size=1"}}]},
+					{"role":"user","content":"Thanks"}]}`,
+			want: `{"contents":[{"role":"user","parts":[
+					{"text":"What is this?"},
+					{"inlineData":{"mimeType":"image/png","data":"AAAA"}},
+					{"fileData":{"mimeType":"image/png","fileUri":"https://example.com/cat.png?size=1"}},
+					{"text":"Thanks"}]}],
+				"systemInstruction":{"parts":[{"text":"Be brief"}]},
+				"generationConfig":{"temperature":0.2,"candidateCount":2,"maxOutputTokens":50,"stopSequences":["END"],
+					"responseMimeType":"application/json","responseJsonSchema":{"type":"object"}}}`,
+		},
+		{
+			name: "tool calls and function responses",
+			req: `{"model":"gemini","messages":[
+					{"role":"user","content":"weather?"},
+					{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+					{"role":"tool","tool_call_id":"call_1","content":"{\"temp\":20}"},
+					{"role":"tool","tool_call_id":"call_1","content":"plain"}],
+				"tools":[{"type":"function","function":{"name":"get_weather","parameters":{
+					"$schema":"http://json-schema.org/draft-07/schema#","type":"object","additionalProperties":false,
+					"properties":{"city":{"type":"string","strict":true}}}}}],
+				"tool_choice":{"type":"function","function":{"name":"get_weather"}}}`,
+			want: `{"contents":[
+					{"role":"user","parts":[{"text":"weather?"}]},
+					{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},
+					{"role":"user","parts":[
+						{"functionResponse":{"name":"get_weather","response":{"temp":20}}},
+						{"functionResponse":{"name":"get_weather","response":{"content":"plain"}}}]}],
+				"tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}},
+				"generationConfig":{}}`,
+		},
+		{
+			name: "json object and required tools",
+			req: `{"model":"gemini","max_completion_tokens":30,"max_tokens":10,"stop":["a","b"],"response_format":{"type":"json_object"},
+				"messages":[{"role":"user","content":"hi"}],
+				"tools":[{"type":"function","function":{"name":"f","description":"d"}}],"tool_choice":"required"}`,
+			want: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],
+				"tools":[{"functionDeclarations":[{"name":"f","description":"d"}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY"}},
+				"generationConfig":{"maxOutputTokens":30,"stopSequences":["a","b"],"responseMimeType":"application/json"}}`,
+		},
+		{
+			name:    "only system messages",
+			req:     `{"model":"gemini","messages":[{"role":"system","content":"A"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		var req model.ChatCompletionRequest
+		if err := json.Unmarshal([]byte(tt.req), &req); err != nil {
+			t.Fatalf("%s: invalid request: %v", tt.name, err)
+		}
+		got, err := ChatToGeminiRequest(&req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			assertJSON(t, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChatToolChoiceToGemini(t *testing.T) {
+	tests := []struct {
+		name       string
+		toolChoice interface{}
+		want       string
+	}{
+		{"auto", "auto", `{"functionCallingConfig":{"mode":"AUTO"}}`},
+		{"required", "required", `{"functionCallingConfig":{"mode":"ANY"}}`},
+		{"none", "none", `{"functionCallingConfig":{"mode":"NONE"}}`},
+		{"named", map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "f"}}, `{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["f"]}}`},
+		{"unset", nil, `null`},
+	}
+	for _, tt := range tests {
+		assertJSON(t, tt.name, chatToolChoiceToGemini(tt.toolChoice), tt.want)
+	}
+}
+
+func TestGeminiResponseToChat(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{
+			name: "text, thoughts and function call",
+			resp: `{"responseId":"r1","candidates":[{"index":0,"finishReason":"STOP","content":{"role":"model","parts":[
+					{"text":"thinking","thought":true},
+					{"text":"Sure. "},
+					{"functionCall":{"id":"fc_1","name":"f","args":{"a":1}}}]}}],
+				"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3,"cachedContentTokenCount":4,"totalTokenCount":18}}`,
+			want: `{"id":"chatcmpl-r1","object":"chat.completion","model":"gemini","choices":[{"index":0,
+					"message":{"role":"assistant","content":"Sure. ","tool_calls":[{"id":"fc_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},
+					"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":8,"total_tokens":18,"prompt_tokens_details":{"cached_tokens":4},"completion_tokens_details":{"reasoning_tokens":3}}}`,
+		},
+		{
+			name: "multiple candidates",
+			resp: `{"responseId":"r2","candidates":[
+					{"index":0,"finishReason":"MAX_TOKENS","content":{"parts":[{"text":"a"}]}},
+					{"index":1,"finishReason":"SAFETY"}],
+				"usageMetadata":{"promptTokenCount":2,"candidatesTokenCount":1}}`,
+			want: `{"id":"chatcmpl-r2","object":"chat.completion","model":"gemini","choices":[
+					{"index":0,"message":{"role":"assistant","content":"a"},"finish_reason":"length"},
+					{"index":1,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}],
+				"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`,
+		},
+		{
+			name: "blocked prompt",
+			resp: `{"responseId":"r3","promptFeedback":{"blockReason":"SAFETY"}}`,
+			want: `{"id":"chatcmpl-r3","object":"chat.completion","model":"gemini","choices":[
+					{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		var resp model.GeminiResponse
+		if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", tt.name, err)
+		}
+		assertJSON(t, tt.name, GeminiResponseToChat(&resp, "gemini"), tt.want)
+	}
+}
+
+func TestGeminiFinishReasonToChat(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		hasToolCalls bool
+		want         string
+	}{
+		{"STOP", false, "stop"},
+		{"STOP", true, "tool_calls"},
+		{"", false, "stop"},
+		{"MAX_TOKENS", true, "length"},
+		{"SAFETY", false, "content_filter"},
+		{"RECITATION", false, "content_filter"},
+		{"PROHIBITED_CONTENT", true, "content_filter"},
+		{"OTHER", false, "stop"},
+	}
+	for _, tt := range tests {
+		if got := geminiFinishReasonToChat(tt.finishReason, tt.hasToolCalls); got != tt.want {
+			t.Errorf("geminiFinishReasonToChat(%q, %v) = %q, want %q", tt.finishReason, tt.hasToolCalls, got, tt.want)
+		}
+	}
+}
+
+func TestGeminiErrorToOpenAI(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "error object",
+			body: `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`,
+			want: `{"error":{"message":"Quota exceeded","type":"RESOURCE_EXHAUSTED","param":null,"code":"RESOURCE_EXHAUSTED"}}`,
+		},
+		{
+			name: "error array",
+			body: `[{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}]`,
+			want: `{"error":{"message":"Invalid argument","type":"INVALID_ARGUMENT","param":null,"code":"INVALID_ARGUMENT"}}`,
+		},
+		{name: "not a gemini error", body: `{"message":"oops"}`, want: `{"message":"oops"}`},
+	}
+	for _, tt := range tests {
+		assertJSON(t, tt.name, json.RawMessage(geminiErrorToOpenAI([]byte(tt.body))), tt.want)
+	}
+}
+
+func TestConvertGeminiStreamToChat(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		includeUsage bool
+		want         string
+		wantErr      error
+	}{
+		{
+			name: "text and function call with usage",
+			input: sse(
+				`{"responseId":"r1","candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+				`{"responseId":"r1","candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"plan","thought":true},{"text":"lo"},{"functionCall":{"id":"fc_1","name":"f","args":{"a":1}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`,
+			),
+			includeUsage: true,
+			want: `[
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}},
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":null}]}},
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"content":null,"tool_calls":[{"index":0,"id":"fc_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":null}]}},
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"content":null},"finish_reason":"tool_calls"}]}},
+				{"data":{"id":"chatcmpl-r1","object":"chat.completion.chunk","model":"gemini","choices":[],"usage":{"prompt_tokens":4,"completion_tokens":2,"total_tokens":6}}},
+				{"data":"[DONE]"}]`,
+		},
+		{
+			name:  "blocked prompt",
+			input: sse(`{"responseId":"r2","promptFeedback":{"blockReason":"SAFETY"}}`),
+			want: `[
+				{"data":{"id":"chatcmpl-r2","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}},
+				{"data":"[DONE]"}]`,
+		},
+		{
+			name:  "error event",
+			input: sse(`{"error":{"code":503,"message":"The model is overloaded","status":"UNAVAILABLE"}}`),
+			want:  `[{"data":{"error":{"message":"The model is overloaded","type":"UNAVAILABLE","param":null,"code":"UNAVAILABLE"}}}]`,
+		},
+		{
+			name:  "truncated without finish reason",
+			input: sse(`{"responseId":"r3","candidates":[{"index":0,"content":{"parts":[{"text":"Hi"}]}}]}`),
+			want: `[
+				{"data":{"id":"chatcmpl-r3","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}},
+				{"data":{"id":"chatcmpl-r3","object":"chat.completion.chunk","model":"gemini","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}]}}]`,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		events, err := convertStream(t, tt.input, func(reader *bufio.Reader, w io.Writer) error {
+			return convertGeminiStreamToChat(reader, w, "gemini", tt.includeUsage)
+		})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		assertJSON(t, tt.name, events, tt.want)
+	}
+}
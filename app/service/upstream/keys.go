@@ -0,0 +1,231 @@
+package upstream
+
+import (
+	"bytes"
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/service/tracing"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// API Key 选择策略
+const (
+	KeyStrategyRoundRobin = "round_robin" // 轮询（默认）
+	KeyStrategyLeastUsed  = "least_used"  // 请求数最少
+	KeyStrategyRandom     = "random"      // 随机
+)
+
+// keyDisableDuration Key 失效后的禁用时长，到期后重新参与选择（一次失败即再次禁用）
+const keyDisableDuration = 10 * time.Minute
+
+// keyErrorMarkers 响应体中表示 Key 本身失效（而非请求问题）的标记
+var keyErrorMarkers = []string{
+	"insufficient_quota",
+	"invalid_api_key",
+	"billing_hard_limit_reached",
+	"api_key_invalid",
+	"credit balance is too low",
+}
+
+// apiKey 上游 API Key 及其统计
+type apiKey struct {
+	value         string
+	totalReqs     atomic.Int64
+	successReqs   atomic.Int64
+	failures      atomic.Int64 // Key 失效类错误次数
+	disabledUntil atomic.Int64 // 禁用截止时间戳(纳秒)
+	lastError     atomic.Value // 最近一次失效原因(string)
+}
+
+// APIKeyStats API Key 统计信息
+type APIKeyStats struct {
+	Key           string  `json:"key"` // 脱敏后的 Key
+	Enabled       bool    `json:"enabled"`
+	DisabledUntil int64   `json:"disabled_until,omitempty"` // 禁用截止时间戳(秒)
+	LastError     string  `json:"last_error,omitempty"`
+	TotalReqs     int64   `json:"total_requests"`
+	SuccessReqs   int64   `json:"success_requests"`
+	Failures      int64   `json:"failures"`
+	SuccessRate   float64 `json:"success_rate"`
+}
+
+// buildAPIKeys 合并 api_key 与 api_keys（去重、去空）
+func buildAPIKeys(cfg ProviderConfig) []*apiKey {
+	var keys []*apiKey
+	seen := make(map[string]struct{})
+	for _, value := range append([]string{cfg.APIKey}, cfg.APIKeys...) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if _, exists := seen[value]; exists {
+			continue
+		}
+		seen[value] = struct{}{}
+		keys = append(keys, &apiKey{value: value})
+	}
+	return keys
+}
+
+// maskKey Key 脱敏显示
+func maskKey(key string) string {
+	if len(key) <= 10 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
+
+// enabled Key 是否可用
+func (k *apiKey) enabled(now time.Time) bool {
+	return k.disabledUntil.Load() <= now.UnixNano()
+}
+
+// selectKey 按供应商的 Key 选择策略选择一个可用的 Key，全部禁用时返回 nil
+func (p *Provider) selectKey() *apiKey {
+	if len(p.keys) == 1 {
+		return p.keys[0]
+	}
+
+	now := time.Now()
+	var usable []*apiKey
+	for _, k := range p.keys {
+		if k.enabled(now) {
+			usable = append(usable, k)
+		}
+	}
+	if len(usable) == 0 {
+		return nil
+	}
+
+	switch p.Config.KeyStrategy {
+	case KeyStrategyRandom:
+		return usable[rand.Intn(len(usable))]
+	case KeyStrategyLeastUsed:
+		best := usable[0]
+		for _, k := range usable[1:] {
+			if k.totalReqs.Load() < best.totalReqs.Load() {
+				best = k
+			}
+		}
+		return best
+	}
+	counter := p.keyCounter.Add(1)
+	return usable[(counter-1)%uint64(len(usable))]
+}
+
+// keyErrorReason 判断响应是否表示 Key 本身失效（吊销、无权限、额度耗尽），返回原因，否则返回空
+func keyErrorReason(statusCode int, body []byte) string {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("status %d", statusCode)
+	case http.StatusBadRequest, http.StatusPaymentRequired, http.StatusTooManyRequests:
+		lower := strings.ToLower(string(body))
+		for _, marker := range keyErrorMarkers {
+			if strings.Contains(lower, marker) {
+				return fmt.Sprintf("status %d: %s", statusCode, marker)
+			}
+		}
+	}
+	return ""
+}
+
+// do 使用选中的 API Key 发送请求
+// 配置了多个 Key 时，Key 失效（401/403、额度耗尽等）会禁用该 Key 并换下一个 Key 重试，不影响模型健康状态；
+// 所有 Key 均不可用时返回错误，由调用方按网络错误处理
+func (p *Provider) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	for tried := 0; ; tried++ {
+		key := p.selectKey()
+		if key == nil {
+			return nil, fmt.Errorf("provider %s has no usable api key", p.Config.Name)
+		}
+
+		attemptReq := req
+		if tried > 0 {
+			attemptReq = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+		p.setAuthHeader(attemptReq, key.value)
+		tracing.Inject(attemptReq.Context(), attemptReq.Header)
+		key.totalReqs.Add(1)
+
+		resp, err := client.Do(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			key.successReqs.Add(1)
+			return resp, nil
+		}
+		// 单 Key 供应商不做 Key 管理，错误交由重试策略处理
+		if len(p.keys) == 1 || !keyErrorStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		reason := keyErrorReason(resp.StatusCode, body)
+		if reason == "" {
+			return resp, nil
+		}
+		key.failures.Add(1)
+		key.lastError.Store(reason)
+		key.disabledUntil.Store(time.Now().Add(keyDisableDuration).UnixNano())
+		log_helper.Warning(fmt.Sprintf("Provider %s api key %s disabled for %s: %s", p.Config.Name, maskKey(key.value), keyDisableDuration, reason))
+	}
+}
+
+// keyErrorStatus 可能表示 Key 失效的状态码（需结合响应体由 keyErrorReason 判断）
+func keyErrorStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden,
+		http.StatusBadRequest, http.StatusPaymentRequired, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// keyStats 获取供应商各 API Key 的统计信息
+func (p *Provider) keyStats() []APIKeyStats {
+	now := time.Now()
+	stats := make([]APIKeyStats, 0, len(p.keys))
+	for _, k := range p.keys {
+		total := k.totalReqs.Load()
+		success := k.successReqs.Load()
+		var rate float64
+		if total > 0 {
+			rate = float64(success) / float64(total) * 100
+		}
+		s := APIKeyStats{
+			Key:         maskKey(k.value),
+			Enabled:     k.enabled(now),
+			TotalReqs:   total,
+			SuccessReqs: success,
+			Failures:    k.failures.Load(),
+			SuccessRate: rate,
+		}
+		if !s.Enabled {
+			s.DisabledUntil = time.Unix(0, k.disabledUntil.Load()).Unix()
+		}
+		if lastErr, ok := k.lastError.Load().(string); ok {
+			s.LastError = lastErr
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
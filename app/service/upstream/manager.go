@@ -5,33 +5,72 @@ import (
 	"context"
 	"fmt"
 	"gin_base/app/helper/log_helper"
+	"gin_base/app/service/tracing"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// 模型类型
+const (
+	ModelTypeChat      = "chat"      // 对话模型（默认）
+	ModelTypeEmbedding = "embedding" // 向量模型
+)
+
 // ModelMapping 模型映射配置
 type ModelMapping struct {
-	Alias       string `json:"alias" yaml:"alias" mapstructure:"alias"`                                          // 对外暴露的别名（可选，不填则等于 upstream）
-	Upstream    string `json:"upstream" yaml:"upstream" mapstructure:"upstream"`                                 // 上游实际模型名（必填）
-	Priority    int    `json:"priority" yaml:"priority" mapstructure:"priority"`                                 // 优先级（数值越小优先级越高，默认0）
-	Weight      int    `json:"weight" yaml:"weight" mapstructure:"weight"`                                       // 负载均衡权重（默认1）
-	MaxFailures *int   `json:"max_failures,omitempty" yaml:"max_failures,omitempty" mapstructure:"max_failures"` // 该模型的连续失败阈值（可选，不填则使用全局配置）
+	Alias       string      `json:"alias" yaml:"alias" mapstructure:"alias"`                                          // 对外暴露的别名（可选，不填则等于 upstream）
+	Upstream    string      `json:"upstream" yaml:"upstream" mapstructure:"upstream"`                                 // 上游实际模型名（必填）
+	Priority    int         `json:"priority" yaml:"priority" mapstructure:"priority"`                                 // 优先级（数值越小优先级越高，默认0）
+	Weight      int         `json:"weight" yaml:"weight" mapstructure:"weight"`                                       // 负载均衡权重（默认1）
+	MaxFailures *int        `json:"max_failures,omitempty" yaml:"max_failures,omitempty" mapstructure:"max_failures"` // 该模型的连续失败阈值（可选，不填则使用全局配置）
+	Type        string      `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type"`                         // 模型类型：chat（默认）/ embedding
+	Price       *ModelPrice `json:"price,omitempty" yaml:"price,omitempty" mapstructure:"price"`                      // 价格（可选，用于费用统计和 lowest_cost 路由策略）
+}
+
+// IsEmbedding 是否为向量模型
+func (mm *ModelMapping) IsEmbedding() bool {
+	return mm.Type == ModelTypeEmbedding
 }
 
+// ServesPath 该映射的模型类型能否处理该接口的请求：向量模型只处理 /v1/embeddings，对话模型处理其余接口
+func (mm *ModelMapping) ServesPath(path string) bool {
+	return mm.IsEmbedding() == (path == EmbeddingsPath)
+}
+
+// 供应商类型
+const (
+	ProviderTypeOpenAI    = "openai"    // OpenAI 兼容接口（默认）
+	ProviderTypeAnthropic = "anthropic" // Anthropic Messages 接口
+	ProviderTypeGemini    = "gemini"    // Google Gemini generateContent 接口
+	ProviderTypeAzure     = "azure"     // Azure OpenAI（按部署名构建 URL）
+)
+
 // ProviderConfig 上游供应商配置
 type ProviderConfig struct {
-	Name          string         `json:"name" yaml:"name" mapstructure:"name"`                               // 供应商名称
-	BaseURL       string         `json:"base_url" yaml:"base_url" mapstructure:"base_url"`                   // 基础URL
-	APIKey        string         `json:"api_key" yaml:"api_key" mapstructure:"api_key"`                      // API Key
-	Weight        int            `json:"weight" yaml:"weight" mapstructure:"weight"`                         // 负载均衡权重（默认1）
-	Priority      int            `json:"priority" yaml:"priority" mapstructure:"priority"`                   // 优先级（数值越小优先级越高，默认0）
-	Timeout       int            `json:"timeout" yaml:"timeout" mapstructure:"timeout"`                      // 超时时间（秒）
-	ModelMappings []ModelMapping `json:"model_mappings" yaml:"model_mappings" mapstructure:"model_mappings"` // 模型映射
-	ExcludeParams []string       `json:"exclude_params" yaml:"exclude_params" mapstructure:"exclude_params"` // 要过滤的参数列表
+	Name          string         `json:"name" yaml:"name" mapstructure:"name"`                                             // 供应商名称
+	BaseURL       string         `json:"base_url" yaml:"base_url" mapstructure:"base_url"`                                 // 基础URL
+	APIKey        string         `json:"api_key" yaml:"api_key" mapstructure:"api_key"`                                    // API Key
+	APIKeys       []string       `json:"api_keys,omitempty" yaml:"api_keys,omitempty" mapstructure:"api_keys"`             // 多个 API Key（与 api_key 合并使用）
+	KeyStrategy   string         `json:"key_strategy,omitempty" yaml:"key_strategy,omitempty" mapstructure:"key_strategy"` // 多 Key 选择策略：round_robin（默认）/ least_used / random
+	Weight        int            `json:"weight" yaml:"weight" mapstructure:"weight"`                                       // 负载均衡权重（默认1）
+	Priority      int            `json:"priority" yaml:"priority" mapstructure:"priority"`                                 // 优先级（数值越小优先级越高，默认0）
+	Timeout       int            `json:"timeout" yaml:"timeout" mapstructure:"timeout"`                                    // 超时时间（秒）
+	ModelMappings []ModelMapping `json:"model_mappings" yaml:"model_mappings" mapstructure:"model_mappings"`               // 模型映射
+	ExcludeParams []string       `json:"exclude_params" yaml:"exclude_params" mapstructure:"exclude_params"`               // 要过滤的参数列表
+	// 上游仅支持 chat/completions 时开启，/v1/responses 请求将被转换为 chat 请求发送
+	ResponsesViaChat bool `json:"responses_via_chat,omitempty" yaml:"responses_via_chat,omitempty" mapstructure:"responses_via_chat"`
+	// 供应商类型：openai（默认，OpenAI 兼容接口）/ anthropic / gemini / azure
+	Type string `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type"`
+	// 接口版本（anthropic 对应 anthropic-version 请求头，gemini 对应 URL 版本前缀如 v1beta，azure 对应 api-version 查询参数，不填使用默认值）
+	APIVersion string `json:"api_version,omitempty" yaml:"api_version,omitempty" mapstructure:"api_version"`
+	// 供应商级重试策略（可选，逐项覆盖全局 retry_policy）
+	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty" yaml:"retry_policy,omitempty" mapstructure:"retry_policy"`
 }
 
 // ProviderModel 供应商+模型组合（用于路由）
@@ -40,20 +79,26 @@ type ProviderModel struct {
 	Mapping  ModelMapping
 }
 
-// ModelHealth 模型健康状态（按 upstream 存储）
+// ModelHealth 模型健康状态（按 upstream 存储，熔断器状态机）
 type ModelHealth struct {
-	Healthy       atomic.Bool  // 是否健康
-	FailureCount  atomic.Int32 // 连续失败次数
-	LastFailure   atomic.Int64 // 上次失败时间戳(秒)
-	LastCheckTime atomic.Int64 // 上次健康检查时间戳(纳秒)
-	maxFailures   int          // 该模型的连续失败阈值
-	recoverMutex  sync.Mutex   // 恢复检查互斥锁，防止并发重复检查
+	state             atomic.Int32 // 熔断器状态（closed/open/half_open）
+	FailureCount      atomic.Int32 // 连续失败次数
+	LastFailure       atomic.Int64 // 上次失败时间戳(秒)
+	OpenedAt          atomic.Int64 // 熔断器打开时间戳(纳秒)
+	CooldownUntil     atomic.Int64 // 限流冷却截止时间戳(纳秒)
+	LastCheckTime     atomic.Int64 // 上次健康检查时间戳(纳秒)
+	halfOpenSuccesses atomic.Int32 // 半开状态下的连续成功次数
+	halfOpenTrials    atomic.Int32 // 半开状态下进行中的试探请求数
+	maxFailures       int          // 该模型的连续失败阈值
+	recoverMutex      sync.Mutex   // 恢复检查互斥锁，防止并发重复检查
 }
 
 // ModelStats 模型统计数据（按 alias+upstream 组合存储）
 type ModelStats struct {
 	TotalReqs   atomic.Int64 // 总请求数
 	SuccessReqs atomic.Int64 // 成功请求数
+	InFlight    atomic.Int64 // 进行中的请求数
+	latency     latencyStats // 延迟统计
 }
 
 // Provider 上游供应商
@@ -67,6 +112,9 @@ type Provider struct {
 	modelIndex   map[string][]int        // alias -> ModelMappings 索引
 	modelHealths map[string]*ModelHealth // upstream -> ModelHealth (健康状态)
 	modelStats   map[string]*ModelStats  // "alias|upstream" -> ModelStats (统计数据)
+	modelSeries  map[string]*timeSeries  // upstream -> 按分钟滚动的时序指标
+	keys         []*apiKey               // API Key 列表（api_key + api_keys）
+	keyCounter   atomic.Uint64           // Key 轮询计数器
 }
 
 // ProviderModelHealth 供应商模型健康信息
@@ -75,12 +123,19 @@ type ProviderModelHealth struct {
 	ModelAlias    string  `json:"model_alias"`    // 模型别名
 	UpstreamModel string  `json:"upstream_model"` // 上游模型名
 	Healthy       bool    `json:"healthy"`
+	State         string  `json:"state"`                    // 熔断器状态：closed / open / half_open
+	CooldownUntil int64   `json:"cooldown_until,omitempty"` // 限流冷却截止时间戳(秒)，0 表示未冷却
 	FailureCount  int32   `json:"failure_count"`
 	TotalReqs     int64   `json:"total_requests"`   // 总请求数
 	SuccessReqs   int64   `json:"success_requests"` // 成功请求数
 	SuccessRate   float64 `json:"success_rate"`     // 成功率(%)
 	Priority      int     `json:"priority"`         // 优先级
 	Weight        int     `json:"weight"`           // 权重
+	InFlight      int64   `json:"in_flight"`        // 进行中的请求数
+	LatencyMs     float64 `json:"latency_ms"`       // 延迟 EWMA（毫秒）
+	P50LatencyMs  float64 `json:"p50_latency_ms"`   // 最近请求的 P50 延迟（毫秒）
+	TTFTMs        float64 `json:"ttft_ms"`          // 首 token 时间 EWMA（毫秒）
+	Strategy      string  `json:"strategy"`         // 该别名使用的路由策略
 }
 
 // ProviderStats 供应商统计信息
@@ -92,28 +147,51 @@ type ProviderStats struct {
 	SuccessReqs  int64                 `json:"success_requests"`
 	SuccessRate  float64               `json:"success_rate"`
 	ModelHealths []ProviderModelHealth `json:"model_healths"`
+	Keys         []APIKeyStats         `json:"keys"` // 各 API Key 统计
 }
 
 // Manager 供应商管理器
 type Manager struct {
-	providers         []*Provider
-	mu                sync.RWMutex
-	roundRobinCounter atomic.Uint64
+	providers  []*Provider
+	mu         sync.RWMutex
+	rrCounters sync.Map // alias -> *atomic.Uint64（按别名独立的轮询计数器）
 
 	// 配置
-	maxFailures       int           // 最大连续失败次数，超过后标记为不健康
-	recoveryInterval  time.Duration // 恢复检查间隔
-	healthCheckPeriod time.Duration // 健康检查周期
+	maxFailures       int               // 最大连续失败次数，超过后标记为不健康
+	recoveryInterval  time.Duration     // 恢复检查间隔（熔断器模式下为打开后的冷却时间）
+	recoveryMode      string            // 恢复模式：breaker / probe
+	halfOpenRatio     float64           // 半开状态放行的流量比例
+	halfOpenSuccesses int               // 半开状态需连续成功的次数
+	retryPolicy       RetryPolicy       // 全局重试策略
+	healthCheckPeriod time.Duration     // 健康检查周期
+	defaultStrategy   string            // 默认路由策略
+	strategies        map[string]string // alias -> 路由策略
+
+	// 窗口错误率（errorRateThreshold > 0 时以窗口错误率代替连续失败次数判定是否熔断）
+	errorRateThreshold   float64       // 错误率阈值(%)
+	errorRateWindow      time.Duration // 统计窗口
+	errorRateMinRequests int           // 窗口内最少请求数，不足时不熔断
 
 	// 停止信号
 	stopChan chan struct{}
+	stopOnce sync.Once
 }
 
 // ManagerConfig 管理器配置
 type ManagerConfig struct {
-	MaxFailures       int           // 最大连续失败次数
-	RecoveryInterval  time.Duration // 恢复间隔
-	HealthCheckPeriod time.Duration // 健康检查周期
+	MaxFailures       int               // 最大连续失败次数
+	RecoveryInterval  time.Duration     // 恢复间隔
+	HealthCheckPeriod time.Duration     // 健康检查周期
+	RecoveryMode      string            // 恢复模式（不填为 breaker）
+	HalfOpenRatio     float64           // 半开状态放行的流量比例（默认0.1）
+	HalfOpenSuccesses int               // 半开状态需连续成功的次数（默认3）
+	RetryPolicy       *RetryPolicy      // 全局重试策略（不填使用 DefaultRetryPolicy，未填的项同样使用默认值）
+	DefaultStrategy   string            // 默认路由策略（不填为 weighted_rr）
+	Strategies        map[string]string // 按别名指定的路由策略
+
+	ErrorRateThreshold   float64       // 窗口错误率阈值(%)，大于 0 时以窗口错误率代替连续失败次数判定熔断
+	ErrorRateWindow      time.Duration // 窗口错误率的统计窗口（默认5分钟）
+	ErrorRateMinRequests int           // 窗口内最少请求数，不足时不熔断（默认10）
 }
 
 // NewManager 创建供应商管理器
@@ -122,14 +200,58 @@ func NewManager(configs []ProviderConfig, mgrConfig ManagerConfig) *Manager {
 		providers:         make([]*Provider, 0, len(configs)),
 		maxFailures:       mgrConfig.MaxFailures,
 		recoveryInterval:  mgrConfig.RecoveryInterval,
+		recoveryMode:      mgrConfig.RecoveryMode,
+		halfOpenRatio:     mgrConfig.HalfOpenRatio,
+		halfOpenSuccesses: mgrConfig.HalfOpenSuccesses,
 		healthCheckPeriod: mgrConfig.HealthCheckPeriod,
+		defaultStrategy:   normalizeStrategy(mgrConfig.DefaultStrategy, "default"),
+		strategies:        make(map[string]string, len(mgrConfig.Strategies)),
 		stopChan:          make(chan struct{}),
+
+		errorRateThreshold:   mgrConfig.ErrorRateThreshold,
+		errorRateWindow:      mgrConfig.ErrorRateWindow,
+		errorRateMinRequests: mgrConfig.ErrorRateMinRequests,
+	}
+	for alias, strategy := range mgrConfig.Strategies {
+		m.strategies[alias] = normalizeStrategy(strategy, alias)
+	}
+	if m.recoveryMode != RecoveryModeProbe {
+		m.recoveryMode = RecoveryModeBreaker
+	}
+	if m.halfOpenRatio <= 0 || m.halfOpenRatio > 1 {
+		m.halfOpenRatio = defaultHalfOpenRatio
+	}
+	if m.halfOpenSuccesses <= 0 {
+		m.halfOpenSuccesses = defaultHalfOpenSuccesses
+	}
+	if m.errorRateWindow <= 0 {
+		m.errorRateWindow = defaultErrorRateWindow
+	}
+	if m.errorRateMinRequests <= 0 {
+		m.errorRateMinRequests = defaultErrorRateMinRequests
+	}
+	m.retryPolicy = DefaultRetryPolicy
+	if mgrConfig.RetryPolicy != nil {
+		if mgrConfig.RetryPolicy.RetryOn != nil {
+			m.retryPolicy.RetryOn = mgrConfig.RetryPolicy.RetryOn
+		}
+		if mgrConfig.RetryPolicy.CountAsFailure != nil {
+			m.retryPolicy.CountAsFailure = mgrConfig.RetryPolicy.CountAsFailure
+		}
 	}
 
 	for _, cfg := range configs {
 		if cfg.Timeout <= 0 {
 			cfg.Timeout = 60
 		}
+		if cfg.Type == "" {
+			cfg.Type = ProviderTypeOpenAI
+		}
+		switch cfg.KeyStrategy {
+		case KeyStrategyRoundRobin, KeyStrategyLeastUsed, KeyStrategyRandom:
+		default:
+			cfg.KeyStrategy = KeyStrategyRoundRobin
+		}
 		// 处理 Provider 级别的默认值
 		if cfg.Weight <= 0 {
 			cfg.Weight = 1
@@ -143,6 +265,9 @@ func NewManager(configs []ProviderConfig, mgrConfig ManagerConfig) *Manager {
 			if cfg.ModelMappings[i].Weight <= 0 {
 				cfg.ModelMappings[i].Weight = 1
 			}
+			if cfg.ModelMappings[i].Type == "" {
+				cfg.ModelMappings[i].Type = ModelTypeChat
+			}
 		}
 
 		// 创建优化的 Transport 配置
@@ -170,6 +295,12 @@ func NewManager(configs []ProviderConfig, mgrConfig ManagerConfig) *Manager {
 			modelIndex:   make(map[string][]int),
 			modelHealths: make(map[string]*ModelHealth),
 			modelStats:   make(map[string]*ModelStats),
+			modelSeries:  make(map[string]*timeSeries),
+			keys:         buildAPIKeys(cfg),
+		}
+		if len(p.keys) == 0 {
+			// 未配置 Key 时保持原行为（发送空 Key）
+			p.keys = []*apiKey{{}}
 		}
 
 		// 构建模型索引和初始化模型健康状态、统计数据
@@ -186,10 +317,10 @@ func NewManager(configs []ProviderConfig, mgrConfig ManagerConfig) *Manager {
 				health := &ModelHealth{
 					maxFailures: maxFailures,
 				}
-				health.Healthy.Store(true)
 				health.LastCheckTime.Store(0) // 初始化为0，确保第一次检查可以触发
 				// 确保每个ModelHealth都有独立的mutex
 				p.modelHealths[mm.Upstream] = health
+				p.modelSeries[mm.Upstream] = &timeSeries{}
 			}
 
 			// 初始化该 alias+upstream 组合的统计数据
@@ -224,26 +355,28 @@ func (p *Provider) GetModelMapping(alias string, mappingIdx int) *ModelMapping {
 	return nil
 }
 
-// GetProviderModels 获取所有支持指定别名的 ProviderModel 组合（按优先级和权重排序）
+// GetProviderModels 获取所有支持指定别名和接口的 ProviderModel 组合（按优先级和权重排序）
+// 只包含模型类型与接口匹配（见 ModelMapping.ServesPath）且供应商支持该接口的映射
 // 综合优先级 = Provider.Priority + Model.Priority
 // 综合权重 = Provider.Weight * Model.Weight
-func (m *Manager) GetProviderModels(alias string) []ProviderModel {
+func (m *Manager) GetProviderModels(alias, path string) []ProviderModel {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var candidates []ProviderModel
+	now := time.Now()
 
 	// 收集所有支持该别名的 ProviderModel（按模型健康状态过滤）
 	for _, p := range m.providers {
 		if indices, ok := p.modelIndex[alias]; ok {
 			for _, idx := range indices {
 				mm := p.Config.ModelMappings[idx]
-				// 检查该upstream是否健康（使用上游模型名作为key）
+				if !mm.ServesPath(path) || !p.SupportsEndpoint(path) {
+					continue
+				}
+				// 检查该upstream是否接收请求（使用上游模型名作为key，半开状态仅放行部分流量）
 				if health, exists := p.modelHealths[mm.Upstream]; exists {
-					p.mu.RLock()
-					healthy := health.Healthy.Load()
-					p.mu.RUnlock()
-					if !healthy {
+					if health.inCooldown(now) || !m.admit(p, mm.Upstream, health) {
 						continue // 跳过不健康的upstream
 					}
 					candidates = append(candidates, ProviderModel{
@@ -255,14 +388,21 @@ func (m *Manager) GetProviderModels(alias string) []ProviderModel {
 		}
 	}
 
-	// 如果没有健康的，使用所有的（作为最后手段）
+	// 如果没有健康的，使用所有的（作为最后手段，限流冷却中的除外）
 	if len(candidates) == 0 {
 		for _, p := range m.providers {
 			if indices, ok := p.modelIndex[alias]; ok {
 				for _, idx := range indices {
+					mm := p.Config.ModelMappings[idx]
+					if !mm.ServesPath(path) || !p.SupportsEndpoint(path) {
+						continue
+					}
+					if health, exists := p.modelHealths[mm.Upstream]; exists && health.inCooldown(now) {
+						continue
+					}
 					candidates = append(candidates, ProviderModel{
 						Provider: p,
-						Mapping:  p.Config.ModelMappings[idx],
+						Mapping:  mm,
 					})
 				}
 			}
@@ -317,6 +457,58 @@ func (m *Manager) GetProviderModels(alias string) []ProviderModel {
 	return result
 }
 
+// GetAllProviderModels 获取所有配置了指定别名的 ProviderModel（不按健康状态和限流冷却过滤，按综合优先级排序）
+func (m *Manager) GetAllProviderModels(alias string) []ProviderModel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []ProviderModel
+	for _, p := range m.providers {
+		for _, idx := range p.modelIndex[alias] {
+			result = append(result, ProviderModel{Provider: p, Mapping: p.Config.ModelMappings[idx]})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].GetCombinedPriority() < result[j].GetCombinedPriority()
+	})
+	return result
+}
+
+// FindProviderModel 按供应商名称和上游模型查找 ProviderModel（不经过路由和健康检查）
+// 优先使用该别名下上游模型一致的映射，其次任意上游模型一致的映射；upstreamModel 为空时使用该别名的首个映射
+// 供应商未配置该上游模型时按 upstreamModel 构造映射（无价格，不计费用）
+func (m *Manager) FindProviderModel(providerName, alias, upstreamModel string) (ProviderModel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var provider *Provider
+	for _, p := range m.providers {
+		if p.Config.Name == providerName {
+			provider = p
+			break
+		}
+	}
+	if provider == nil {
+		return ProviderModel{}, fmt.Errorf("provider %q not found", providerName)
+	}
+
+	for _, idx := range provider.modelIndex[alias] {
+		mm := provider.Config.ModelMappings[idx]
+		if upstreamModel == "" || mm.Upstream == upstreamModel {
+			return ProviderModel{Provider: provider, Mapping: mm}, nil
+		}
+	}
+	if upstreamModel == "" {
+		return ProviderModel{}, fmt.Errorf("provider %q has no mapping for model %q", providerName, alias)
+	}
+	for _, mm := range provider.Config.ModelMappings {
+		if mm.Upstream == upstreamModel {
+			return ProviderModel{Provider: provider, Mapping: mm}, nil
+		}
+	}
+	return ProviderModel{Provider: provider, Mapping: ModelMapping{Alias: alias, Upstream: upstreamModel}}, nil
+}
+
 // GetCombinedPriority 获取 ProviderModel 的综合优先级
 func (pm *ProviderModel) GetCombinedPriority() int {
 	return pm.Provider.Config.Priority + pm.Mapping.Priority
@@ -327,9 +519,9 @@ func (pm *ProviderModel) GetCombinedWeight() int {
 	return pm.Provider.Config.Weight * pm.Mapping.Weight
 }
 
-// SelectProviderModel 从同优先级组中按权重选择一个（用于负载均衡）
-func (m *Manager) SelectProviderModel(alias string) *ProviderModel {
-	candidates := m.GetProviderModels(alias)
+// SelectProviderModel 从 GetProviderModels 返回的候选中，按该别名的路由策略在最高优先级组内选择一个（用于负载均衡）
+// 候选由调用方传入，同一请求只做一次半开放行判定，选择与故障转移顺序使用同一份候选列表
+func (m *Manager) SelectProviderModel(alias string, candidates []ProviderModel) *ProviderModel {
 	if len(candidates) == 0 {
 		return nil
 	}
@@ -349,25 +541,7 @@ func (m *Manager) SelectProviderModel(alias string) *ProviderModel {
 		return &topPriority[0]
 	}
 
-	// 加权轮询（使用综合权重）
-	totalWeight := 0
-	for _, pm := range topPriority {
-		totalWeight += pm.GetCombinedWeight()
-	}
-
-	// Add(1) 返回加1后的值，所以用 counter-1 让轮询从索引0开始
-	counter := m.roundRobinCounter.Add(1)
-	targetWeight := int((counter - 1) % uint64(totalWeight))
-
-	currentWeight := 0
-	for i := range topPriority {
-		currentWeight += topPriority[i].GetCombinedWeight()
-		if targetWeight < currentWeight {
-			return &topPriority[i]
-		}
-	}
-
-	return &topPriority[0]
+	return m.selectByStrategy(alias, topPriority)
 }
 
 // supportsModel 检查供应商是否支持模型
@@ -393,18 +567,19 @@ func (m *Manager) RecordSuccess(p *Provider, alias string, upstreamModel string)
 		stats.SuccessReqs.Add(1)
 	}
 
-	// 重置该upstream的失败计数（健康状态按 upstream 维度）
+	if series, exists := p.modelSeries[upstreamModel]; exists {
+		series.recordSuccess(time.Now())
+	}
+	promRequests.Inc(alias, p.Config.Name, upstreamModel, outcomeSuccess)
+
+	// 更新该upstream的熔断器状态（健康状态按 upstream 维度）
 	if health, exists := p.modelHealths[upstreamModel]; exists {
-		health.FailureCount.Store(0)
-		if !health.Healthy.Load() {
-			health.Healthy.Store(true)
-			log_helper.Info(fmt.Sprintf("Provider %s upstream model %s recovered and marked as healthy", p.Config.Name, upstreamModel))
-		}
+		m.recordBreakerSuccess(p, upstreamModel, health)
 	}
 }
 
-// RecordFailure 记录失败请求
-func (m *Manager) RecordFailure(p *Provider, alias string, upstreamModel string) {
+// RecordFailure 记录计入健康状态的失败请求
+func (m *Manager) RecordFailure(p *Provider, alias string, upstreamModel string, ec ErrorClass) {
 	p.totalReqs.Add(1)
 
 	// 记录 alias+upstream 组合的统计数据
@@ -413,15 +588,15 @@ func (m *Manager) RecordFailure(p *Provider, alias string, upstreamModel string)
 		stats.TotalReqs.Add(1)
 	}
 
+	if series, exists := p.modelSeries[upstreamModel]; exists {
+		series.recordError(time.Now(), ec.metricName(), true)
+	}
+	promRequests.Inc(alias, p.Config.Name, upstreamModel, outcomeFailure)
+	promErrors.Inc(alias, p.Config.Name, upstreamModel, ec.metricName())
+
 	// 记录该upstream的失败（健康状态按 upstream 维度）
 	if health, exists := p.modelHealths[upstreamModel]; exists {
-		failures := health.FailureCount.Add(1)
-		health.LastFailure.Store(time.Now().Unix())
-
-		if int(failures) >= health.maxFailures && health.Healthy.Load() {
-			health.Healthy.Store(false)
-			log_helper.Warning(fmt.Sprintf("Provider %s upstream model %s marked as unhealthy after %d consecutive failures", p.Config.Name, upstreamModel, failures))
-		}
+		m.recordBreakerFailure(p, upstreamModel, health)
 	}
 }
 
@@ -452,8 +627,12 @@ func (m *Manager) startHealthCheck() {
 	}
 }
 
-// checkAndRecover 检查并恢复不健康的upstream模型
+// checkAndRecover 检查并恢复不健康的upstream模型（仅探测模式，熔断器模式由真实流量恢复）
 func (m *Manager) checkAndRecover() {
+	if m.recoveryMode != RecoveryModeProbe {
+		return
+	}
+
 	m.mu.RLock()
 	providers := m.providers
 	m.mu.RUnlock()
@@ -463,7 +642,7 @@ func (m *Manager) checkAndRecover() {
 	for _, p := range providers {
 		p.mu.RLock()
 		for upstream, health := range p.modelHealths {
-			if !health.Healthy.Load() {
+			if !health.isHealthy() {
 				unhealthyModels = append(unhealthyModels, fmt.Sprintf("%s/%s", p.Config.Name, upstream))
 			}
 		}
@@ -485,7 +664,7 @@ func (m *Manager) checkAndRecover() {
 		p.mu.RUnlock()
 
 		for upstream, health := range healths {
-			if !health.Healthy.Load() {
+			if !health.isHealthy() {
 				// 获取互斥锁，确保同一时间只有一个检查在执行
 				health.recoverMutex.Lock()
 				// 在锁内重新获取当前时间，确保时间检查的准确性
@@ -503,20 +682,45 @@ func (m *Manager) checkAndRecover() {
 	}
 }
 
+// getMappingByUpstream 根据上游模型名获取模型映射（同一 upstream 的多个映射取第一个）
+func (p *Provider) getMappingByUpstream(upstreamModel string) *ModelMapping {
+	for i := range p.Config.ModelMappings {
+		if p.Config.ModelMappings[i].Upstream == upstreamModel {
+			return &p.Config.ModelMappings[i]
+		}
+	}
+	return nil
+}
+
 // tryRecoverModel 尝试恢复upstream模型
 func (m *Manager) tryRecoverModel(p *Provider, upstreamModel string) {
-	// 第一步：先检查 /v1/models 接口
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	spanCtx, span := tracing.Start(context.Background(), "recovery probe", tracing.KindInternal,
+		"provider", p.Config.Name,
+		"model.upstream", upstreamModel,
+	)
+	outcome := "failed"
+	defer func() {
+		promProbes.Inc(p.Config.Name, upstreamModel, outcome)
+		span.SetAttributes("probe.outcome", outcome)
+		if outcome == "recovered" {
+			span.SetOK()
+		} else {
+			span.SetError(fmt.Errorf("model still unhealthy"))
+		}
+		span.End()
+	}()
+
+	// 第一步：先检查模型列表接口
+	ctx, cancel := context.WithTimeout(spanCtx, 10*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", p.Config.BaseURL+"/v1/models", nil)
+	req, err := p.newUpstreamRequest(ctx, "GET", p.modelsPath(), nil)
 	if err != nil {
 		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: create request failed: %v", p.Config.Name, upstreamModel, err))
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
 
-	resp, err := p.httpClient.Do(req)
+	resp, err := p.do(p.httpClient, req)
 	if err != nil {
 		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: models API failed: %v", p.Config.Name, upstreamModel, err))
 		return
@@ -528,52 +732,62 @@ func (m *Manager) tryRecoverModel(p *Provider, upstreamModel string) {
 		return
 	}
 
-	// 第二步：使用简单的 chat/completions 调用来验证模型可用性
-	testCtx, testCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// 第二步：根据模型类型发起一次最小调用来验证模型可用性
+	// 向量模型使用 embeddings 接口，对话模型使用 chat/completions 接口
+	testCtx, testCancel := context.WithTimeout(spanCtx, 30*time.Second)
 	defer testCancel()
 
+	probePath := ChatCompletionsPath
+	probeName := "completions"
 	testReqBody := []byte(fmt.Sprintf(`{"model":"%s","messages":[{"role":"user","content":"hi"}],"max_tokens":1,"stream":false}`, upstreamModel))
-	testReq, err := http.NewRequestWithContext(testCtx, "POST", p.Config.BaseURL+"/v1/chat/completions", bytes.NewReader(testReqBody))
-	if err != nil {
-		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: create completions request failed: %v", p.Config.Name, upstreamModel, err))
-		return
+	if mm := p.getMappingByUpstream(upstreamModel); mm != nil && mm.IsEmbedding() {
+		probePath = EmbeddingsPath
+		probeName = "embeddings"
+		testReqBody = []byte(fmt.Sprintf(`{"model":"%s","input":"hi"}`, upstreamModel))
 	}
 
-	testReq.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
-	testReq.Header.Set("Content-Type", "application/json")
-
-	testResp, err := p.httpClient.Do(testReq)
+	// 通过 ProxyRequest 发送，非 OpenAI 兼容上游会自动转换为原生接口
+	testResp, err := p.ProxyRequest(testCtx, "POST", probePath, testReqBody, nil)
 	if err != nil {
-		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: completions API failed: %v", p.Config.Name, upstreamModel, err))
+		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: %s API failed: %v", p.Config.Name, upstreamModel, probeName, err))
 		return
 	}
 	defer testResp.Body.Close()
 
-	// 检查completions响应：200表示成功，或者400表示模型可能不兼容但服务可用
+	// 检查探测响应：200表示成功，或者400表示模型可能不兼容但服务可用
 	if testResp.StatusCode == http.StatusOK || testResp.StatusCode == http.StatusBadRequest {
 		if health, exists := p.modelHealths[upstreamModel]; exists {
-			health.FailureCount.Store(0)
-			health.Healthy.Store(true)
+			health.closeCircuit()
 		}
+		outcome = "recovered"
 		log_helper.Info(fmt.Sprintf("Recovery check %s/%s: recovered (status %d)", p.Config.Name, upstreamModel, testResp.StatusCode))
 	} else {
-		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: completions returned %d, still unhealthy", p.Config.Name, upstreamModel, testResp.StatusCode))
+		log_helper.Warning(fmt.Sprintf("Recovery check %s/%s: %s returned %d, still unhealthy", p.Config.Name, upstreamModel, probeName, testResp.StatusCode))
 	}
 }
 
-// Stop 停止管理器
+// Stop 停止管理器（可重复调用）
 func (m *Manager) Stop() {
-	close(m.stopChan)
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
 }
 
-// GetRoundRobinCounter 获取当前轮询计数器值
-func (m *Manager) GetRoundRobinCounter() uint64 {
-	return m.roundRobinCounter.Load()
+// GetRoundRobinCounters 获取各别名当前的轮询计数器值
+func (m *Manager) GetRoundRobinCounters() map[string]uint64 {
+	counters := make(map[string]uint64)
+	m.rrCounters.Range(func(key, value interface{}) bool {
+		counters[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counters
 }
 
-// SetRoundRobinCounter 设置轮询计数器值（用于热重载时保留状态）
-func (m *Manager) SetRoundRobinCounter(value uint64) {
-	m.roundRobinCounter.Store(value)
+// SetRoundRobinCounters 设置各别名的轮询计数器值（用于热重载时保留状态）
+func (m *Manager) SetRoundRobinCounters(counters map[string]uint64) {
+	for alias, value := range counters {
+		m.roundRobinCounter(alias).Store(value)
+	}
 }
 
 // GetStats 获取所有供应商统计信息
@@ -598,8 +812,14 @@ func (m *Manager) GetStats() []ProviderStats {
 		for _, mm := range p.Config.ModelMappings {
 			// 获取健康状态（按 upstream 维度）
 			var healthy bool = true
+			state := breakerClosed
+			var cooldownUntil int64
 			if health, exists := p.modelHealths[mm.Upstream]; exists {
-				healthy = health.Healthy.Load()
+				state = health.state.Load()
+				if health.inCooldown(time.Now()) {
+					cooldownUntil = time.Unix(0, health.CooldownUntil.Load()).Unix()
+				}
+				healthy = state == breakerClosed
 				if !healthy {
 					allModelsHealthy = false
 				}
@@ -607,10 +827,13 @@ func (m *Manager) GetStats() []ProviderStats {
 
 			// 获取统计数据（按 alias+upstream 组合）
 			statsKey := mm.Alias + "|" + mm.Upstream
-			var modelTotal, modelSuccess int64 = 0, 0
+			var modelTotal, modelSuccess, inFlight int64 = 0, 0, 0
+			var latencyMs, p50Ms, ttftMs float64
 			if stats, exists := p.modelStats[statsKey]; exists {
 				modelTotal = stats.TotalReqs.Load()
 				modelSuccess = stats.SuccessReqs.Load()
+				inFlight = stats.InFlight.Load()
+				latencyMs, p50Ms, ttftMs, _ = stats.latency.snapshot()
 			}
 
 			var modelRate float64
@@ -626,12 +849,19 @@ func (m *Manager) GetStats() []ProviderStats {
 				ModelAlias:    mm.Alias,
 				UpstreamModel: mm.Upstream,
 				Healthy:       healthy,
+				State:         breakerStateName(state),
+				CooldownUntil: cooldownUntil,
 				FailureCount:  int32(modelFailure),
 				TotalReqs:     modelTotal,
 				SuccessReqs:   modelSuccess,
 				SuccessRate:   modelRate,
 				Priority:      mm.Priority,
 				Weight:        mm.Weight,
+				InFlight:      inFlight,
+				LatencyMs:     latencyMs,
+				P50LatencyMs:  p50Ms,
+				TTFTMs:        ttftMs,
+				Strategy:      m.strategyFor(mm.Alias),
 			})
 		}
 		p.mu.RUnlock()
@@ -647,6 +877,7 @@ func (m *Manager) GetStats() []ProviderStats {
 			SuccessReqs:  success,
 			SuccessRate:  rate,
 			ModelHealths: modelHealths,
+			Keys:         p.keyStats(),
 		})
 	}
 	return stats
@@ -672,49 +903,136 @@ func (m *Manager) GetAllModels() []string {
 	return models
 }
 
-// ProxyRequest 代理请求到上游
-func (p *Provider) ProxyRequest(ctx context.Context, method, path string, body []byte, headers map[string]string) (*http.Response, error) {
-	url := p.Config.BaseURL + path
-
+// newUpstreamRequest 创建上游请求（认证头在发送时由 do 按选中的 Key 设置）
+func (p *Provider) newUpstreamRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, p.Config.BaseURL+path, bodyReader)
 	if err != nil {
-		return nil, fmt.Errorf("create request failed: %w", err)
+		return nil, err
 	}
 
-	// 设置请求头
-	req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
+	if p.Config.Type == ProviderTypeAnthropic {
+		req.Header.Set("anthropic-version", p.anthropicVersion())
+	}
 	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// setAuthHeader 根据供应商类型设置认证头
+func (p *Provider) setAuthHeader(req *http.Request, key string) {
+	switch p.Config.Type {
+	case ProviderTypeAnthropic:
+		req.Header.Set("x-api-key", key)
+	case ProviderTypeGemini:
+		req.Header.Set("x-goog-api-key", key)
+	case ProviderTypeAzure:
+		req.Header.Set("api-key", key)
+	default:
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// modelsPath 获取模型列表接口路径（用于恢复检查）
+func (p *Provider) modelsPath() string {
+	switch p.Config.Type {
+	case ProviderTypeGemini:
+		return "/" + p.geminiVersion() + "/models"
+	case ProviderTypeAzure:
+		return "/openai/models?api-version=" + url.QueryEscape(p.azureAPIVersion())
+	}
+	return "/v1/models"
+}
+
+// setForwardHeaders 设置透传的客户端请求头（不覆盖认证相关头）
+func setForwardHeaders(req *http.Request, headers map[string]string, skip ...string) {
 	for k, v := range headers {
-		if k != "Authorization" && k != "Host" {
+		switch http.CanonicalHeaderKey(k) {
+		case "Authorization", "Host", "X-Api-Key", "Anthropic-Version", "X-Goog-Api-Key", "Api-Key":
+			continue
+		}
+		skipped := false
+		for _, s := range skip {
+			if k == s {
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
 			req.Header.Set(k, v)
 		}
 	}
+}
+
+// ProxyRequest 代理请求到上游
+func (p *Provider) ProxyRequest(ctx context.Context, method, path string, body []byte, headers map[string]string) (*http.Response, error) {
+	// 上游不支持 Responses 接口时转换为 chat 请求
+	if path == ResponsesPath && !p.supportsResponsesAPI() {
+		return p.proxyResponsesViaChat(ctx, body, headers, false)
+	}
+	// 非 Anthropic 上游接收 Messages 请求时转换为 chat 请求
+	if path == MessagesPath && p.Config.Type != ProviderTypeAnthropic {
+		return p.proxyMessagesViaChat(ctx, body, headers, false)
+	}
+	// 非 OpenAI 兼容上游：转换为原生接口
+	switch p.Config.Type {
+	case ProviderTypeAnthropic:
+		return p.proxyAnthropic(ctx, path, body, headers, false)
+	case ProviderTypeGemini:
+		return p.proxyGemini(ctx, path, body, headers, false)
+	case ProviderTypeAzure:
+		azurePath, err := p.azureDeploymentPath(path, body)
+		if err != nil {
+			return nil, err
+		}
+		path = azurePath
+	}
 
-	return p.httpClient.Do(req)
+	req, err := p.newUpstreamRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request failed: %w", err)
+	}
+
+	// 设置请求头
+	setForwardHeaders(req, headers)
+
+	return p.do(p.httpClient, req)
 }
 
 // ProxyStreamRequest 代理流式请求
 func (p *Provider) ProxyStreamRequest(ctx context.Context, path string, body []byte, headers map[string]string) (*http.Response, error) {
-	url := p.Config.BaseURL + path
+	// 上游不支持 Responses 接口时转换为 chat 请求
+	if path == ResponsesPath && !p.supportsResponsesAPI() {
+		return p.proxyResponsesViaChat(ctx, body, headers, true)
+	}
+	// 非 Anthropic 上游接收 Messages 请求时转换为 chat 请求
+	if path == MessagesPath && p.Config.Type != ProviderTypeAnthropic {
+		return p.proxyMessagesViaChat(ctx, body, headers, true)
+	}
+	// 非 OpenAI 兼容上游：转换为原生接口
+	switch p.Config.Type {
+	case ProviderTypeAnthropic:
+		return p.proxyAnthropic(ctx, path, body, headers, true)
+	case ProviderTypeGemini:
+		return p.proxyGemini(ctx, path, body, headers, true)
+	case ProviderTypeAzure:
+		azurePath, err := p.azureDeploymentPath(path, body)
+		if err != nil {
+			return nil, err
+		}
+		path = azurePath
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	req, err := p.newUpstreamRequest(ctx, "POST", path, body)
 	if err != nil {
 		return nil, fmt.Errorf("create stream request failed: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "text/event-stream")
-	for k, v := range headers {
-		if k != "Authorization" && k != "Host" && k != "Accept" {
-			req.Header.Set(k, v)
-		}
-	}
+	setForwardHeaders(req, headers, "Accept")
 
-	return p.streamClient.Do(req)
+	return p.do(p.streamClient, req)
 }
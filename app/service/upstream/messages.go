@@ -0,0 +1,547 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/model"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// proxyMessagesViaChat 将 Anthropic Messages 请求转换为 chat/completions 请求发送，并将响应转换回 Anthropic 格式
+// 用于非 Anthropic 上游（Anthropic 上游直接透传）
+func (p *Provider) proxyMessagesViaChat(ctx context.Context, body []byte, headers map[string]string, stream bool) (*http.Response, error) {
+	var req model.AnthropicMessagesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("parse messages request failed: %w", err)
+	}
+
+	chatReq, err := AnthropicToChatRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Stream = stream
+	if stream {
+		// 需要 usage 来填充 message_delta 事件
+		chatReq.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	chatBody, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal chat request failed: %w", err)
+	}
+
+	var resp *http.Response
+	if stream {
+		resp, err = p.ProxyStreamRequest(ctx, ChatCompletionsPath, chatBody, headers)
+	} else {
+		resp, err = p.ProxyRequest(ctx, "POST", ChatCompletionsPath, chatBody, headers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 错误响应统一转换为 Anthropic 错误格式
+	if resp.StatusCode != http.StatusOK {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		return replaceResponseBody(resp, openAIErrorToAnthropic(respBody, resp.StatusCode)), nil
+	}
+
+	if stream {
+		return wrapStreamResponse(resp, func(reader *bufio.Reader, w io.Writer) error {
+			return convertChatStreamToAnthropic(reader, w)
+		}), nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var chatResp model.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("parse chat response failed: %w", err)
+	}
+	newBody, err := json.Marshal(ChatResponseToAnthropic(&chatResp))
+	if err != nil {
+		return nil, err
+	}
+	return replaceResponseBody(resp, newBody), nil
+}
+
+// AnthropicToChatRequest 将 Anthropic Messages 请求转换为 chat/completions 请求
+func AnthropicToChatRequest(req *model.AnthropicMessagesRequest) (*model.ChatCompletionRequest, error) {
+	chatReq := &model.ChatCompletionRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.MaxTokens > 0 {
+		chatReq.MaxTokens = intPtr(req.MaxTokens)
+	}
+	if len(req.StopSequences) > 0 {
+		stop := make([]interface{}, len(req.StopSequences))
+		for i, s := range req.StopSequences {
+			stop[i] = s
+		}
+		chatReq.Stop = stop
+	}
+
+	// 工具
+	for _, t := range req.Tools {
+		chatReq.Tools = append(chatReq.Tools, model.Tool{
+			Type: "function",
+			Function: &model.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		})
+	}
+	if req.ToolChoice != nil {
+		switch req.ToolChoice.Type {
+		case "auto":
+			chatReq.ToolChoice = "auto"
+		case "any":
+			chatReq.ToolChoice = "required"
+		case "none":
+			chatReq.ToolChoice = "none"
+		case "tool":
+			chatReq.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": req.ToolChoice.Name},
+			}
+		}
+		if req.ToolChoice.DisableParallelToolUse {
+			parallel := false
+			chatReq.ParallelToolCalls = &parallel
+		}
+	}
+
+	// system：string 或文本内容块
+	if len(req.System) > 0 {
+		blocks, err := parseAnthropicContent(req.System)
+		if err != nil {
+			return nil, fmt.Errorf("invalid system: %w", err)
+		}
+		if text := anthropicBlocksText(blocks); text != "" {
+			chatReq.Messages = append(chatReq.Messages, model.ChatMessage{Role: "system", Content: text})
+		}
+	}
+
+	for i, msg := range req.Messages {
+		blocks, err := parseAnthropicContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid messages[%d].content: %w", i, err)
+		}
+		if msg.Role == "assistant" {
+			chatReq.Messages = append(chatReq.Messages, anthropicAssistantToChat(blocks))
+			continue
+		}
+		chatReq.Messages = append(chatReq.Messages, anthropicUserToChat(blocks)...)
+	}
+
+	if len(chatReq.Messages) == 0 {
+		return nil, fmt.Errorf("messages is required")
+	}
+	return chatReq, nil
+}
+
+// parseAnthropicContent 解析内容（string 或 []AnthropicContentBlock），string 视为单个文本块
+func parseAnthropicContent(raw json.RawMessage) ([]model.AnthropicContentBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []model.AnthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []model.AnthropicContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// anthropicBlocksText 拼接内容块中的文本
+func anthropicBlocksText(blocks []model.AnthropicContentBlock) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		if b.Type == "text" {
+			sb.WriteString(b.Text)
+		}
+	}
+	return sb.String()
+}
+
+// anthropicAssistantToChat 转换 assistant 消息（text -> content，tool_use -> tool_calls，thinking 丢弃）
+func anthropicAssistantToChat(blocks []model.AnthropicContentBlock) model.ChatMessage {
+	msg := model.ChatMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "tool_use":
+			args := string(b.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+				ID:       b.ID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: b.Name, Arguments: args},
+			})
+		}
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		msg.Content = text.String()
+	}
+	return msg
+}
+
+// anthropicUserToChat 转换 user 消息
+// tool_result 块转换为独立的 tool 消息（需紧跟在 assistant 的 tool_calls 之后），其余内容合并为一条 user 消息
+func anthropicUserToChat(blocks []model.AnthropicContentBlock) []model.ChatMessage {
+	var messages []model.ChatMessage
+	var parts []interface{}
+	for _, b := range blocks {
+		switch b.Type {
+		case "tool_result":
+			content := ""
+			if inner, err := parseAnthropicContent(b.Content); err == nil {
+				content = anthropicBlocksText(inner)
+			}
+			if b.IsError && content == "" {
+				content = "error"
+			}
+			messages = append(messages, model.ChatMessage{Role: "tool", ToolCallID: b.ToolUseID, Content: content})
+		case "text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": b.Text})
+		case "image":
+			if b.Source == nil {
+				continue
+			}
+			url := b.Source.URL
+			if b.Source.Type == "base64" {
+				url = "data:" + b.Source.MediaType + ";base64," + b.Source.Data
+			}
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+		}
+	}
+
+	switch {
+	case len(parts) == 1 && len(messages) == 0:
+		// 单个文本块使用 string 形式，兼容不支持多模态数组的上游
+		if m, ok := parts[0].(map[string]interface{}); ok && m["type"] == "text" {
+			return []model.ChatMessage{{Role: "user", Content: m["text"]}}
+		}
+		messages = append(messages, model.ChatMessage{Role: "user", Content: parts})
+	case len(parts) > 0:
+		messages = append(messages, model.ChatMessage{Role: "user", Content: parts})
+	}
+	return messages
+}
+
+// ChatResponseToAnthropic 将 chat/completions 响应转换为 Anthropic Messages 响应
+func ChatResponseToAnthropic(resp *model.ChatCompletionResponse) *model.AnthropicMessagesResponse {
+	result := &model.AnthropicMessagesResponse{
+		ID:      "msg_" + strings.TrimPrefix(resp.ID, "chatcmpl-"),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []model.AnthropicContentBlock{},
+		Usage:   chatUsageToAnthropic(resp.Usage),
+	}
+
+	finishReason := "stop"
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+		if choice.Message != nil {
+			if text := chatContentText(choice.Message.Content); text != "" {
+				result.Content = append(result.Content, model.AnthropicContentBlock{Type: "text", Text: text})
+			}
+			for _, tc := range choice.Message.ToolCalls {
+				result.Content = append(result.Content, model.AnthropicContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: toolArgumentsToInput(tc.Function.Arguments),
+				})
+			}
+		}
+	}
+	stopReason := chatFinishReasonToAnthropic(finishReason)
+	result.StopReason = &stopReason
+	return result
+}
+
+// toolArgumentsToInput 将工具调用参数转换为 tool_use 的 input（非法 JSON 时返回空对象）
+func toolArgumentsToInput(arguments string) json.RawMessage {
+	if arguments == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage(`{}`)
+	}
+	return json.RawMessage(arguments)
+}
+
+// chatFinishReasonToAnthropic 转换结束原因
+func chatFinishReasonToAnthropic(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// chatUsageToAnthropic 转换使用量统计（Anthropic 的 input_tokens 不含缓存命中部分）
+func chatUsageToAnthropic(usage *model.Usage) *model.AnthropicUsage {
+	if usage == nil {
+		return &model.AnthropicUsage{}
+	}
+	result := &model.AnthropicUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	if usage.PromptTokensDetails != nil && usage.PromptTokensDetails.CachedTokens > 0 {
+		result.CacheReadInputTokens = usage.PromptTokensDetails.CachedTokens
+		result.InputTokens -= usage.PromptTokensDetails.CachedTokens
+	}
+	return result
+}
+
+// anthropicErrorType 根据 HTTP 状态码获取 Anthropic 错误类型
+func anthropicErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// NewAnthropicError 创建 Anthropic 格式的错误响应
+func NewAnthropicError(statusCode int, message string) model.AnthropicError {
+	return model.AnthropicError{
+		Type:  "error",
+		Error: model.AnthropicErrorDetail{Type: anthropicErrorType(statusCode), Message: message},
+	}
+}
+
+// openAIErrorToAnthropic 将 OpenAI 错误响应体转换为 Anthropic 错误格式
+func openAIErrorToAnthropic(body []byte, statusCode int) []byte {
+	var openAIErr model.OpenAIError
+	if err := json.Unmarshal(body, &openAIErr); err != nil || openAIErr.Error.Message == "" {
+		return body
+	}
+	return mustMarshal(NewAnthropicError(statusCode, openAIErr.Error.Message))
+}
+
+// anthropicStreamConverter chat 流式响应 -> Anthropic 流式事件 转换器
+type anthropicStreamConverter struct {
+	w          io.Writer
+	started    bool
+	blockIdx   int         // 当前打开的内容块序号（-1 表示没有打开的块）
+	blockType  string      // 当前打开的内容块类型
+	blockCount int         // 已创建的内容块数
+	toolBlocks map[int]int // chat tool_call 序号 -> 内容块序号
+	finish     string      // chat finish_reason
+	usage      *model.Usage
+}
+
+// convertChatStreamToAnthropic 将 chat 流式响应转换为 Anthropic 流式事件
+func convertChatStreamToAnthropic(reader *bufio.Reader, w io.Writer) error {
+	c := &anthropicStreamConverter{w: w, blockIdx: -1, toolBlocks: make(map[int]int)}
+	done := false
+
+	for {
+		ev, err := readSSEEvent(reader)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		data := strings.TrimSpace(string(ev.Data))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		// 流内错误转换为 error 事件
+		var openAIErr model.OpenAIError
+		if strings.Contains(data, `"error"`) {
+			if err := json.Unmarshal([]byte(data), &openAIErr); err == nil && openAIErr.Error.Message != "" {
+				return c.emit("error", NewAnthropicError(http.StatusInternalServerError, openAIErr.Error.Message))
+			}
+		}
+
+		var chunk model.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if err := c.handleChunk(&chunk); err != nil {
+			return err
+		}
+	}
+
+	if !c.started {
+		// 上游没有返回任何数据块
+		return c.emit("error", NewAnthropicError(http.StatusBadGateway, "upstream stream ended without data"))
+	}
+	if !done && c.finish == "" {
+		// 既没有 [DONE] 也没有结束原因，视为流被截断
+		return io.ErrUnexpectedEOF
+	}
+	return c.finishStream()
+}
+
+// emit 写入一个 Anthropic 流式事件
+func (c *anthropicStreamConverter) emit(eventType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "event: %s\ndata: %s\n\n", eventType, data)
+	return err
+}
+
+// handleChunk 处理单个 chat 数据块
+func (c *anthropicStreamConverter) handleChunk(chunk *model.ChatCompletionChunk) error {
+	if !c.started {
+		c.started = true
+		if err := c.emit("message_start", map[string]interface{}{
+			"type": "message_start",
+			"message": model.AnthropicMessagesResponse{
+				ID:      "msg_" + strings.TrimPrefix(chunk.ID, "chatcmpl-"),
+				Type:    "message",
+				Role:    "assistant",
+				Model:   chunk.Model,
+				Content: []model.AnthropicContentBlock{},
+				Usage:   &model.AnthropicUsage{},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta != nil {
+			if text := chatContentText(choice.Delta.Content); text != "" {
+				if err := c.openBlock("text", map[string]interface{}{"type": "text", "text": ""}); err != nil {
+					return err
+				}
+				if err := c.emitDelta(c.blockIdx, map[string]interface{}{"type": "text_delta", "text": text}); err != nil {
+					return err
+				}
+			}
+			for i, tc := range choice.Delta.ToolCalls {
+				idx := i
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				blockIdx, exists := c.toolBlocks[idx]
+				if !exists {
+					if err := c.openBlock("tool_use", map[string]interface{}{
+						"type": "tool_use", "id": tc.ID, "name": tc.Function.Name, "input": map[string]interface{}{},
+					}); err != nil {
+						return err
+					}
+					blockIdx = c.blockIdx
+					c.toolBlocks[idx] = blockIdx
+				}
+				if tc.Function.Arguments != "" {
+					if err := c.emitDelta(blockIdx, map[string]interface{}{"type": "input_json_delta", "partial_json": tc.Function.Arguments}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finish = *choice.FinishReason
+		}
+	}
+	return nil
+}
+
+// openBlock 打开新的内容块（文本块连续输出时复用当前块）
+func (c *anthropicStreamConverter) openBlock(blockType string, contentBlock map[string]interface{}) error {
+	if blockType == "text" && c.blockType == "text" {
+		return nil
+	}
+	if err := c.closeBlock(); err != nil {
+		return err
+	}
+	c.blockIdx = c.blockCount
+	c.blockType = blockType
+	c.blockCount++
+	return c.emit("content_block_start", map[string]interface{}{
+		"type": "content_block_start", "index": c.blockIdx, "content_block": contentBlock,
+	})
+}
+
+// closeBlock 关闭当前打开的内容块
+func (c *anthropicStreamConverter) closeBlock() error {
+	if c.blockIdx < 0 {
+		return nil
+	}
+	idx := c.blockIdx
+	c.blockIdx = -1
+	c.blockType = ""
+	return c.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": idx})
+}
+
+// emitDelta 写入内容块增量
+func (c *anthropicStreamConverter) emitDelta(index int, delta map[string]interface{}) error {
+	return c.emit("content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": index, "delta": delta})
+}
+
+// finishStream 输出结束事件
+func (c *anthropicStreamConverter) finishStream() error {
+	if err := c.closeBlock(); err != nil {
+		return err
+	}
+	usage := chatUsageToAnthropic(c.usage)
+	if err := c.emit("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": chatFinishReasonToAnthropic(c.finish), "stop_sequence": nil},
+		"usage": usage,
+	}); err != nil {
+		return err
+	}
+	return c.emit("message_stop", map[string]interface{}{"type": "message_stop"})
+}
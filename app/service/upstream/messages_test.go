@@ -0,0 +1,265 @@
+package upstream
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_base/app/model"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestAnthropicToChatRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "system, tools and tool round trip",
+			req: `{"model":"claude","max_tokens":100,"system":"Be brief","stop_sequences":["END"],"temperature":0.3,
+				"tools":[{"name":"get_weather","description":"Get weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"tool","name":"get_weather","disable_parallel_tool_use":true},
+				"messages":[
+					{"role":"user","content":"weather?"},
+					{"role":"assistant","content":[
+						{"type":"thinking","thinking":"hmm","signature":"s"},
+						{"type":"text","text":"Checking."},
+						{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+					{"role":"user","content":[
+						{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"sunny"}]},
+						{"type":"text","text":"and tomorrow?"}]}]}`,
+			want: `{"model":"claude","max_tokens":100,"stop":["END"],"temperature":0.3,"parallel_tool_calls":false,
+				"tools":[{"type":"function","function":{"name":"get_weather","description":"Get weather","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"get_weather"}},
+				"messages":[
+					{"role":"system","content":"Be brief"},
+					{"role":"user","content":"weather?"},
+					{"role":"assistant","content":"Checking.","tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+					{"role":"tool","content":"sunny","tool_call_id":"toolu_1"},
+					{"role":"user","content":[{"type":"text","text":"and tomorrow?"}]}]}`,
+		},
+		{
+			name: "system blocks, images and error results",
+			req: `{"model":"claude","max_tokens":10,"system":[{"type":"text","text":"A"},{"type":"text","text":"B"}],"tool_choice":{"type":"any"},
+				"messages":[
+					{"role":"user","content":[
+						{"type":"text","text":"look"},
+						{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}},
+						{"type":"image","source":{"type":"url","url":"https://example.com/a.png"}}]},
+					{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"f","input":{}}]},
+					{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","is_error":true}]}]}`,
+			want: `{"model":"claude","max_tokens":10,"tool_choice":"required","messages":[
+					{"role":"system","content":"AB"},
+					{"role":"user","content":[
+						{"type":"text","text":"look"},
+						{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},
+						{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]},
+					{"role":"assistant","content":null,"tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"f","arguments":"{}"}}]},
+					{"role":"tool","content":"error","tool_call_id":"toolu_1"}]}`,
+		},
+		{
+			name:    "invalid system",
+			req:     `{"model":"claude","max_tokens":10,"system":123,"messages":[{"role":"user","content":"hi"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid content",
+			req:     `{"model":"claude","max_tokens":10,"messages":[{"role":"user","content":{"text":"hi"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no messages",
+			req:     `{"model":"claude","max_tokens":10,"messages":[]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		var req model.AnthropicMessagesRequest
+		if err := json.Unmarshal([]byte(tt.req), &req); err != nil {
+			t.Fatalf("%s: invalid request: %v", tt.name, err)
+		}
+		got, err := AnthropicToChatRequest(&req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			assertJSON(t, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChatResponseToAnthropic(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{
+			name: "text and tool calls",
+			resp: `{"id":"chatcmpl-abc","model":"gpt","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"Checking.","tool_calls":[
+					{"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}},
+					{"id":"call_2","type":"function","function":{"name":"g","arguments":"not json"}}]}}],
+				"usage":{"prompt_tokens":30,"completion_tokens":5,"total_tokens":35,"prompt_tokens_details":{"cached_tokens":10}}}`,
+			want: `{"id":"msg_abc","type":"message","role":"assistant","model":"gpt","content":[
+					{"type":"text","text":"Checking."},
+					{"type":"tool_use","id":"call_1","name":"f","input":{"a":1}},
+					{"type":"tool_use","id":"call_2","name":"g","input":{}}],
+				"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":20,"output_tokens":5,"cache_read_input_tokens":10}}`,
+		},
+		{
+			name: "length without usage",
+			resp: `{"id":"chatcmpl-x","model":"gpt","choices":[{"index":0,"finish_reason":"length","message":{"role":"assistant","content":""}}]}`,
+			want: `{"id":"msg_x","type":"message","role":"assistant","model":"gpt","content":[],"stop_reason":"max_tokens","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+		{
+			name: "no choices",
+			resp: `{"id":"chatcmpl-y","model":"gpt","choices":[]}`,
+			want: `{"id":"msg_y","type":"message","role":"assistant","model":"gpt","content":[],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+	}
+	for _, tt := range tests {
+		var resp model.ChatCompletionResponse
+		if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", tt.name, err)
+		}
+		assertJSON(t, tt.name, ChatResponseToAnthropic(&resp), tt.want)
+	}
+}
+
+func TestChatFinishReasonToAnthropic(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		want         string
+	}{
+		{"stop", "end_turn"},
+		{"", "end_turn"},
+		{"length", "max_tokens"},
+		{"tool_calls", "tool_use"},
+		{"function_call", "tool_use"},
+		{"content_filter", "refusal"},
+	}
+	for _, tt := range tests {
+		if got := chatFinishReasonToAnthropic(tt.finishReason); got != tt.want {
+			t.Errorf("chatFinishReasonToAnthropic(%q) = %q, want %q", tt.finishReason, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIErrorToAnthropic(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{
+			name:   "rate limited",
+			body:   `{"error":{"message":"Too many requests","type":"requests","code":"rate_limit_exceeded"}}`,
+			status: http.StatusTooManyRequests,
+			want:   `{"type":"error","error":{"type":"rate_limit_error","message":"Too many requests"}}`,
+		},
+		{
+			name:   "unauthorized",
+			body:   `{"error":{"message":"Invalid API key","type":"invalid_request_error"}}`,
+			status: http.StatusUnauthorized,
+			want:   `{"type":"error","error":{"type":"authentication_error","message":"Invalid API key"}}`,
+		},
+		{
+			name:   "overloaded",
+			body:   `{"error":{"message":"busy","type":"server_error"}}`,
+			status: 529,
+			want:   `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`,
+		},
+		{
+			name:   "not an openai error",
+			body:   `{"detail":"bad gateway"}`,
+			status: http.StatusBadGateway,
+			want:   `{"detail":"bad gateway"}`,
+		},
+	}
+	for _, tt := range tests {
+		assertJSON(t, tt.name, json.RawMessage(openAIErrorToAnthropic([]byte(tt.body), tt.status)), tt.want)
+	}
+}
+
+func TestConvertChatStreamToAnthropic(t *testing.T) {
+	messageStart := `{"event":"message_start","data":{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"gpt","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}}`
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "text then tool call",
+			input: sse(
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":" there"}}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":""}}]}}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"a\":1}"}}]}}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`,
+				`[DONE]`,
+			),
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":0}},
+				{"event":"content_block_start","data":{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"call_1","name":"f","input":{}}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":1}"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":1}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"input_tokens":10,"output_tokens":4}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+		{
+			name: "finish reason without done",
+			input: sse(
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"length"}]}`,
+			),
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}},
+				{"event":"content_block_stop","data":{"type":"content_block_stop","index":0}},
+				{"event":"message_delta","data":{"type":"message_delta","delta":{"stop_reason":"max_tokens","stop_sequence":null},"usage":{"input_tokens":0,"output_tokens":0}}},
+				{"event":"message_stop","data":{"type":"message_stop"}}]`,
+		},
+		{
+			name: "in-stream error",
+			input: sse(
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+				`{"error":{"message":"overloaded","type":"server_error"}}`,
+			),
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}},
+				{"event":"error","data":{"type":"error","error":{"type":"api_error","message":"overloaded"}}}]`,
+		},
+		{
+			name:  "empty stream",
+			input: sse(`[DONE]`),
+			want:  `[{"event":"error","data":{"type":"error","error":{"type":"api_error","message":"upstream stream ended without data"}}}]`,
+		},
+		{
+			name: "truncated stream",
+			input: sse(
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+			),
+			want: `[` + messageStart + `,
+				{"event":"content_block_start","data":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}},
+				{"event":"content_block_delta","data":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}}]`,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		events, err := convertStream(t, tt.input, convertChatStreamToAnthropic)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		assertJSON(t, tt.name, events, tt.want)
+	}
+}
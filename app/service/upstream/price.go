@@ -0,0 +1,50 @@
+package upstream
+
+import (
+	"gin_base/app/model"
+	"math"
+)
+
+// ModelPrice 模型价格（美元 / 100 万 token）
+type ModelPrice struct {
+	Input       float64 `json:"input" yaml:"input" mapstructure:"input"`                                          // 输入
+	CachedInput float64 `json:"cached_input,omitempty" yaml:"cached_input,omitempty" mapstructure:"cached_input"` // 命中缓存的输入（不填按输入计价）
+	Output      float64 `json:"output" yaml:"output" mapstructure:"output"`                                       // 输出
+	Reasoning   float64 `json:"reasoning,omitempty" yaml:"reasoning,omitempty" mapstructure:"reasoning"`          // 推理（不填按输出计价）
+}
+
+// Cost 计算 token 用量的费用（美元），未配置价格时为 0
+// 缓存 token 包含在输入中、推理 token 包含在输出中，分别按各自价格计费
+func (p *ModelPrice) Cost(usage *model.Usage) float64 {
+	if p == nil || usage == nil {
+		return 0
+	}
+	cached, reasoning := 0, 0
+	if usage.PromptTokensDetails != nil {
+		cached = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		reasoning = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	cachedPrice := p.CachedInput
+	if cachedPrice <= 0 {
+		cachedPrice = p.Input
+	}
+	reasoningPrice := p.Reasoning
+	if reasoningPrice <= 0 {
+		reasoningPrice = p.Output
+	}
+	cost := float64(usage.PromptTokens-cached)*p.Input +
+		float64(cached)*cachedPrice +
+		float64(usage.CompletionTokens-reasoning)*p.Output +
+		float64(reasoning)*reasoningPrice
+	return cost / 1e6
+}
+
+// referencePrice 用于比较候选成本的参考价格（输入与输出价格之和），未配置价格时视为最贵
+func (p *ModelPrice) referencePrice() float64 {
+	if p == nil {
+		return math.Inf(1)
+	}
+	return p.Input + p.Output
+}
@@ -0,0 +1,113 @@
+package upstream
+
+import (
+	"gin_base/app/model"
+	"gin_base/app/service/metrics"
+	"time"
+)
+
+// 请求结果（model_switch_requests_total 的 outcome 标签）
+const (
+	outcomeSuccess     = "success"      // 成功
+	outcomeFailure     = "failure"      // 计入健康失败的错误
+	outcomeRejected    = "rejected"     // 不计入健康失败的错误
+	outcomeRateLimited = "rate_limited" // 上游限流（429）
+)
+
+// Prometheus 指标（进程级，Manager 热重载后继续累计）
+var (
+	promRequests = metrics.NewCounterVec("model_switch_requests_total",
+		"Upstream request attempts by outcome (success, failure, rejected, rate_limited).",
+		"alias", "provider", "upstream_model", "outcome")
+	promErrors = metrics.NewCounterVec("model_switch_errors_total",
+		"Failed upstream request attempts by error class (429, 4xx, 5xx, network, timeout, stream_error).",
+		"alias", "provider", "upstream_model", "class")
+	promLatency = metrics.NewHistogramVec("model_switch_request_duration_seconds",
+		"Total duration of successful upstream request attempts.",
+		[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+		"alias", "provider", "upstream_model")
+	promTTFT = metrics.NewHistogramVec("model_switch_ttft_seconds",
+		"Time to first token of successful upstream request attempts (response headers for non-streaming requests).",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60},
+		"alias", "provider", "upstream_model")
+	promTokens = metrics.NewCounterVec("model_switch_tokens_total",
+		"Tokens reported by upstream usage by type (prompt, completion, cached, reasoning).",
+		"alias", "provider", "upstream_model", "type")
+	promFailovers = metrics.NewCounterVec("model_switch_failovers_total",
+		"Failed attempts after which the request failed over to the next candidate.",
+		"alias", "provider", "upstream_model")
+	promProbes = metrics.NewCounterVec("model_switch_recovery_probes_total",
+		"Recovery probe outcomes in probe recovery mode (recovered, failed).",
+		"provider", "upstream_model", "outcome")
+	promInFlight = metrics.NewGaugeVec("model_switch_in_flight_requests",
+		"Upstream request attempts currently in flight.",
+		"alias", "provider", "upstream_model")
+	promHealthy = metrics.NewGaugeVec("model_switch_upstream_healthy",
+		"Whether the upstream model circuit is closed (1) or not (0).",
+		"provider", "upstream_model")
+	promBreakerState = metrics.NewGaugeVec("model_switch_upstream_breaker_state",
+		"Circuit breaker state of the upstream model (0 closed, 1 open, 2 half_open).",
+		"provider", "upstream_model")
+	promCooldown = metrics.NewGaugeVec("model_switch_upstream_cooldown_seconds",
+		"Remaining rate limit cool-down of the upstream model.",
+		"provider", "upstream_model")
+)
+
+// observeAttemptMetrics 记录一次成功尝试的延迟和首 token 时间
+func observeAttemptMetrics(p *Provider, alias, upstreamModel string, latency, ttft time.Duration) {
+	promLatency.Observe(latency.Seconds(), alias, p.Config.Name, upstreamModel)
+	promTTFT.Observe(ttft.Seconds(), alias, p.Config.Name, upstreamModel)
+}
+
+// countTokens 记录 token 用量
+func countTokens(p *Provider, alias, upstreamModel string, usage *model.Usage) {
+	labels := []string{alias, p.Config.Name, upstreamModel}
+	promTokens.Add(float64(usage.PromptTokens), append(labels, "prompt")...)
+	promTokens.Add(float64(usage.CompletionTokens), append(labels, "completion")...)
+	if usage.PromptTokensDetails != nil {
+		promTokens.Add(float64(usage.PromptTokensDetails.CachedTokens), append(labels, "cached")...)
+	}
+	if usage.CompletionTokensDetails != nil {
+		promTokens.Add(float64(usage.CompletionTokensDetails.ReasoningTokens), append(labels, "reasoning")...)
+	}
+}
+
+// RecordFailover 记录一次故障转移：该候选失败后请求将尝试下一个候选
+func (m *Manager) RecordFailover(p *Provider, alias string, upstreamModel string) {
+	promFailovers.Inc(alias, p.Config.Name, upstreamModel)
+}
+
+// CollectMetrics 按当前状态更新进行中请求数、健康状态等仪表盘（导出 Prometheus 指标前调用）
+func (m *Manager) CollectMetrics() {
+	promInFlight.Reset()
+	promHealthy.Reset()
+	promBreakerState.Reset()
+	promCooldown.Reset()
+
+	now := time.Now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.providers {
+		p.mu.RLock()
+		for _, mm := range p.Config.ModelMappings {
+			if stats, exists := p.modelStats[mm.Alias+"|"+mm.Upstream]; exists {
+				promInFlight.Set(float64(stats.InFlight.Load()), mm.Alias, p.Config.Name, mm.Upstream)
+			}
+		}
+		for upstreamModel, health := range p.modelHealths {
+			state := health.state.Load()
+			healthy := 0.0
+			if state == breakerClosed {
+				healthy = 1
+			}
+			var cooldown float64
+			if health.inCooldown(now) {
+				cooldown = time.Unix(0, health.CooldownUntil.Load()).Sub(now).Seconds()
+			}
+			promHealthy.Set(healthy, p.Config.Name, upstreamModel)
+			promBreakerState.Set(float64(state), p.Config.Name, upstreamModel)
+			promCooldown.Set(cooldown, p.Config.Name, upstreamModel)
+		}
+		p.mu.RUnlock()
+	}
+}
@@ -0,0 +1,546 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin_base/app/model"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// supportsResponsesAPI 上游是否原生支持 /v1/responses 接口（非 OpenAI 兼容上游一律经由 chat 转换）
+func (p *Provider) supportsResponsesAPI() bool {
+	return p.Config.Type == ProviderTypeOpenAI && !p.Config.ResponsesViaChat
+}
+
+// proxyResponsesViaChat 将 Responses 请求转换为 chat/completions 请求发送，并将响应转换回 Responses 格式
+func (p *Provider) proxyResponsesViaChat(ctx context.Context, body []byte, headers map[string]string, stream bool) (*http.Response, error) {
+	var req model.ResponsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("parse responses request failed: %w", err)
+	}
+
+	chatReq, err := ResponsesToChatRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+	chatBody, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal chat request failed: %w", err)
+	}
+
+	if stream {
+		resp, err := p.ProxyStreamRequest(ctx, ChatCompletionsPath, chatBody, headers)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		return wrapStreamResponse(resp, func(reader *bufio.Reader, w io.Writer) error {
+			return convertChatStreamToResponses(reader, w)
+		}), nil
+	}
+
+	resp, err := p.ProxyRequest(ctx, "POST", ChatCompletionsPath, chatBody, headers)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var chatResp model.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("parse chat response failed: %w", err)
+	}
+	newBody, err := json.Marshal(ChatResponseToResponses(&chatResp))
+	if err != nil {
+		return nil, err
+	}
+	return replaceResponseBody(resp, newBody), nil
+}
+
+// ResponsesToChatRequest 将 Responses 请求转换为 chat/completions 请求
+func ResponsesToChatRequest(req *model.ResponsesRequest) (*model.ChatCompletionRequest, error) {
+	chatReq := &model.ChatCompletionRequest{
+		Model:             req.Model,
+		Stream:            req.Stream,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		MaxTokens:         req.MaxOutputTokens,
+		ParallelToolCalls: req.ParallelToolCalls,
+		Metadata:          req.Metadata,
+	}
+	if req.Stream {
+		// 需要 usage 来填充 response.completed 事件
+		chatReq.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+	if req.Text != nil && req.Text.Format != nil && req.Text.Format.Type != "text" {
+		format := &model.ResponseFormat{Type: req.Text.Format.Type}
+		if req.Text.Format.Type == "json_schema" {
+			format.JSONSchema = map[string]interface{}{
+				"name":   req.Text.Format.Name,
+				"schema": req.Text.Format.Schema,
+				"strict": req.Text.Format.Strict,
+			}
+		}
+		chatReq.ResponseFormat = format
+	}
+
+	// 工具：Responses 为扁平结构，chat 为嵌套 function 结构（非函数工具上游无法支持，直接忽略）
+	for _, t := range req.Tools {
+		if t.Type != "function" {
+			continue
+		}
+		chatReq.Tools = append(chatReq.Tools, model.Tool{
+			Type: "function",
+			Function: &model.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+				Strict:      t.Strict,
+			},
+		})
+	}
+	switch tc := req.ToolChoice.(type) {
+	case string:
+		chatReq.ToolChoice = tc
+	case map[string]interface{}:
+		if name, ok := tc["name"].(string); ok && tc["type"] == "function" {
+			chatReq.ToolChoice = map[string]interface{}{"type": "function", "function": map[string]string{"name": name}}
+		}
+	}
+
+	// 消息
+	if req.Instructions != "" {
+		chatReq.Messages = append(chatReq.Messages, model.ChatMessage{Role: "system", Content: req.Instructions})
+	}
+	messages, err := responsesInputToMessages(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Messages = append(chatReq.Messages, messages...)
+	if len(chatReq.Messages) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+
+	return chatReq, nil
+}
+
+// responsesInputToMessages 将 Responses 的 input 转换为 chat 消息列表
+func responsesInputToMessages(input json.RawMessage) ([]model.ChatMessage, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	// 字符串输入等价于一条 user 消息
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return []model.ChatMessage{{Role: "user", Content: text}}, nil
+	}
+
+	var items []model.ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	var messages []model.ChatMessage
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			content, err := responsesContentToChat(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, model.ChatMessage{Role: role, Content: content})
+		case "function_call":
+			call := model.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息中
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" && len(messages[n-1].ToolCalls) > 0 {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, call)
+			} else {
+				messages = append(messages, model.ChatMessage{Role: "assistant", ToolCalls: []model.ToolCall{call}})
+			}
+		case "function_call_output":
+			messages = append(messages, model.ChatMessage{Role: "tool", ToolCallID: item.CallID, Content: item.Output})
+		}
+	}
+	return messages, nil
+}
+
+// responsesContentToChat 将 Responses 消息内容转换为 chat 消息内容（string 或 []ContentPart）
+func responsesContentToChat(content json.RawMessage) (interface{}, error) {
+	if len(content) == 0 {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []model.ResponsesContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+
+	chatParts := make([]model.ContentPart, 0, len(parts))
+	onlyText := true
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			chatParts = append(chatParts, model.ContentPart{Type: "text", Text: part.Text})
+		case "input_image":
+			onlyText = false
+			chatParts = append(chatParts, model.ContentPart{Type: "image_url", ImageURL: &model.ImageURL{URL: part.ImageURL, Detail: part.Detail}})
+		}
+	}
+
+	// 纯文本内容合并为字符串，兼容仅支持字符串内容的上游
+	if onlyText {
+		texts := make([]string, 0, len(chatParts))
+		for _, part := range chatParts {
+			texts = append(texts, part.Text)
+		}
+		return strings.Join(texts, "\n"), nil
+	}
+	return chatParts, nil
+}
+
+// ChatResponseToResponses 将 chat/completions 响应转换为 Responses 响应
+func ChatResponseToResponses(chatResp *model.ChatCompletionResponse) *model.ResponsesResponse {
+	resp := &model.ResponsesResponse{
+		ID:        "resp_" + chatResp.ID,
+		Object:    "response",
+		CreatedAt: chatResp.Created,
+		Status:    "completed",
+		Model:     chatResp.Model,
+		Output:    []model.ResponsesOutputItem{},
+		Usage:     chatUsageToResponses(chatResp.Usage),
+	}
+	if resp.CreatedAt == 0 {
+		resp.CreatedAt = time.Now().Unix()
+	}
+	if len(chatResp.Choices) == 0 {
+		return resp
+	}
+
+	choice := chatResp.Choices[0]
+	if choice.Message != nil {
+		if text := chatContentText(choice.Message.Content); text != "" {
+			resp.Output = append(resp.Output, model.ResponsesOutputItem{
+				Type:    "message",
+				ID:      randomID("msg_"),
+				Status:  "completed",
+				Role:    "assistant",
+				Content: []model.ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+			})
+		}
+		for _, tc := range choice.Message.ToolCalls {
+			resp.Output = append(resp.Output, model.ResponsesOutputItem{
+				Type:      "function_call",
+				ID:        randomID("fc_"),
+				Status:    "completed",
+				CallID:    tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			})
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason == "length" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &model.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	return resp
+}
+
+// chatUsageToResponses 转换使用量统计
+func chatUsageToResponses(usage *model.Usage) *model.ResponsesUsage {
+	if usage == nil {
+		return nil
+	}
+	result := &model.ResponsesUsage{
+		InputTokens:         usage.PromptTokens,
+		OutputTokens:        usage.CompletionTokens,
+		TotalTokens:         usage.TotalTokens,
+		InputTokensDetails:  &model.ResponsesInputTokensDetails{},
+		OutputTokensDetails: &model.ResponsesOutputTokensDetails{},
+	}
+	if usage.PromptTokensDetails != nil {
+		result.InputTokensDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		result.OutputTokensDetails.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return result
+}
+
+// chatContentText 提取 chat 消息内容中的文本
+func chatContentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var sb strings.Builder
+		for _, part := range c {
+			if m, ok := part.(map[string]interface{}); ok {
+				if text, ok := m["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// responsesStreamConverter chat 流式响应 -> Responses 流式事件 转换器
+type responsesStreamConverter struct {
+	w        io.Writer
+	seq      int
+	started  bool
+	resp     model.ResponsesResponse
+	text     strings.Builder
+	textIdx  int          // 文本消息在 output 中的位置（-1 表示尚未创建）
+	toolIdx  map[int]int  // chat tool_call 序号 -> output 位置
+	finish   string       // chat finish_reason
+	usage    *model.Usage // chat usage
+	toolArgs map[int]*strings.Builder
+}
+
+// convertChatStreamToResponses 将 chat 流式响应转换为 Responses 流式事件
+func convertChatStreamToResponses(reader *bufio.Reader, w io.Writer) error {
+	c := &responsesStreamConverter{
+		w:        w,
+		textIdx:  -1,
+		toolIdx:  make(map[int]int),
+		toolArgs: make(map[int]*strings.Builder),
+		resp: model.ResponsesResponse{
+			Object:    "response",
+			CreatedAt: time.Now().Unix(),
+			Status:    "in_progress",
+			Output:    []model.ResponsesOutputItem{},
+		},
+	}
+
+	done := false
+	for {
+		ev, err := readSSEEvent(reader)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		data := strings.TrimSpace(string(ev.Data))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		// 流内错误转换为 error 事件
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			continue
+		}
+		if errField, ok := raw["error"]; ok && errField != nil {
+			code, message := "upstream_error", fmt.Sprintf("%v", errField)
+			if e, ok := errField.(map[string]interface{}); ok {
+				if m, ok := e["message"].(string); ok {
+					message = m
+				}
+				if cd, ok := e["code"]; ok && cd != nil {
+					code = fmt.Sprintf("%v", cd)
+				}
+			}
+			return c.emit(model.ResponsesStreamEvent{Type: "error", Code: code, Message: message})
+		}
+
+		var chunk model.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if err := c.handleChunk(&chunk); err != nil {
+			return err
+		}
+	}
+
+	if !c.started {
+		// 上游没有返回任何数据块
+		return c.emit(model.ResponsesStreamEvent{Type: "error", Code: "empty_stream", Message: "upstream stream ended without data"})
+	}
+	if !done && c.finish == "" {
+		// 既没有 [DONE] 也没有结束原因，视为流被截断
+		return io.ErrUnexpectedEOF
+	}
+	return c.finishStream()
+}
+
+// emit 写入一个 Responses 流式事件
+func (c *responsesStreamConverter) emit(ev model.ResponsesStreamEvent) error {
+	ev.SequenceNumber = c.seq
+	c.seq++
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
+
+// snapshot 返回当前响应快照（避免后续修改影响已序列化的事件）
+func (c *responsesStreamConverter) snapshot() *model.ResponsesResponse {
+	resp := c.resp
+	resp.Output = append([]model.ResponsesOutputItem{}, c.resp.Output...)
+	return &resp
+}
+
+// handleChunk 处理单个 chat 数据块
+func (c *responsesStreamConverter) handleChunk(chunk *model.ChatCompletionChunk) error {
+	if !c.started {
+		c.started = true
+		c.resp.ID = "resp_" + chunk.ID
+		c.resp.Model = chunk.Model
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.created", Response: c.snapshot()}); err != nil {
+			return err
+		}
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.in_progress", Response: c.snapshot()}); err != nil {
+			return err
+		}
+	}
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+
+	choice := chunk.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		c.finish = *choice.FinishReason
+	}
+	if choice.Delta == nil {
+		return nil
+	}
+
+	// 文本增量
+	if text := chatContentText(choice.Delta.Content); text != "" {
+		if c.textIdx < 0 {
+			c.textIdx = len(c.resp.Output)
+			item := model.ResponsesOutputItem{Type: "message", ID: randomID("msg_"), Status: "in_progress", Role: "assistant", Content: []model.ResponsesOutputContent{}}
+			c.resp.Output = append(c.resp.Output, item)
+			if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_item.added", OutputIndex: intPtr(c.textIdx), Item: &item}); err != nil {
+				return err
+			}
+			if err := c.emit(model.ResponsesStreamEvent{Type: "response.content_part.added", OutputIndex: intPtr(c.textIdx), ContentIndex: intPtr(0), ItemID: item.ID,
+				Part: &model.ResponsesOutputContent{Type: "output_text", Annotations: []interface{}{}}}); err != nil {
+				return err
+			}
+		}
+		c.text.WriteString(text)
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_text.delta", OutputIndex: intPtr(c.textIdx), ContentIndex: intPtr(0),
+			ItemID: c.resp.Output[c.textIdx].ID, Delta: text}); err != nil {
+			return err
+		}
+	}
+
+	// 工具调用增量
+	for i, tc := range choice.Delta.ToolCalls {
+		index := i
+		if tc.Index != nil {
+			index = *tc.Index
+		}
+		outIdx, exists := c.toolIdx[index]
+		if !exists {
+			outIdx = len(c.resp.Output)
+			c.toolIdx[index] = outIdx
+			c.toolArgs[index] = &strings.Builder{}
+			item := model.ResponsesOutputItem{Type: "function_call", ID: randomID("fc_"), Status: "in_progress", CallID: tc.ID, Name: tc.Function.Name}
+			c.resp.Output = append(c.resp.Output, item)
+			if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_item.added", OutputIndex: intPtr(outIdx), Item: &item}); err != nil {
+				return err
+			}
+		}
+		if tc.Function.Arguments != "" {
+			c.toolArgs[index].WriteString(tc.Function.Arguments)
+			if err := c.emit(model.ResponsesStreamEvent{Type: "response.function_call_arguments.delta", OutputIndex: intPtr(outIdx),
+				ItemID: c.resp.Output[outIdx].ID, Delta: tc.Function.Arguments}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finishStream 输出各输出项的结束事件以及 response.completed
+func (c *responsesStreamConverter) finishStream() error {
+	if c.textIdx >= 0 {
+		item := &c.resp.Output[c.textIdx]
+		text := c.text.String()
+		item.Status = "completed"
+		item.Content = []model.ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}}
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_text.done", OutputIndex: intPtr(c.textIdx), ContentIndex: intPtr(0), ItemID: item.ID, Text: text}); err != nil {
+			return err
+		}
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.content_part.done", OutputIndex: intPtr(c.textIdx), ContentIndex: intPtr(0), ItemID: item.ID, Part: &item.Content[0]}); err != nil {
+			return err
+		}
+		done := *item
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_item.done", OutputIndex: intPtr(c.textIdx), Item: &done}); err != nil {
+			return err
+		}
+	}
+
+	// 按 chat 工具调用序号输出结束事件
+	indices := make([]int, 0, len(c.toolIdx))
+	for index := range c.toolIdx {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		outIdx := c.toolIdx[index]
+		item := &c.resp.Output[outIdx]
+		item.Status = "completed"
+		item.Arguments = c.toolArgs[index].String()
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.function_call_arguments.done", OutputIndex: intPtr(outIdx), ItemID: item.ID, Arguments: item.Arguments}); err != nil {
+			return err
+		}
+		done := *item
+		if err := c.emit(model.ResponsesStreamEvent{Type: "response.output_item.done", OutputIndex: intPtr(outIdx), Item: &done}); err != nil {
+			return err
+		}
+	}
+
+	c.resp.Usage = chatUsageToResponses(c.usage)
+	eventType := "response.completed"
+	c.resp.Status = "completed"
+	if c.finish == "length" {
+		eventType = "response.incomplete"
+		c.resp.Status = "incomplete"
+		c.resp.IncompleteDetails = &model.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	return c.emit(model.ResponsesStreamEvent{Type: eventType, Response: c.snapshot()})
+}
+
+// intPtr 返回 int 指针
+func intPtr(v int) *int {
+	return &v
+}
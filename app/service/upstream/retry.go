@@ -0,0 +1,115 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 错误类别（用于重试策略匹配，HTTP 状态码直接写数字或如 5xx 的通配）
+const (
+	ErrorKindStatus      = "status"       // 上游返回非 200 状态码
+	ErrorKindNetwork     = "network"      // 网络错误（连接失败、读取中断、流被截断等）
+	ErrorKindTimeout     = "timeout"      // 请求超时
+	ErrorKindStreamError = "stream_error" // 流内错误事件（可用 stream_error:<code> 匹配特定错误码）
+)
+
+// RetryPolicy 重试策略：决定哪些错误触发故障转移、哪些计入健康失败次数
+// 规则写法：状态码（"503"）、状态码通配（"5xx"）、错误类别（"network"、"timeout"、"stream_error"）、
+// 特定流内错误码（"stream_error:overloaded"，匹配错误的 code，没有 code 时匹配 type；空流为 empty_stream）
+// 不在 retry_on 中的错误不再尝试其他供应商，直接将上游错误返回给客户端
+type RetryPolicy struct {
+	RetryOn        []string `json:"retry_on,omitempty" yaml:"retry_on,omitempty" mapstructure:"retry_on"`                         // 触发故障转移的错误
+	CountAsFailure []string `json:"count_as_failure,omitempty" yaml:"count_as_failure,omitempty" mapstructure:"count_as_failure"` // 计入连续失败次数（影响健康状态）的错误
+}
+
+// DefaultRetryPolicy 默认重试策略：5xx、408、429、网络错误、超时、流内错误触发故障转移，其中 429 不计入失败次数（由限流冷却处理）
+var DefaultRetryPolicy = RetryPolicy{
+	RetryOn:        []string{"5xx", "408", "429", ErrorKindNetwork, ErrorKindTimeout, ErrorKindStreamError},
+	CountAsFailure: []string{"5xx", "408", ErrorKindNetwork, ErrorKindTimeout, ErrorKindStreamError},
+}
+
+// ErrorClass 一次上游错误的分类
+type ErrorClass struct {
+	Kind   string // 错误类别
+	Status int    // HTTP 状态码（Kind 为 status 时有效）
+	Code   string // 流内错误码或错误类型（Kind 为 stream_error 时有效）
+}
+
+// StatusError 按 HTTP 状态码分类的错误
+func StatusError(status int) ErrorClass {
+	return ErrorClass{Kind: ErrorKindStatus, Status: status}
+}
+
+// metricName 错误在时序指标中的类别：429、4xx、5xx、network、timeout、stream_error
+func (ec ErrorClass) metricName() string {
+	if ec.Kind != ErrorKindStatus {
+		return ec.Kind
+	}
+	if ec.Status == 429 {
+		return "429"
+	}
+	return fmt.Sprintf("%dxx", ec.Status/100)
+}
+
+// matches 检查错误是否匹配规则列表
+func (ec ErrorClass) matches(rules []string) bool {
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if ec.Kind == ErrorKindStatus {
+			if status, err := strconv.Atoi(rule); err == nil && status == ec.Status {
+				return true
+			}
+			if len(rule) == 3 && strings.HasSuffix(rule, "xx") && rule[0] == byte('0'+ec.Status/100) {
+				return true
+			}
+			continue
+		}
+		if rule == ec.Kind {
+			return true
+		}
+		if code, ok := strings.CutPrefix(rule, ErrorKindStreamError+":"); ok && ec.Kind == ErrorKindStreamError && code == strings.ToLower(ec.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicyFor 获取供应商生效的重试策略（供应商级配置逐项覆盖全局配置）
+func (m *Manager) retryPolicyFor(p *Provider) RetryPolicy {
+	policy := m.retryPolicy
+	if p.Config.RetryPolicy != nil {
+		if p.Config.RetryPolicy.RetryOn != nil {
+			policy.RetryOn = p.Config.RetryPolicy.RetryOn
+		}
+		if p.Config.RetryPolicy.CountAsFailure != nil {
+			policy.CountAsFailure = p.Config.RetryPolicy.CountAsFailure
+		}
+	}
+	return policy
+}
+
+// Classify 按供应商的重试策略判断错误：是否继续故障转移、是否计入健康失败次数
+func (m *Manager) Classify(p *Provider, ec ErrorClass) (retry bool, countAsFailure bool) {
+	policy := m.retryPolicyFor(p)
+	return ec.matches(policy.RetryOn), ec.matches(policy.CountAsFailure)
+}
+
+// RecordRejected 记录不计入健康状态的失败请求（如客户端参数错误），仅计入总请求数和时序指标的错误数
+func (m *Manager) RecordRejected(p *Provider, alias string, upstreamModel string, ec ErrorClass) {
+	p.totalReqs.Add(1)
+	if stats, exists := p.modelStats[alias+"|"+upstreamModel]; exists {
+		stats.TotalReqs.Add(1)
+	}
+	if series, exists := p.modelSeries[upstreamModel]; exists {
+		series.recordError(time.Now(), ec.metricName(), false)
+	}
+	outcome := outcomeRejected
+	if ec == StatusError(http.StatusTooManyRequests) {
+		outcome = outcomeRateLimited
+	}
+	promRequests.Inc(alias, p.Config.Name, upstreamModel, outcome)
+	promErrors.Inc(alias, p.Config.Name, upstreamModel, ec.metricName())
+}
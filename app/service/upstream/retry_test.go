@@ -0,0 +1,60 @@
+package upstream
+
+import "testing"
+
+func TestErrorClassMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		ec    ErrorClass
+		rules []string
+		want  bool
+	}{
+		{"exact status", StatusError(503), []string{"503"}, true},
+		{"status wildcard", StatusError(502), []string{"5xx"}, true},
+		{"wildcard other class", StatusError(404), []string{"5xx"}, false},
+		{"uppercase wildcard", StatusError(500), []string{" 5XX "}, true},
+		{"status does not match kind", StatusError(500), []string{ErrorKindNetwork}, false},
+		{"network kind", ErrorClass{Kind: ErrorKindNetwork}, []string{"5xx", ErrorKindNetwork}, true},
+		{"timeout kind", ErrorClass{Kind: ErrorKindTimeout}, []string{ErrorKindNetwork}, false},
+		{"any stream error", ErrorClass{Kind: ErrorKindStreamError, Code: "overloaded"}, []string{ErrorKindStreamError}, true},
+		{"stream error code", ErrorClass{Kind: ErrorKindStreamError, Code: "Overloaded"}, []string{"stream_error:overloaded"}, true},
+		{"other stream error code", ErrorClass{Kind: ErrorKindStreamError, Code: "invalid_request"}, []string{"stream_error:overloaded"}, false},
+		{"stream error code on network", ErrorClass{Kind: ErrorKindNetwork}, []string{"stream_error:network"}, false},
+		{"empty rules", StatusError(500), nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.ec.matches(tt.rules); got != tt.want {
+			t.Errorf("%s: matches(%v) = %v, want %v", tt.name, tt.rules, got, tt.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	m := &Manager{retryPolicy: DefaultRetryPolicy}
+	def := &Provider{}
+	custom := &Provider{Config: ProviderConfig{RetryPolicy: &RetryPolicy{RetryOn: []string{"503"}}}}
+
+	tests := []struct {
+		name        string
+		p           *Provider
+		ec          ErrorClass
+		wantRetry   bool
+		wantFailure bool
+	}{
+		{"default 5xx", def, StatusError(500), true, true},
+		{"default 429 not counted", def, StatusError(429), true, false},
+		{"default 400 passed through", def, StatusError(400), false, false},
+		{"default network", def, ErrorClass{Kind: ErrorKindNetwork}, true, true},
+		{"default timeout", def, ErrorClass{Kind: ErrorKindTimeout}, true, true},
+		{"default stream error", def, ErrorClass{Kind: ErrorKindStreamError, Code: "overloaded"}, true, true},
+		{"provider retry_on overrides", custom, StatusError(500), false, true},
+		{"provider retry_on matches", custom, StatusError(503), true, true},
+		{"provider keeps global count_as_failure", custom, ErrorClass{Kind: ErrorKindNetwork}, false, true},
+	}
+	for _, tt := range tests {
+		retry, failure := m.Classify(tt.p, tt.ec)
+		if retry != tt.wantRetry || failure != tt.wantFailure {
+			t.Errorf("%s: Classify = (%v, %v), want (%v, %v)", tt.name, retry, failure, tt.wantRetry, tt.wantFailure)
+		}
+	}
+}
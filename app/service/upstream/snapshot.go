@@ -0,0 +1,211 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ProviderSnapshot 供应商统计与健康状态快照（用于热重载和重启后恢复）
+type ProviderSnapshot struct {
+	Name        string                         `json:"name"`
+	BaseURL     string                         `json:"base_url"`
+	Type        string                         `json:"type"`
+	TotalReqs   int64                          `json:"total_requests"`
+	SuccessReqs int64                          `json:"success_requests"`
+	Models      map[string]ModelStatsSnapshot  `json:"models"`  // "alias|upstream" -> 统计数据
+	Healths     map[string]ModelHealthSnapshot `json:"healths"` // upstream -> 健康状态
+	Keys        map[string]APIKeySnapshot      `json:"keys"`    // Key 指纹 -> 统计数据（不保存 Key 明文）
+}
+
+// ModelStatsSnapshot 模型统计数据快照（不含进行中的请求数）
+type ModelStatsSnapshot struct {
+	TotalReqs      int64     `json:"total_requests"`
+	SuccessReqs    int64     `json:"success_requests"`
+	LatencyMs      float64   `json:"latency_ms"`
+	TTFTMs         float64   `json:"ttft_ms"`
+	LatencyWindow  []float64 `json:"latency_window"` // 最近的延迟样本，按时间先后排列
+	LatencySamples int64     `json:"latency_samples"`
+}
+
+// ModelHealthSnapshot 模型健康状态快照
+type ModelHealthSnapshot struct {
+	State             int32 `json:"state"`
+	FailureCount      int32 `json:"failure_count"`
+	LastFailure       int64 `json:"last_failure"`
+	OpenedAt          int64 `json:"opened_at"`
+	CooldownUntil     int64 `json:"cooldown_until"`
+	HalfOpenSuccesses int32 `json:"half_open_successes"`
+}
+
+// APIKeySnapshot API Key 统计数据快照
+type APIKeySnapshot struct {
+	TotalReqs     int64  `json:"total_requests"`
+	SuccessReqs   int64  `json:"success_requests"`
+	Failures      int64  `json:"failures"`
+	DisabledUntil int64  `json:"disabled_until"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// Snapshot 获取所有供应商的统计与健康状态快照
+func (m *Manager) Snapshot() []ProviderSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshots := make([]ProviderSnapshot, 0, len(m.providers))
+	for _, p := range m.providers {
+		s := ProviderSnapshot{
+			Name:        p.Config.Name,
+			BaseURL:     p.Config.BaseURL,
+			Type:        p.Config.Type,
+			TotalReqs:   p.totalReqs.Load(),
+			SuccessReqs: p.successReqs.Load(),
+			Models:      make(map[string]ModelStatsSnapshot),
+			Healths:     make(map[string]ModelHealthSnapshot),
+			Keys:        make(map[string]APIKeySnapshot),
+		}
+
+		p.mu.RLock()
+		for key, stats := range p.modelStats {
+			s.Models[key] = stats.snapshot()
+		}
+		for upstreamModel, health := range p.modelHealths {
+			s.Healths[upstreamModel] = health.snapshot()
+		}
+		p.mu.RUnlock()
+
+		for _, k := range p.keys {
+			if k.value == "" {
+				continue
+			}
+			s.Keys[keyFingerprint(k.value)] = k.snapshot()
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots
+}
+
+// Restore 从快照恢复统计与健康状态
+// 只恢复名称、base_url 和类型均未变化的供应商，以及其中仍存在的模型和 Key；应在 Manager 接收流量前调用
+func (m *Manager) Restore(snapshots []ProviderSnapshot) {
+	byName := make(map[string]*ProviderSnapshot, len(snapshots))
+	for i := range snapshots {
+		byName[snapshots[i].Name] = &snapshots[i]
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.providers {
+		s, ok := byName[p.Config.Name]
+		if !ok || s.BaseURL != p.Config.BaseURL || s.Type != p.Config.Type {
+			continue
+		}
+		p.totalReqs.Store(s.TotalReqs)
+		p.successReqs.Store(s.SuccessReqs)
+
+		p.mu.RLock()
+		for key, stats := range p.modelStats {
+			if ms, ok := s.Models[key]; ok {
+				stats.restore(ms)
+			}
+		}
+		for upstreamModel, health := range p.modelHealths {
+			if hs, ok := s.Healths[upstreamModel]; ok {
+				health.restore(hs)
+			}
+		}
+		p.mu.RUnlock()
+
+		for _, k := range p.keys {
+			if ks, ok := s.Keys[keyFingerprint(k.value)]; ok && k.value != "" {
+				k.restore(ks)
+			}
+		}
+	}
+}
+
+// keyFingerprint Key 指纹（SHA-256 前 8 字节），用于在快照中识别 Key 而不保存明文
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// snapshot 获取模型统计数据快照
+func (s *ModelStats) snapshot() ModelStatsSnapshot {
+	ms := ModelStatsSnapshot{
+		TotalReqs:   s.TotalReqs.Load(),
+		SuccessReqs: s.SuccessReqs.Load(),
+	}
+	s.latency.mu.Lock()
+	defer s.latency.mu.Unlock()
+	ms.LatencyMs = s.latency.ewmaMs
+	ms.TTFTMs = s.latency.ttftMs
+	ms.LatencySamples = s.latency.samples
+	// 环形缓冲区按时间先后展开
+	ms.LatencyWindow = append(append([]float64(nil), s.latency.window[s.latency.windowPos:]...), s.latency.window[:s.latency.windowPos]...)
+	return ms
+}
+
+// restore 从快照恢复模型统计数据
+func (s *ModelStats) restore(ms ModelStatsSnapshot) {
+	s.TotalReqs.Store(ms.TotalReqs)
+	s.SuccessReqs.Store(ms.SuccessReqs)
+	window := ms.LatencyWindow
+	if len(window) > latencyWindowSize {
+		window = window[len(window)-latencyWindowSize:]
+	}
+	s.latency.mu.Lock()
+	defer s.latency.mu.Unlock()
+	s.latency.ewmaMs = ms.LatencyMs
+	s.latency.ttftMs = ms.TTFTMs
+	s.latency.samples = ms.LatencySamples
+	s.latency.window = append([]float64(nil), window...)
+	s.latency.windowPos = 0
+}
+
+// snapshot 获取模型健康状态快照
+func (h *ModelHealth) snapshot() ModelHealthSnapshot {
+	return ModelHealthSnapshot{
+		State:             h.state.Load(),
+		FailureCount:      h.FailureCount.Load(),
+		LastFailure:       h.LastFailure.Load(),
+		OpenedAt:          h.OpenedAt.Load(),
+		CooldownUntil:     h.CooldownUntil.Load(),
+		HalfOpenSuccesses: h.halfOpenSuccesses.Load(),
+	}
+}
+
+// restore 从快照恢复模型健康状态（失败阈值使用当前配置）
+func (h *ModelHealth) restore(hs ModelHealthSnapshot) {
+	h.state.Store(hs.State)
+	h.FailureCount.Store(hs.FailureCount)
+	h.LastFailure.Store(hs.LastFailure)
+	h.OpenedAt.Store(hs.OpenedAt)
+	h.CooldownUntil.Store(hs.CooldownUntil)
+	h.halfOpenSuccesses.Store(hs.HalfOpenSuccesses)
+}
+
+// snapshot 获取 API Key 统计数据快照
+func (k *apiKey) snapshot() APIKeySnapshot {
+	ks := APIKeySnapshot{
+		TotalReqs:     k.totalReqs.Load(),
+		SuccessReqs:   k.successReqs.Load(),
+		Failures:      k.failures.Load(),
+		DisabledUntil: k.disabledUntil.Load(),
+	}
+	if lastErr, ok := k.lastError.Load().(string); ok {
+		ks.LastError = lastErr
+	}
+	return ks
+}
+
+// restore 从快照恢复 API Key 统计数据
+func (k *apiKey) restore(ks APIKeySnapshot) {
+	k.totalReqs.Store(ks.TotalReqs)
+	k.successReqs.Store(ks.SuccessReqs)
+	k.failures.Store(ks.Failures)
+	k.disabledUntil.Store(ks.DisabledUntil)
+	if ks.LastError != "" {
+		k.lastError.Store(ks.LastError)
+	}
+}
@@ -0,0 +1,180 @@
+package upstream
+
+import (
+	"fmt"
+	"gin_base/app/helper/log_helper"
+	"math/rand"
+	"sync/atomic"
+)
+
+// 路由策略（同优先级组内如何选择 ProviderModel）
+const (
+	StrategyWeightedRR       = "weighted_rr"        // 加权轮询（默认）
+	StrategyRandom           = "random"             // 加权随机
+	StrategyLeastInflight    = "least_inflight"     // 进行中请求数最少（按权重折算）
+	StrategyLowestP50Latency = "lowest_p50_latency" // 最近 P50 总耗时最低（流式请求含完整输出时间，流式为主的别名宜用 lowest_ttft）
+	StrategyLowestTTFT       = "lowest_ttft"        // 首 token 时间 EWMA 最低
+	StrategyLowestCost       = "lowest_cost"        // 价格最低（输入与输出价格之和，未配置价格的视为最贵）
+)
+
+// latencyExploreRate 延迟类策略的探索概率：按此概率改用加权随机，避免较慢的上游因无流量而延迟数据长期不更新
+const latencyExploreRate = 0.05
+
+// normalizeStrategy 校验路由策略，未知策略回退为加权轮询
+func normalizeStrategy(strategy string, alias string) string {
+	switch strategy {
+	case StrategyWeightedRR, StrategyRandom, StrategyLeastInflight, StrategyLowestP50Latency, StrategyLowestTTFT, StrategyLowestCost:
+		return strategy
+	case "":
+		return StrategyWeightedRR
+	}
+	log_helper.Warning(fmt.Sprintf("Unknown routing strategy %q for %s, fallback to %s", strategy, alias, StrategyWeightedRR))
+	return StrategyWeightedRR
+}
+
+// strategyFor 获取别名使用的路由策略
+func (m *Manager) strategyFor(alias string) string {
+	if strategy, ok := m.strategies[alias]; ok {
+		return strategy
+	}
+	return m.defaultStrategy
+}
+
+// roundRobinCounter 获取别名对应的轮询计数器（不存在则创建）
+func (m *Manager) roundRobinCounter(alias string) *atomic.Uint64 {
+	if counter, ok := m.rrCounters.Load(alias); ok {
+		return counter.(*atomic.Uint64)
+	}
+	counter, _ := m.rrCounters.LoadOrStore(alias, &atomic.Uint64{})
+	return counter.(*atomic.Uint64)
+}
+
+// selectByStrategy 按别名的路由策略从候选（同优先级）中选择一个
+func (m *Manager) selectByStrategy(alias string, candidates []ProviderModel) *ProviderModel {
+	switch m.strategyFor(alias) {
+	case StrategyRandom:
+		return weightedRandom(candidates)
+	case StrategyLeastInflight:
+		// 进行中请求数按权重折算，权重越大可承担越多并发
+		return m.selectLowest(alias, candidates, func(pm *ProviderModel, stats *ModelStats) (float64, bool) {
+			if stats == nil {
+				return 0, true
+			}
+			return float64(stats.InFlight.Load()) / float64(pm.GetCombinedWeight()), true
+		})
+	case StrategyLowestP50Latency:
+		if rand.Float64() < latencyExploreRate {
+			return weightedRandom(candidates)
+		}
+		return m.selectLowest(alias, candidates, func(pm *ProviderModel, stats *ModelStats) (float64, bool) {
+			if stats == nil {
+				return 0, false
+			}
+			_, p50Ms, _, samples := stats.latency.snapshot()
+			return p50Ms, samples > 0
+		})
+	case StrategyLowestTTFT:
+		if rand.Float64() < latencyExploreRate {
+			return weightedRandom(candidates)
+		}
+		return m.selectLowest(alias, candidates, func(pm *ProviderModel, stats *ModelStats) (float64, bool) {
+			if stats == nil {
+				return 0, false
+			}
+			_, _, ttftMs, samples := stats.latency.snapshot()
+			return ttftMs, samples > 0
+		})
+	case StrategyLowestCost:
+		return m.selectLowestBy(alias, candidates, func(pm *ProviderModel) float64 {
+			return pm.Mapping.Price.referencePrice()
+		})
+	}
+	return m.weightedRoundRobin(alias, candidates)
+}
+
+// selectLowest 按统计数据选择得分最低的候选（score 的 stats 在无统计数据时为 nil，返回 false 表示无样本）
+// 无样本的候选取有样本候选的平均得分，不会因得分为 0 独占流量，也不会因无样本始终得不到流量
+func (m *Manager) selectLowest(alias string, candidates []ProviderModel, score func(pm *ProviderModel, stats *ModelStats) (float64, bool)) *ProviderModel {
+	scores := make(map[*ProviderModel]float64, len(candidates))
+	var unsampled []*ProviderModel
+	var sum float64
+	for i := range candidates {
+		pm := &candidates[i]
+		s, ok := score(pm, pm.Provider.modelStats[alias+"|"+pm.Mapping.Upstream])
+		if !ok {
+			unsampled = append(unsampled, pm)
+			continue
+		}
+		scores[pm] = s
+		sum += s
+	}
+	if len(scores) > 0 {
+		neutral := sum / float64(len(scores))
+		for _, pm := range unsampled {
+			scores[pm] = neutral
+		}
+	}
+	return m.selectLowestBy(alias, candidates, func(pm *ProviderModel) float64 {
+		return scores[pm]
+	})
+}
+
+// selectLowestBy 选择得分最低的候选，得分相同（如均无延迟样本）时在其中加权轮询
+func (m *Manager) selectLowestBy(alias string, candidates []ProviderModel, score func(pm *ProviderModel) float64) *ProviderModel {
+	var best []ProviderModel
+	var bestScore float64
+	for i := range candidates {
+		pm := &candidates[i]
+		s := score(pm)
+		switch {
+		case len(best) == 0 || s < bestScore:
+			best = []ProviderModel{*pm}
+			bestScore = s
+		case s == bestScore:
+			best = append(best, *pm)
+		}
+	}
+	if len(best) == 1 {
+		return &best[0]
+	}
+	return m.weightedRoundRobin(alias, best)
+}
+
+// weightedRoundRobin 加权轮询（使用综合权重，每个别名独立计数）
+func (m *Manager) weightedRoundRobin(alias string, candidates []ProviderModel) *ProviderModel {
+	totalWeight := 0
+	for _, pm := range candidates {
+		totalWeight += pm.GetCombinedWeight()
+	}
+
+	// Add(1) 返回加1后的值，所以用 counter-1 让轮询从索引0开始
+	counter := m.roundRobinCounter(alias).Add(1)
+	targetWeight := int((counter - 1) % uint64(totalWeight))
+
+	currentWeight := 0
+	for i := range candidates {
+		currentWeight += candidates[i].GetCombinedWeight()
+		if targetWeight < currentWeight {
+			return &candidates[i]
+		}
+	}
+	return &candidates[0]
+}
+
+// weightedRandom 加权随机（使用综合权重）
+func weightedRandom(candidates []ProviderModel) *ProviderModel {
+	totalWeight := 0
+	for _, pm := range candidates {
+		totalWeight += pm.GetCombinedWeight()
+	}
+
+	targetWeight := rand.Intn(totalWeight)
+	currentWeight := 0
+	for i := range candidates {
+		currentWeight += candidates[i].GetCombinedWeight()
+		if targetWeight < currentWeight {
+			return &candidates[i]
+		}
+	}
+	return &candidates[0]
+}
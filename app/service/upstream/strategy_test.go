@@ -0,0 +1,56 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectLowest(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttftMs []int    // 各候选的首 token 时间样本（毫秒），0 表示无样本
+		want   []string // 依次调用的选择结果
+	}{
+		{
+			name:   "unsampled does not beat faster candidate",
+			ttftMs: []int{300, 100, 0},
+			want:   []string{"b", "b"},
+		},
+		{
+			name:   "unsampled ties with mean",
+			ttftMs: []int{0, 200, 200},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "no samples round robin",
+			ttftMs: []int{0, 0},
+			want:   []string{"a", "b", "a"},
+		},
+	}
+	for _, tt := range tests {
+		m := &Manager{}
+		var candidates []ProviderModel
+		for i, ms := range tt.ttftMs {
+			name := string(rune('a' + i))
+			p := &Provider{Config: ProviderConfig{Name: name, Weight: 1}, modelStats: map[string]*ModelStats{}}
+			if ms > 0 {
+				stats := &ModelStats{}
+				stats.latency.observe(time.Duration(ms)*time.Millisecond, time.Duration(ms)*time.Millisecond)
+				p.modelStats["alias|m"] = stats
+			}
+			candidates = append(candidates, ProviderModel{Provider: p, Mapping: ModelMapping{Upstream: "m", Weight: 1}})
+		}
+		for i, want := range tt.want {
+			got := m.selectLowest("alias", candidates, func(pm *ProviderModel, stats *ModelStats) (float64, bool) {
+				if stats == nil {
+					return 0, false
+				}
+				_, _, ttftMs, samples := stats.latency.snapshot()
+				return ttftMs, samples > 0
+			})
+			if got.Provider.Config.Name != want {
+				t.Errorf("%s: pick #%d = %s, want %s", tt.name, i+1, got.Provider.Config.Name, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package upstream
+
+import (
+	"fmt"
+	"gin_base/app/model"
+	"sync"
+	"time"
+)
+
+const (
+	metricsBucketSize  = time.Minute                               // 时序指标的桶大小
+	metricsRetention   = 24 * time.Hour                            // 时序指标保留时长
+	metricsBucketCount = int(metricsRetention / metricsBucketSize) // 环形缓冲区桶数
+	minuteNanos        = int64(metricsBucketSize)                  // 一分钟的纳秒数
+	latencyBucketCount = len(latencyBucketBounds) + 1              // 延迟直方图桶数（最后一个桶无上界）
+
+	defaultErrorRateWindow      = 5 * time.Minute // 窗口错误率判定的默认窗口
+	defaultErrorRateMinRequests = 10              // 窗口错误率判定的默认最少请求数
+)
+
+// latencyBucketBounds 延迟直方图各桶的上界（毫秒），用于估算窗口内的分位数
+var latencyBucketBounds = [...]float64{50, 100, 200, 300, 500, 750, 1000, 1500, 2000, 3000, 5000, 7500, 10000, 15000, 20000, 30000, 60000, 120000}
+
+// metricsWindows 可用的查询窗口及对应的点间隔
+var metricsWindows = map[string]struct {
+	window time.Duration
+	step   time.Duration
+}{
+	"5m":  {5 * time.Minute, time.Minute},
+	"1h":  {time.Hour, time.Minute},
+	"24h": {24 * time.Hour, 20 * time.Minute},
+}
+
+// ParseMetricsWindow 解析查询窗口（5m / 1h / 24h，为空时默认 1h），返回窗口长度和点间隔
+func ParseMetricsWindow(value string) (window, step time.Duration, err error) {
+	if value == "" {
+		value = "1h"
+	}
+	w, ok := metricsWindows[value]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid window %q, expected 5m, 1h or 24h", value)
+	}
+	return w.window, w.step, nil
+}
+
+// latencyHistogram 延迟直方图
+type latencyHistogram [latencyBucketCount]int64
+
+// observe 记录一个延迟样本（毫秒）
+func (h *latencyHistogram) observe(ms float64) {
+	for i, bound := range latencyBucketBounds {
+		if ms <= bound {
+			h[i]++
+			return
+		}
+	}
+	h[latencyBucketCount-1]++
+}
+
+// merge 累加另一个直方图
+func (h *latencyHistogram) merge(o *latencyHistogram) {
+	for i := range h {
+		h[i] += o[i]
+	}
+}
+
+// quantile 估算分位数（桶内线性插值，超出最大上界时取最大上界），无样本返回 0
+func (h *latencyHistogram) quantile(q float64) float64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range h {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == latencyBucketCount-1 {
+			return latencyBucketBounds[len(latencyBucketBounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBucketBounds[i-1]
+		}
+		return lower + (latencyBucketBounds[i]-lower)*(rank-float64(seen))/float64(n)
+	}
+	return latencyBucketBounds[len(latencyBucketBounds)-1]
+}
+
+// metricsBucket 一分钟内的请求指标
+type metricsBucket struct {
+	minute           int64            // 所属分钟（Unix 分钟数）
+	successes        int64            // 成功请求数
+	failures         int64            // 计入健康失败的错误数
+	errors           map[string]int64 // 按类别的错误数
+	latency          latencyHistogram // 成功请求的总延迟
+	ttft             latencyHistogram // 成功请求的首 token 时间
+	promptTokens     int64
+	completionTokens int64
+	totalTokens      int64
+}
+
+// requests 请求数（成功 + 各类错误）
+func (b *metricsBucket) requests() int64 {
+	n := b.successes
+	for _, count := range b.errors {
+		n += count
+	}
+	return n
+}
+
+// merge 累加另一个桶
+func (b *metricsBucket) merge(o *metricsBucket) {
+	b.successes += o.successes
+	b.failures += o.failures
+	for class, count := range o.errors {
+		if b.errors == nil {
+			b.errors = make(map[string]int64)
+		}
+		b.errors[class] += count
+	}
+	b.latency.merge(&o.latency)
+	b.ttft.merge(&o.ttft)
+	b.promptTokens += o.promptTokens
+	b.completionTokens += o.completionTokens
+	b.totalTokens += o.totalTokens
+}
+
+// summary 转换为对外的汇总数据
+func (b *metricsBucket) summary() MetricsSummary {
+	s := MetricsSummary{
+		Requests:         b.requests(),
+		Successes:        b.successes,
+		Errors:           make(map[string]int64, len(b.errors)),
+		P50LatencyMs:     b.latency.quantile(0.5),
+		P95LatencyMs:     b.latency.quantile(0.95),
+		P50TTFTMs:        b.ttft.quantile(0.5),
+		P95TTFTMs:        b.ttft.quantile(0.95),
+		PromptTokens:     b.promptTokens,
+		CompletionTokens: b.completionTokens,
+		TotalTokens:      b.totalTokens,
+	}
+	for class, count := range b.errors {
+		s.Errors[class] = count
+	}
+	if s.Requests > 0 {
+		s.SuccessRate = float64(s.Successes) / float64(s.Requests) * 100
+	}
+	return s
+}
+
+// timeSeries 按分钟滚动的请求指标（环形缓冲区，保留最近 24 小时，桶在首次写入时分配）
+type timeSeries struct {
+	mu      sync.Mutex
+	buckets [metricsBucketCount]*metricsBucket
+}
+
+// unixMinute 时间所属的 Unix 分钟数
+func unixMinute(t time.Time) int64 {
+	return t.UnixNano() / minuteNanos
+}
+
+// bucket 获取当前分钟的桶（桶属于更早的分钟时清空复用），调用方需持有锁
+func (s *timeSeries) bucket(now time.Time) *metricsBucket {
+	minute := unixMinute(now)
+	idx := int(minute % int64(metricsBucketCount))
+	b := s.buckets[idx]
+	if b == nil {
+		b = &metricsBucket{}
+		s.buckets[idx] = b
+	}
+	if b.minute != minute {
+		*b = metricsBucket{minute: minute}
+	}
+	return b
+}
+
+// recordSuccess 记录一次成功请求
+func (s *timeSeries) recordSuccess(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bucket(now).successes++
+}
+
+// recordError 记录一次错误（countAsFailure 表示计入健康失败）
+func (s *timeSeries) recordError(now time.Time, class string, countAsFailure bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(now)
+	if b.errors == nil {
+		b.errors = make(map[string]int64)
+	}
+	b.errors[class]++
+	if countAsFailure {
+		b.failures++
+	}
+}
+
+// observeLatency 记录一次成功请求的延迟和首 token 时间
+func (s *timeSeries) observeLatency(now time.Time, latency, ttft time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(now)
+	b.latency.observe(float64(latency) / float64(time.Millisecond))
+	b.ttft.observe(float64(ttft) / float64(time.Millisecond))
+}
+
+// addTokens 累加 token 用量
+func (s *timeSeries) addTokens(now time.Time, usage *model.Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(now)
+	b.promptTokens += int64(usage.PromptTokens)
+	b.completionTokens += int64(usage.CompletionTokens)
+	b.totalTokens += int64(usage.TotalTokens)
+}
+
+// aggregate 汇总 [from, to] 分钟范围内的桶，调用方需持有锁
+func (s *timeSeries) aggregate(from, to int64) *metricsBucket {
+	total := &metricsBucket{}
+	if to-from >= int64(metricsBucketCount) {
+		from = to - int64(metricsBucketCount) + 1
+	}
+	for minute := from; minute <= to; minute++ {
+		b := s.buckets[int(minute%int64(metricsBucketCount))]
+		if b != nil && b.minute == minute {
+			total.merge(b)
+		}
+	}
+	return total
+}
+
+// failureRate 从 since 到现在计入健康失败的错误占比（%）及请求数
+func (s *timeSeries) failureRate(now, since time.Time) (rate float64, requests int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.aggregate(unixMinute(since), unixMinute(now))
+	requests = b.requests()
+	if requests > 0 {
+		rate = float64(b.failures) / float64(requests) * 100
+	}
+	return rate, requests
+}
+
+// query 汇总最近 window 内的指标，并按 step 切分为时间点
+func (s *timeSeries) query(now time.Time, window, step time.Duration) (MetricsSummary, []MetricsPoint) {
+	end := unixMinute(now)
+	stepMinutes := int64(step / metricsBucketSize)
+	count := int64(window / step)
+	// 对齐到点间隔，最后一个点包含当前分钟
+	last := end - end%stepMinutes
+	first := last - (count-1)*stepMinutes
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	points := make([]MetricsPoint, 0, count)
+	for start := first; start <= last; start += stepMinutes {
+		b := s.aggregate(start, start+stepMinutes-1)
+		points = append(points, MetricsPoint{
+			Time:           time.Unix(0, start*minuteNanos).Unix(),
+			MetricsSummary: b.summary(),
+		})
+	}
+	return s.aggregate(end-int64(window/metricsBucketSize)+1, end).summary(), points
+}
+
+// MetricsSummary 一段时间内的请求指标汇总
+type MetricsSummary struct {
+	Requests         int64            `json:"requests"`          // 请求数（含限流和不计入健康状态的错误）
+	Successes        int64            `json:"successes"`         // 成功请求数
+	Errors           map[string]int64 `json:"errors"`            // 按类别的错误数：4xx / 5xx / 429 / network / timeout / stream_error
+	SuccessRate      float64          `json:"success_rate"`      // 成功率(%)，无请求时为 0
+	P50LatencyMs     float64          `json:"p50_latency_ms"`    // 成功请求总延迟 P50（毫秒，按直方图估算）
+	P95LatencyMs     float64          `json:"p95_latency_ms"`    // 成功请求总延迟 P95
+	P50TTFTMs        float64          `json:"p50_ttft_ms"`       // 首 token 时间 P50
+	P95TTFTMs        float64          `json:"p95_ttft_ms"`       // 首 token 时间 P95
+	PromptTokens     int64            `json:"prompt_tokens"`     // 输入 token 数
+	CompletionTokens int64            `json:"completion_tokens"` // 输出 token 数
+	TotalTokens      int64            `json:"total_tokens"`      // 总 token 数
+}
+
+// MetricsPoint 时序指标的一个时间点
+type MetricsPoint struct {
+	Time int64 `json:"time"` // 时间点起始时间戳(秒)
+	MetricsSummary
+}
+
+// ModelMetrics 供应商上游模型的时序指标
+type ModelMetrics struct {
+	ProviderName  string         `json:"provider_name"`
+	UpstreamModel string         `json:"upstream_model"`
+	Summary       MetricsSummary `json:"summary"` // 整个窗口的汇总
+	Points        []MetricsPoint `json:"points"`  // 按时间先后排列的时间点
+}
+
+// GetMetrics 获取各供应商上游模型最近 window 内的时序指标，step 为时间点间隔（应为整分钟）
+func (m *Manager) GetMetrics(window, step time.Duration) []ModelMetrics {
+	if step < metricsBucketSize {
+		step = metricsBucketSize
+	}
+	if window < step {
+		window = step
+	}
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]ModelMetrics, 0)
+	for _, p := range m.providers {
+		seen := make(map[string]bool)
+		for _, mm := range p.Config.ModelMappings {
+			series, exists := p.modelSeries[mm.Upstream]
+			if !exists || seen[mm.Upstream] {
+				continue
+			}
+			seen[mm.Upstream] = true
+			summary, points := series.query(now, window, step)
+			result = append(result, ModelMetrics{
+				ProviderName:  p.Config.Name,
+				UpstreamModel: mm.Upstream,
+				Summary:       summary,
+				Points:        points,
+			})
+		}
+	}
+	return result
+}
+
+// RecordTokens 记录一次请求的 token 用量（usage 为 nil 时忽略）
+func (m *Manager) RecordTokens(p *Provider, alias string, upstreamModel string, usage *model.Usage) {
+	if usage == nil {
+		return
+	}
+	if series, exists := p.modelSeries[upstreamModel]; exists {
+		series.addTokens(time.Now(), usage)
+	}
+	countTokens(p, alias, upstreamModel, usage)
+}
+
+// InheritMetrics 沿用旧 Manager 中名称、base_url 和类型均未变化的供应商的时序指标（热重载时调用，应在接收流量前调用）
+func (m *Manager) InheritMetrics(old *Manager) {
+	old.mu.RLock()
+	byName := make(map[string]*Provider, len(old.providers))
+	for _, p := range old.providers {
+		byName[p.Config.Name] = p
+	}
+	old.mu.RUnlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.providers {
+		op, ok := byName[p.Config.Name]
+		if !ok || op.Config.BaseURL != p.Config.BaseURL || op.Config.Type != p.Config.Type {
+			continue
+		}
+		for upstreamModel := range p.modelSeries {
+			if series, exists := op.modelSeries[upstreamModel]; exists {
+				p.modelSeries[upstreamModel] = series
+			}
+		}
+	}
+}
+
+// windowedErrorRateExceeded 窗口错误率模式下，判断最近窗口内计入失败的错误占比是否达到阈值
+// 只统计熔断器上次打开之后的数据，避免恢复后立即因旧的失败重新打开
+func (m *Manager) windowedErrorRateExceeded(p *Provider, upstreamModel string, health *ModelHealth) (bool, float64) {
+	series, exists := p.modelSeries[upstreamModel]
+	if !exists {
+		return false, 0
+	}
+	now := time.Now()
+	since := now.Add(-m.errorRateWindow)
+	if openedAt := time.Unix(0, health.OpenedAt.Load()); openedAt.After(since) {
+		since = openedAt
+	}
+	rate, requests := series.failureRate(now, since)
+	return requests >= int64(m.errorRateMinRequests) && rate >= m.errorRateThreshold, rate
+}
@@ -0,0 +1,170 @@
+package usagestat
+
+import (
+	"fmt"
+	"gin_base/app/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 可用的汇总维度
+const (
+	GroupByKey      = "key"      // 客户端密钥
+	GroupByAlias    = "alias"    // 模型别名
+	GroupByProvider = "provider" // 供应商
+	GroupByModel    = "model"    // 上游模型
+	GroupByDay      = "day"      // 按天
+	GroupByHour     = "hour"     // 按小时
+)
+
+// GroupBys 所有可用的汇总维度
+var GroupBys = []string{GroupByKey, GroupByAlias, GroupByProvider, GroupByModel, GroupByDay, GroupByHour}
+
+// Query 用量查询条件（时间按小时对齐，维度过滤为空时不限制）
+type Query struct {
+	Start   time.Time
+	End     time.Time
+	Filter  Dimension
+	GroupBy []string
+}
+
+// Row 用量汇总结果（未参与汇总的维度为空）
+type Row struct {
+	Time             string  `json:"time,omitempty"`
+	KeyName          string  `json:"key_name,omitempty"`
+	Alias            string  `json:"alias,omitempty"`
+	Provider         string  `json:"provider,omitempty"`
+	UpstreamModel    string  `json:"upstream_model,omitempty"`
+	Requests         int64   `json:"requests"`
+	CacheHits        int64   `json:"cache_hits"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// add 累加一行统计
+func (r *Row) add(stat *model.UsageStat) {
+	r.Requests += stat.Requests
+	r.CacheHits += stat.CacheHits
+	r.PromptTokens += stat.PromptTokens
+	r.CompletionTokens += stat.CompletionTokens
+	r.CachedTokens += stat.CachedTokens
+	r.ReasoningTokens += stat.ReasoningTokens
+	r.TotalTokens += stat.TotalTokens
+	r.Cost += stat.Cost
+}
+
+// ValidateGroupBy 校验汇总维度
+func ValidateGroupBy(groupBy []string) error {
+	for _, g := range groupBy {
+		valid := false
+		for _, v := range GroupBys {
+			if g == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown group_by %q, expected one of %s", g, strings.Join(GroupBys, ", "))
+		}
+	}
+	return nil
+}
+
+// Query 查询用量：数据库中已持久化的与内存中尚未写入的合并后按维度汇总
+// 返回汇总结果（按时间升序、总 token 数降序）和合计
+func (r *Recorder) Query(q Query) ([]Row, Row, error) {
+	start := q.Start.Truncate(time.Hour)
+
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	var stats []model.UsageStat
+	if r.db != nil {
+		db := r.db.Model(&model.UsageStat{}).Where("hour >= ? AND hour < ?", start, q.End)
+		if q.Filter.KeyName != "" {
+			db = db.Where("key_name = ?", q.Filter.KeyName)
+		}
+		if q.Filter.Alias != "" {
+			db = db.Where("alias = ?", q.Filter.Alias)
+		}
+		if q.Filter.Provider != "" {
+			db = db.Where("provider = ?", q.Filter.Provider)
+		}
+		if q.Filter.UpstreamModel != "" {
+			db = db.Where("upstream_model = ?", q.Filter.UpstreamModel)
+		}
+		if err := db.Find(&stats).Error; err != nil {
+			return nil, Row{}, err
+		}
+	}
+
+	r.mu.Lock()
+	for key, stat := range r.pending {
+		if !key.hour.Before(start) && key.hour.Before(q.End) && matchFilter(key.Dimension, q.Filter) {
+			stats = append(stats, *stat)
+		}
+	}
+	r.mu.Unlock()
+
+	var total Row
+	groups := make(map[Row]*Row)
+	for i := range stats {
+		stat := &stats[i]
+		total.add(stat)
+		key := groupKey(stat, q.GroupBy)
+		row, ok := groups[key]
+		if !ok {
+			row = &Row{}
+			*row = key
+			groups[key] = row
+		}
+		row.add(stat)
+	}
+
+	rows := make([]Row, 0, len(groups))
+	for _, row := range groups {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Time != rows[j].Time {
+			return rows[i].Time < rows[j].Time
+		}
+		return rows[i].TotalTokens > rows[j].TotalTokens
+	})
+	return rows, total, nil
+}
+
+// matchFilter 维度是否满足过滤条件
+func matchFilter(dim, filter Dimension) bool {
+	return (filter.KeyName == "" || dim.KeyName == filter.KeyName) &&
+		(filter.Alias == "" || dim.Alias == filter.Alias) &&
+		(filter.Provider == "" || dim.Provider == filter.Provider) &&
+		(filter.UpstreamModel == "" || dim.UpstreamModel == filter.UpstreamModel)
+}
+
+// groupKey 按汇总维度生成分组键（只保留参与汇总的维度，计数为 0）
+func groupKey(stat *model.UsageStat, groupBy []string) Row {
+	var key Row
+	for _, g := range groupBy {
+		switch g {
+		case GroupByKey:
+			key.KeyName = stat.KeyName
+		case GroupByAlias:
+			key.Alias = stat.Alias
+		case GroupByProvider:
+			key.Provider = stat.Provider
+		case GroupByModel:
+			key.UpstreamModel = stat.UpstreamModel
+		case GroupByDay:
+			key.Time = stat.Hour.In(time.Local).Format("2006-01-02")
+		case GroupByHour:
+			key.Time = stat.Hour.In(time.Local).Format("2006-01-02 15:00")
+		}
+	}
+	return key
+}
@@ -0,0 +1,223 @@
+package usagestat
+
+import (
+	"fmt"
+	"gin_base/app/helper/db_helper"
+	"gin_base/app/helper/log_helper"
+	"gin_base/app/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// flushInterval 内存中的用量写入数据库的间隔
+const flushInterval = 10 * time.Second
+
+// Dimension 用量统计维度
+type Dimension struct {
+	KeyName       string // 客户端密钥名称（未启用认证时为空）
+	Alias         string // 模型别名
+	Provider      string // 供应商
+	UpstreamModel string // 上游模型
+}
+
+// statKey 内存汇总的键：统计小时 + 维度
+type statKey struct {
+	hour time.Time
+	Dimension
+}
+
+// Recorder 记录每次请求的 token 用量和费用，按小时汇总后定期写入数据库
+// 数据库不可用时仅保留在内存中（重启后丢失）
+type Recorder struct {
+	mu       sync.Mutex
+	flushMu  sync.Mutex                   // 写入数据库期间阻止查询，避免已取出未写入的用量漏计
+	pending  map[statKey]*model.UsageStat // 尚未写入数据库的用量
+	spend    map[string]*keySpend         // 客户端密钥当天/当月的费用（首次查询时从数据库加载）
+	db       *gorm.DB                     // 为 nil 时不持久化
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRecorder 创建用量记录器，使用 db_helper 的默认数据库连接持久化（自动建表）
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		pending:  make(map[statKey]*model.UsageStat),
+		spend:    make(map[string]*keySpend),
+		db:       openDB(),
+		stopChan: make(chan struct{}),
+	}
+	go r.flushLoop()
+	return r
+}
+
+// openDB 获取数据库连接并创建用量统计表，失败时返回 nil
+func openDB() (db *gorm.DB) {
+	defer func() {
+		if err := recover(); err != nil {
+			log_helper.Warning(fmt.Sprintf("Usage stats database unavailable, keeping usage in memory only: %v", err))
+			db = nil
+		}
+	}()
+	db = db_helper.Db()
+	if err := db.AutoMigrate(&model.UsageStat{}); err != nil {
+		log_helper.Warning(fmt.Sprintf("Usage stats database unavailable, keeping usage in memory only: %v", err))
+		return nil
+	}
+	return db
+}
+
+// Record 记录一次请求的用量和费用（usage 为 nil 时只计请求数）
+func (r *Recorder) Record(dim Dimension, usage *model.Usage, cost float64) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	key := statKey{hour: now.Truncate(time.Hour), Dimension: dim}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stat, ok := r.pending[key]
+	if !ok {
+		stat = newStat(key)
+		r.pending[key] = stat
+	}
+	stat.Requests++
+	stat.Cost += cost
+	addUsage(stat, usage)
+
+	if spend, ok := r.spend[dim.KeyName]; ok {
+		spend.roll(now)
+		spend.daily += cost
+		spend.monthly += cost
+	}
+}
+
+// RecordCacheHit 记录一次命中响应缓存的请求（单独计数，不计入请求数、token 和费用）
+func (r *Recorder) RecordCacheHit(dim Dimension) {
+	if r == nil {
+		return
+	}
+	key := statKey{hour: time.Now().Truncate(time.Hour), Dimension: dim}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stat, ok := r.pending[key]
+	if !ok {
+		stat = newStat(key)
+		r.pending[key] = stat
+	}
+	stat.CacheHits++
+}
+
+// newStat 创建某小时某维度的空统计
+func newStat(key statKey) *model.UsageStat {
+	return &model.UsageStat{
+		Hour:          key.hour,
+		KeyName:       key.KeyName,
+		Alias:         key.Alias,
+		Provider:      key.Provider,
+		UpstreamModel: key.UpstreamModel,
+	}
+}
+
+// addUsage 将 token 用量累加到统计
+func addUsage(stat *model.UsageStat, usage *model.Usage) {
+	if usage == nil {
+		return
+	}
+	stat.PromptTokens += int64(usage.PromptTokens)
+	stat.CompletionTokens += int64(usage.CompletionTokens)
+	stat.TotalTokens += int64(usage.TotalTokens)
+	if usage.PromptTokensDetails != nil {
+		stat.CachedTokens += int64(usage.PromptTokensDetails.CachedTokens)
+	}
+	if usage.CompletionTokensDetails != nil {
+		stat.ReasoningTokens += int64(usage.CompletionTokensDetails.ReasoningTokens)
+	}
+}
+
+// mergeStat 将 src 的计数累加到 dst
+func mergeStat(dst, src *model.UsageStat) {
+	dst.Requests += src.Requests
+	dst.CacheHits += src.CacheHits
+	dst.PromptTokens += src.PromptTokens
+	dst.CompletionTokens += src.CompletionTokens
+	dst.CachedTokens += src.CachedTokens
+	dst.ReasoningTokens += src.ReasoningTokens
+	dst.TotalTokens += src.TotalTokens
+	dst.Cost += src.Cost
+}
+
+// flushLoop 定期将内存中的用量写入数据库
+func (r *Recorder) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Flush 将内存中的用量写入数据库，写入失败的保留到下次重试
+func (r *Recorder) Flush() {
+	if r == nil || r.db == nil {
+		return
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[statKey]*model.UsageStat)
+	r.mu.Unlock()
+
+	for key, stat := range pending {
+		if err := r.upsert(stat); err != nil {
+			log_helper.Warning(fmt.Sprintf("Failed to save usage stats, will retry: %v", err))
+			r.mu.Lock()
+			if cur, ok := r.pending[key]; ok {
+				mergeStat(cur, stat)
+			} else {
+				r.pending[key] = stat
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// upsert 累加写入一行统计（同一小时同一维度已存在时累加计数）
+func (r *Recorder) upsert(stat *model.UsageStat) error {
+	row := *stat
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "hour"}, {Name: "key_name"}, {Name: "alias"}, {Name: "provider"}, {Name: "upstream_model"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":          gorm.Expr("requests + ?", row.Requests),
+			"cache_hits":        gorm.Expr("cache_hits + ?", row.CacheHits),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", row.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", row.CompletionTokens),
+			"cached_tokens":     gorm.Expr("cached_tokens + ?", row.CachedTokens),
+			"reasoning_tokens":  gorm.Expr("reasoning_tokens + ?", row.ReasoningTokens),
+			"total_tokens":      gorm.Expr("total_tokens + ?", row.TotalTokens),
+			"cost":              gorm.Expr("cost + ?", row.Cost),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(&row).Error
+}
+
+// Stop 停止定期写入，并写入剩余的用量
+func (r *Recorder) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+		r.Flush()
+	})
+}
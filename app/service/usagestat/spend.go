@@ -0,0 +1,79 @@
+package usagestat
+
+import (
+	"gin_base/app/model"
+	"time"
+)
+
+// keySpend 客户端密钥当天和当月的费用
+type keySpend struct {
+	day     time.Time // 当天 0 点
+	month   time.Time // 当月 1 日 0 点
+	daily   float64
+	monthly float64
+}
+
+// dayStart 当天 0 点
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// monthStart 当月 1 日 0 点
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// roll 跨天/跨月时清零对应的费用
+func (s *keySpend) roll(now time.Time) {
+	if month := monthStart(now); !month.Equal(s.month) {
+		s.month = month
+		s.monthly = 0
+	}
+	if day := dayStart(now); !day.Equal(s.day) {
+		s.day = day
+		s.daily = 0
+	}
+}
+
+// Spend 获取客户端密钥当天和当月的费用（美元）
+// 首次查询时从数据库和内存中尚未写入的用量加载，之后随 Record 累加
+func (r *Recorder) Spend(keyName string) (daily, monthly float64) {
+	if r == nil {
+		return 0, 0
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	if spend, ok := r.spend[keyName]; ok && spend.month.Equal(monthStart(now)) {
+		spend.roll(now)
+		daily, monthly = spend.daily, spend.monthly
+		r.mu.Unlock()
+		return daily, monthly
+	}
+	r.mu.Unlock()
+
+	// 加载期间阻止写入数据库，避免已取出未写入的用量漏计
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spend := &keySpend{day: dayStart(now), month: monthStart(now)}
+	if r.db != nil {
+		r.db.Model(&model.UsageStat{}).Where("key_name = ? AND hour >= ?", keyName, spend.month).
+			Select("COALESCE(SUM(cost), 0)").Scan(&spend.monthly)
+		r.db.Model(&model.UsageStat{}).Where("key_name = ? AND hour >= ?", keyName, spend.day).
+			Select("COALESCE(SUM(cost), 0)").Scan(&spend.daily)
+	}
+	for key, stat := range r.pending {
+		if key.KeyName != keyName || key.hour.Before(spend.month) {
+			continue
+		}
+		spend.monthly += stat.Cost
+		if !key.hour.Before(spend.day) {
+			spend.daily += stat.Cost
+		}
+	}
+	r.spend[keyName] = spend
+	return spend.daily, spend.monthly
+}
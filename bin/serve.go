@@ -3,8 +3,16 @@ package bin
 import (
 	"context"
 	"gin_base/app/appconfig"
+	"gin_base/app/controller/admin"
 	"gin_base/app/middleware"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/ratelimit"
+	"gin_base/app/service/requestlog"
+	"gin_base/app/service/respcache"
+	"gin_base/app/service/statstore"
+	"gin_base/app/service/tracing"
 	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
 	"gin_base/route"
 	"net/http"
 	"os"
@@ -51,7 +59,13 @@ func StartServer() {
 	route.InitRouter(engine)
 
 	// 初始化 OpenAI 代理
-	manager := initOpenAIProxy(engine)
+	adminCtrl, usage, requests, stats := initOpenAIProxy(engine)
+
+	// 退出时写入剩余数据（defer 保证关闭过程中出错也会执行，按注册的逆序执行）
+	defer tracing.Shutdown() // 最后导出剩余的追踪跨度
+	defer stats.Stop()       // 保存供应商统计与健康状态快照
+	defer requests.Stop()    // 写入剩余的请求记录
+	defer usage.Stop()       // 写入剩余的 token 用量统计
 
 	// 自定义端口
 	port := os.Getenv("PORT")
@@ -81,9 +95,9 @@ func StartServer() {
 
 	logrus.Info("Shutting down server...")
 
-	// 停止 Manager 的健康检查
-	if manager != nil {
-		manager.Stop()
+	// 停止当前 Manager 的健康检查（热重载后启动时的 Manager 已被替换并停止）
+	if adminCtrl != nil {
+		adminCtrl.GetManager().Stop()
 		logrus.Info("Manager stopped")
 	}
 
@@ -98,11 +112,11 @@ func StartServer() {
 }
 
 // initOpenAIProxy 初始化 OpenAI 代理服务
-func initOpenAIProxy(engine *gin.Engine) *upstream.Manager {
+func initOpenAIProxy(engine *gin.Engine) (*admin.AdminController, *usagestat.Recorder, *requestlog.Recorder, *statstore.Store) {
 	config := loadOpenAIProxyConfig()
 	if config == nil || len(config.Providers) == 0 {
 		logrus.Warn("OpenAI proxy not configured, skipping")
-		return nil
+		return nil, nil, nil, nil
 	}
 
 	// 创建管理器配置
@@ -110,6 +124,16 @@ func initOpenAIProxy(engine *gin.Engine) *upstream.Manager {
 		MaxFailures:       config.MaxFailures,
 		RecoveryInterval:  time.Duration(config.RecoveryInterval) * time.Second,
 		HealthCheckPeriod: time.Duration(config.HealthCheckPeriod) * time.Second,
+		RecoveryMode:      config.RecoveryMode,
+		HalfOpenRatio:     config.HalfOpenRatio,
+		HalfOpenSuccesses: config.HalfOpenSuccesses,
+		RetryPolicy:       config.RetryPolicy,
+		DefaultStrategy:   config.DefaultStrategy,
+		Strategies:        config.Strategies,
+
+		ErrorRateThreshold:   config.ErrorRateThreshold,
+		ErrorRateWindow:      time.Duration(config.ErrorRateWindow) * time.Second,
+		ErrorRateMinRequests: config.ErrorRateMinRequests,
 	}
 
 	if mgrConfig.MaxFailures <= 0 {
@@ -122,10 +146,33 @@ func initOpenAIProxy(engine *gin.Engine) *upstream.Manager {
 		mgrConfig.HealthCheckPeriod = 60 * time.Second
 	}
 
+	// 链路追踪需在创建 Manager 前启动（恢复探测会创建跨度）
+	tracing.Init(config.Tracing)
+
 	manager := upstream.NewManager(config.Providers, mgrConfig)
 
-	// 初始化路由（忽略返回的 adminCtrl，因为它会在内部保持对 manager 的引用）
-	_ = route.InitOpenAIRouter(engine, manager, config.APIKeys, config.AdminKey, config.MaxRetries)
+	// 从数据库恢复上次运行的统计与健康状态
+	stats := statstore.NewStore()
+	manager.Restore(stats.Load())
+
+	// 初始化路由（adminCtrl 内部保持对 manager 的引用，并持有可热重载的全局配置）
+	keyStore := apikey.NewStore(config.APIKeys, config.VirtualKeys)
+	limiter := ratelimit.NewLimiter(config.RateLimit)
+	usage := usagestat.NewRecorder()
+	requests := requestlog.NewRecorder()
+	requestlog.SetRetentionDays(config.RequestLogRetentionDays)
+	cache := respcache.NewCache(config.ResponseCache)
+	adminCtrl := route.InitOpenAIRouter(engine, manager, keyStore, limiter, usage, requests, cache, config.AdminKey, config.MaxRetries)
+	adminCtrl.SetMidStreamFailover(config.MidStreamFailover)
+	adminCtrl.SetBodyCapture(config.BodyCapture)
+
+	// 定期保存当前 Manager 的统计快照（热重载后跟随新的 Manager）
+	stats.Start(adminCtrl.GetManager)
+
+	// 监听配置文件，变更后热重载客户端密钥
+	if err := adminCtrl.WatchConfig(); err != nil {
+		logrus.Warnf("Failed to watch openai_proxy config: %v", err)
+	}
 
 	logrus.Infof("OpenAI proxy initialized with %d providers (max_retries: %d)", len(config.Providers), config.MaxRetries)
 	for _, p := range config.Providers {
@@ -139,7 +186,7 @@ func initOpenAIProxy(engine *gin.Engine) *upstream.Manager {
 		}
 	}
 
-	return manager
+	return adminCtrl, usage, requests, stats
 }
 
 // loadOpenAIProxyConfig 加载 OpenAI 代理配置
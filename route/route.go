@@ -6,7 +6,12 @@ import (
 	"gin_base/app/controller/openai"
 	"gin_base/app/helper/response_helper"
 	"gin_base/app/middleware"
+	"gin_base/app/service/apikey"
+	"gin_base/app/service/ratelimit"
+	"gin_base/app/service/requestlog"
+	"gin_base/app/service/respcache"
 	"gin_base/app/service/upstream"
+	"gin_base/app/service/usagestat"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,12 +30,12 @@ func InitRouter(e *gin.Engine) {
 }
 
 // InitOpenAIRouter 初始化 OpenAI 兼容路由
-func InitOpenAIRouter(e *gin.Engine, manager *upstream.Manager, apiKeys []string, adminKey string, maxRetries int) *admin.AdminController {
+func InitOpenAIRouter(e *gin.Engine, manager *upstream.Manager, keyStore *apikey.Store, limiter *ratelimit.Limiter, usage *usagestat.Recorder, requests *requestlog.Recorder, cache *respcache.Cache, adminKey string, maxRetries int) *admin.AdminController {
 	// 创建 Admin 控制器
-	adminCtrl := admin.NewAdminController(manager, apiKeys, adminKey, maxRetries)
+	adminCtrl := admin.NewAdminController(manager, keyStore, limiter, usage, requests, cache, adminKey, maxRetries)
 
 	// 创建 OpenAI 控制器，并设置 ConfigGetter
-	ctrl := openai.NewController(adminCtrl)
+	ctrl := openai.NewController(adminCtrl, usage, requests, cache)
 
 	// 首页
 	e.GET("/", common.ModelAuthSwitchPage)
@@ -46,17 +51,39 @@ func InitOpenAIRouter(e *gin.Engine, manager *upstream.Manager, apiKeys []string
 	adminAPI.POST("/config", adminCtrl.SaveConfig)
 	adminAPI.GET("/logs", adminCtrl.GetLogs)
 	adminAPI.DELETE("/logs", adminCtrl.ClearLogs)
+	adminAPI.GET("/keys", adminCtrl.ListKeys)
+	adminAPI.POST("/keys", adminCtrl.CreateKey)
+	adminAPI.PUT("/keys/:name", adminCtrl.UpdateKey)
+	adminAPI.DELETE("/keys/:name", adminCtrl.DeleteKey)
+	adminAPI.GET("/usage", adminCtrl.GetUsage)
+	adminAPI.GET("/metrics", adminCtrl.GetMetrics)
+	adminAPI.GET("/requests", adminCtrl.GetRequests)
+	adminAPI.GET("/requests/:id/capture", adminCtrl.GetRequestCapture)
+	adminAPI.POST("/requests/:id/replay", ctrl.Replay)
 
 	// v1 API 组
 	v1 := e.Group("/v1")
 
-	// 应用认证中间件
-	if len(apiKeys) > 0 {
-		v1.Use(middleware.OpenAIAuthMultiKeys(apiKeys))
-	}
+	// 链路追踪（根跨度需覆盖认证失败等被拦截的请求）
+	v1.Use(middleware.Tracing())
+
+	// 应用认证中间件（密钥可热重载，启动时未配置密钥也需挂载）
+	v1.Use(middleware.OpenAIAuthMultiKeys(keyStore))
+
+	// 调用上游的接口：按客户端密钥检查费用上限并限流
+	metered := v1.Group("", middleware.KeyBudget(usage), middleware.KeyRateLimit(limiter))
 
 	// Chat Completions
-	v1.POST("/chat/completions", ctrl.ChatCompletions)
+	metered.POST("/chat/completions", ctrl.ChatCompletions)
+
+	// Responses
+	metered.POST("/responses", ctrl.Responses)
+
+	// Embeddings
+	metered.POST("/embeddings", ctrl.Embeddings)
+
+	// Anthropic Messages
+	metered.POST("/messages", ctrl.Messages)
 
 	// Models
 	v1.GET("/models", ctrl.Models)
@@ -66,5 +93,8 @@ func InitOpenAIRouter(e *gin.Engine, manager *upstream.Manager, apiKeys []string
 	internal := e.Group("/internal")
 	internal.GET("/stats", ctrl.Stats)
 
+	// Prometheus 指标
+	e.GET("/metrics", ctrl.Metrics)
+
 	return adminCtrl
 }